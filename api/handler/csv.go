@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// csvContentType is the media type of the CSV responses.
+const csvContentType = "text/csv"
+
+// eventCSVHeader is the header row of the events written as CSV.
+var eventCSVHeader = []string{"ruleName", "eventType", "customProperty"}
+
+// acceptsCSV reports whether the Accept header of the request lists `text/csv`.
+func acceptsCSV(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == csvContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeEventsCSV writes the events as CSV, with a header row followed by one row per event. The
+// rule name is only filled in when the engine reports rule names, and the custom property is
+// flattened into a single column by flattenCustomProperty.
+func writeEventsCSV(w io.Writer, events []rules.Event) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(eventCSVHeader); err != nil {
+		return err
+	}
+	for _, event := range events {
+		record := []string{event.RuleName, event.EventType, flattenCustomProperty(event.CustomProperty)}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// flattenCustomProperty formats a custom property as a single CSV field. Strings and other
+// scalars are written as they are, and objects as `key=value` pairs separated by semicolons and
+// sorted by key, with the keys of nested objects joined by dots, as in `a.b=1;c=x`. Lists are
+// written as JSON.
+func flattenCustomProperty(property interface{}) string {
+	switch property := property.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		var pairs []string
+		flattenObject("", property, &pairs)
+		sort.Strings(pairs)
+		return strings.Join(pairs, ";")
+	}
+	return formatScalar(property)
+}
+
+// flattenObject appends a `key=value` pair for every scalar or list in the object to pairs,
+// prefixing the keys of nested objects with the keys that lead to them.
+func flattenObject(prefix string, object map[string]interface{}, pairs *[]string) {
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenObject(key, nested, pairs)
+			continue
+		}
+		*pairs = append(*pairs, key+"="+formatScalar(value))
+	}
+}
+
+// formatScalar formats a value that is not an object, encoding lists as JSON.
+func formatScalar(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []interface{}:
+		if data, err := json.Marshal(value); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
@@ -1,10 +1,18 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/rgehrsitz/rulegopher/api/middleware"
 	"github.com/rgehrsitz/rulegopher/pkg/engine"
 	"github.com/rgehrsitz/rulegopher/pkg/facts"
 	"github.com/rgehrsitz/rulegopher/pkg/rules"
@@ -19,6 +27,18 @@ import (
 type Handler struct {
 	engine      *engine.Engine
 	factHandler *facts.FactHandler
+	inFlight    atomic.Int64 // number of fact evaluations being handled
+	idempotency *idempotencyCache
+	// StrictRuleDecoding rejects rules with fields that rules do not have, such as a misspelled
+	// "conditon", with a 400 response naming the field, instead of ignoring them.
+	StrictRuleDecoding bool
+	// DebugEndpoints enables the endpoints under /debug/, such as DebugIndex, that expose the
+	// engine's internals for troubleshooting. They respond 404 Not Found when it is false.
+	DebugEndpoints bool
+	// RichErrors makes EvaluateFact respond 400 Bad Request with the specific message when the
+	// evaluation failed only because of the fact's data, such as a value of the wrong type or,
+	// with StrictFacts, an unexpected key, instead of a generic 500 Internal Server Error.
+	RichErrors bool
 }
 
 // NewHandler returns a new instance of the Handler struct with the provided engine and
@@ -27,16 +47,21 @@ func NewHandler(engine *engine.Engine, factHandler *facts.FactHandler) *Handler
 	return &Handler{
 		engine:      engine,
 		factHandler: factHandler,
+		idempotency: newIdempotencyCache(),
 	}
 }
 
 // AddRule is a method of the `Handler` struct. It is responsible for adding a new rule
-// to the engine.
+// to the engine. Retries carrying the `Idempotency-Key` of an earlier request get its response.
 func (h *Handler) AddRule(w http.ResponseWriter, r *http.Request) {
+	h.idempotent(w, r, h.addRule)
+}
+
+// addRule adds the rule in the request body to the engine.
+func (h *Handler) addRule(w http.ResponseWriter, r *http.Request) {
 	var rule rules.Rule
-	err := json.NewDecoder(r.Body).Decode(&rule)
-	if err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+	if err := h.decodeRule(r, &rule); err != nil {
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -46,18 +71,128 @@ func (h *Handler) AddRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the other required fields are missing
-	if rule.Name == "" || (len(rule.Conditions.All) == 0 && len(rule.Conditions.Any) == 0) || rule.Event.EventType == "" {
+	if rule.Name == "" || (len(rule.Conditions.All) == 0 && len(rule.Conditions.Any) == 0 && len(rule.ConditionRefs) == 0) || (rule.Event.EventType == "" && len(rule.Events) == 0) {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	h.engine.AddRule(rule)
+	if err := h.engine.AddRule(rule); err != nil {
+		var existsErr *engine.RuleAlreadyExistsError
+		var tooManyErr *engine.TooManyRulesError
+		if errors.As(err, &existsErr) || errors.As(err, &tooManyErr) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if writeValidationErrors(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
+// decodeRule decodes a request body holding a rule into v. With StrictRuleDecoding set, fields
+// that v does not have are rejected, and the error names the first one found. Integers of 2^53
+// or more in the rule, and in the fact of a TryRule request, are kept exact, as described for
+// rules.ConvertNumbers.
+func (h *Handler) decodeRule(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if h.StrictRuleDecoding {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *rules.Rule:
+		v.ConvertNumbers()
+	case *tryRuleRequest:
+		v.Rule.ConvertNumbers()
+		v.Fact.ConvertNumbers()
+	case *engine.RulePatch:
+		if v.Event != nil {
+			v.Event.ConvertNumbers()
+		}
+	}
+	return nil
+}
+
+// decodeFact decodes a request body holding a fact, keeping large integers exact as
+// rules.ConvertNumbers does.
+func decodeFact(r *http.Request) (rules.Fact, error) {
+	var fact rules.Fact
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&fact); err != nil {
+		return nil, err
+	}
+	fact.ConvertNumbers()
+	return fact, nil
+}
+
+// ValidateRule is a method of the `Handler` struct. It is responsible for validating a rule
+// without adding it to the engine. A valid rule gets a 200 response, and an invalid one a 422
+// response describing every problem found.
+func (h *Handler) ValidateRule(w http.ResponseWriter, r *http.Request) {
+	var rule rules.Rule
+	if err := h.decodeRule(r, &rule); err != nil {
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.engine.ValidateRule(rule); err != nil {
+		if writeValidationErrors(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"valid": true})
+}
+
+// writeValidationErrors writes a 422 response with a JSON body of the form
+// `{"errors":{"<path>":"<message>"}}` mapping each invalid field of a rule to its problem. A rule
+// without conditions is reported at the `conditions` path. It returns false, without writing
+// anything, if err contains no validation errors.
+func writeValidationErrors(w http.ResponseWriter, err error) bool {
+	validationErrors := rules.ValidationErrors(err)
+	var nilConditionsErr *engine.NilRuleConditionsError
+	if errors.As(err, &nilConditionsErr) {
+		validationErrors = append(validationErrors, &rules.ValidationError{Path: "conditions", Message: nilConditionsErr.Error()})
+	}
+	if len(validationErrors) == 0 {
+		return false
+	}
+
+	details := make(map[string]string, len(validationErrors))
+	for _, validationErr := range validationErrors {
+		if message, ok := details[validationErr.Path]; ok {
+			details[validationErr.Path] = message + "; " + validationErr.Message
+			continue
+		}
+		details[validationErr.Path] = validationErr.Message
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": details})
+	return true
+}
+
 // RemoveRule is a method of the `Handler` struct. It is responsible for removing a rule
-// from the engine based on the provided rule name.
+// from the engine based on the provided rule name. Retries carrying the `Idempotency-Key` of an
+// earlier request get its response.
 func (h *Handler) RemoveRule(w http.ResponseWriter, r *http.Request) {
+	h.idempotent(w, r, h.removeRule)
+}
+
+// removeRule removes the rule named in the request from the engine.
+func (h *Handler) removeRule(w http.ResponseWriter, r *http.Request) {
 	ruleName := r.URL.Query().Get("name")
 	if ruleName == "" {
 		http.Error(w, "Missing rule name", http.StatusBadRequest)
@@ -67,14 +202,51 @@ func (h *Handler) RemoveRule(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// NoContentOnEmptyHeader is the request header that, when set to true, makes EvaluateFact respond
+// with 204 No Content instead of 200 with an empty array when no events are triggered.
+const NoContentOnEmptyHeader = "X-No-Content-On-Empty"
+
+// EvalDurationHeader is the response header of EvaluateFact carrying the time the engine spent
+// evaluating the fact, in microseconds, so that clients can track the server-side cost.
+const EvalDurationHeader = "X-Eval-Duration-Us"
+
 // EvaluateFact is a method of the `Handler` struct. It is responsible for evaluating a
 // fact by decoding the fact data from the request body, handling the fact using the `factHandler`
-// instance, and encoding the resulting events as a JSON response.
+// instance, and encoding the resulting events as a JSON response. Requests with the
+// `X-No-Content-On-Empty: true` header get a 204 response instead when no events are triggered,
+// and requests accepting `text/csv` get the events as CSV, one row per event. With the
+// `groupBy=eventType` query parameter, the events are returned as an object mapping each event
+// type to its events. With `explainMissing=true`, the JSON response is an object holding the
+// events and, under `missingFacts`, the facts each evaluated rule referenced but the fact lacked,
+// and is sent even when no events are triggered. Neither is supported for CSV responses, so
+// requests accepting `text/csv` with either get a 400 response. Successful responses carry the
+// evaluation time in the `X-Eval-Duration-Us` header.
 func (h *Handler) EvaluateFact(w http.ResponseWriter, r *http.Request) {
+	h.inFlight.Add(1)
+	defer h.inFlight.Add(-1)
 
-	var fact rules.Fact
-	err := json.NewDecoder(r.Body).Decode(&fact)
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy != "" && groupBy != "eventType" {
+		http.Error(w, fmt.Sprintf("Invalid groupBy: %s", groupBy), http.StatusBadRequest)
+		return
+	}
+
+	explainMissing := false
+	if value := r.URL.Query().Get("explainMissing"); value != "" {
+		var err error
+		if explainMissing, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid explainMissing: %s", value), http.StatusBadRequest)
+			return
+		}
+	}
 
+	// The CSV rows have no place for the groups or the missing facts
+	if acceptsCSV(r) && (groupBy != "" || explainMissing) {
+		http.Error(w, "groupBy and explainMissing are not supported for CSV responses", http.StatusBadRequest)
+		return
+	}
+
+	fact, err := decodeFact(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error decoding fact: %v", err), http.StatusBadRequest)
 		return
@@ -85,14 +257,348 @@ func (h *Handler) EvaluateFact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	events, err := h.factHandler.HandleFact(fact)
+	start := time.Now()
+	var events []rules.Event
+	var missingFacts map[string][]string
+	if explainMissing {
+		events, missingFacts, err = h.engine.EvaluateWithMissingFacts(fact)
+	} else {
+		events, err = h.factHandler.HandleFact(fact)
+	}
+	duration := time.Since(start)
+
+	if err != nil {
+		if h.RichErrors && isFactDataError(err) {
+			http.Error(w, fmt.Sprintf("Invalid fact data: %v", err), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error evaluating fact request_id=%s: %v", middleware.RequestIDFromContext(r.Context()), err)
+		http.Error(w, fmt.Sprintf("Error evaluating fact %v: %v", fact, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(EvalDurationHeader, strconv.FormatInt(duration.Microseconds(), 10))
+
+	if len(events) == 0 && !explainMissing {
+		if noContent, _ := strconv.ParseBool(r.Header.Get(NoContentOnEmptyHeader)); noContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if acceptsCSV(r) {
+		w.Header().Set("Content-Type", csvContentType)
+		if err := writeEventsCSV(w, events); err != nil {
+			log.Printf("Error writing events as CSV request_id=%s: %v", middleware.RequestIDFromContext(r.Context()), err)
+		}
+		return
+	}
+
+	var response interface{} = events
+	if groupBy == "eventType" {
+		response = groupEventsByType(events)
+	}
+	if explainMissing {
+		response = explainedEvents{Events: response, MissingFacts: missingFacts}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// explainedEvents is the response of EvaluateFact with explainMissing set: the events, grouped
+// if requested, along with the facts each evaluated rule referenced but the fact lacked.
+type explainedEvents struct {
+	Events       interface{}         `json:"events"`
+	MissingFacts map[string][]string `json:"missingFacts"`
+}
+
+// isFactDataError reports whether an evaluation error was caused by the evaluated fact's data
+// rather than by the rules or the server: an UnsupportedFactTypeError or an UnexpectedFactsError.
+// The errors collected in a multierror must all be such errors.
+func isFactDataError(err error) bool {
+	if merr, ok := err.(*multierror.Error); ok {
+		if len(merr.Errors) == 0 {
+			return false
+		}
+		for _, e := range merr.Errors {
+			if !isFactDataError(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var typeErr *rules.UnsupportedFactTypeError
+	return errors.As(err, &typeErr) || errors.Is(err, engine.ErrUnexpectedFacts)
+}
+
+// groupEventsByType returns the events keyed by their event type. The events of each type keep
+// their order.
+func groupEventsByType(events []rules.Event) map[string][]rules.Event {
+	groups := make(map[string][]rules.Event)
+	for _, event := range events {
+		groups[event.EventType] = append(groups[event.EventType], event)
+	}
+	return groups
+}
+
+// MatchRules is a method of the `Handler` struct. It is responsible for evaluating a fact and
+// returning only the names of the rules that matched, as `{"rules":[...]}`.
+func (h *Handler) MatchRules(w http.ResponseWriter, r *http.Request) {
+	fact, err := decodeFact(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error decoding fact: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(fact) == 0 {
+		http.Error(w, fmt.Sprintf("Invalid fact: %v", fact), http.StatusBadRequest)
+		return
+	}
 
+	ruleNames, err := h.engine.MatchedRuleNames(fact)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error evaluating fact %v: %v", fact, err), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(events)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"rules": ruleNames})
+}
+
+// tryRuleRequest is the request body of the TryRule endpoint.
+type tryRuleRequest struct {
+	Rule rules.Rule `json:"rule"`
+	Fact rules.Fact `json:"fact"`
+}
+
+// tryRuleResponse is the response body of the TryRule endpoint.
+type tryRuleResponse struct {
+	Matched         bool          `json:"matched"`
+	Events          []rules.Event `json:"events,omitempty"`
+	ValidationError string        `json:"validationError,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// TryRule is a method of the `Handler` struct. It is responsible for evaluating a fact against
+// a rule provided in the same request, without adding the rule to the engine. The response
+// reports whether the rule matched, and any validation or evaluation error.
+func (h *Handler) TryRule(w http.ResponseWriter, r *http.Request) {
+	var request tryRuleRequest
+	if err := h.decodeRule(r, &request); err != nil {
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var response tryRuleResponse
+	if err := h.engine.ValidateRule(request.Rule); err != nil {
+		response.ValidationError = err.Error()
+	} else {
+		matched, events, err := h.engine.TryRule(request.Rule, request.Fact)
+		if err != nil {
+			response.Error = err.Error()
+		}
+		response.Matched = matched
+		response.Events = events
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListRules is a method of the `Handler` struct. It is responsible for returning all of the
+// rules currently loaded in the engine as a JSON array.
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.engine.ListRules())
+}
+
+// getRuleResponse is the response body of the GetRule endpoint.
+type getRuleResponse struct {
+	Rule rules.Rule `json:"rule"`
+	// TTLSeconds is the number of whole seconds left before the rule expires, and is only set
+	// for rules with an expiry time
+	TTLSeconds *int64 `json:"ttlSeconds,omitempty"`
+}
+
+// GetRule is a method of the `Handler` struct. It is responsible for returning the rule with
+// the provided rule name, along with the time left before it expires if it has an expiry time.
+func (h *Handler) GetRule(w http.ResponseWriter, r *http.Request) {
+	ruleName := r.URL.Query().Get("name")
+	if ruleName == "" {
+		http.Error(w, "Missing rule name", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.engine.GetRule(ruleName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	response := getRuleResponse{Rule: rule}
+	now := time.Now
+	if h.engine.Now != nil {
+		now = h.engine.Now
+	}
+	if ttl, ok := rule.TTL(now()); ok {
+		seconds := int64(ttl / time.Second)
+		response.TTLSeconds = &seconds
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Rule serves the /rule endpoint: PATCH requests patch the rule with PatchRule, and other
+// requests get it with GetRule.
+func (h *Handler) Rule(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		h.PatchRule(w, r)
+		return
+	}
+	h.GetRule(w, r)
+}
+
+// PatchRule is a method of the `Handler` struct. It is responsible for changing the priority,
+// enabled flag or event of the rule with the provided rule name, as given by the fields present
+// in the request body, while keeping the rule's other fields. Retries carrying the
+// `Idempotency-Key` of an earlier request get its response.
+func (h *Handler) PatchRule(w http.ResponseWriter, r *http.Request) {
+	h.idempotent(w, r, h.patchRule)
+}
+
+// patchRule applies the patch in the request body to the rule named in the request.
+func (h *Handler) patchRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ruleName := r.URL.Query().Get("name")
+	if ruleName == "" {
+		http.Error(w, "Missing rule name", http.StatusBadRequest)
+		return
+	}
+
+	var patch engine.RulePatch
+	if err := h.decodeRule(r, &patch); err != nil {
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.engine.PatchRule(ruleName, patch); err != nil {
+		var notExistErr *engine.RuleDoesNotExistError
+		if errors.As(err, &notExistErr) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if writeValidationErrors(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// EnableRule is a method of the `Handler` struct. It is responsible for enabling the rule
+// with the provided rule name.
+func (h *Handler) EnableRule(w http.ResponseWriter, r *http.Request) {
+	h.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+		h.setRuleEnabled(w, r, h.engine.EnableRule)
+	})
+}
+
+// DisableRule is a method of the `Handler` struct. It is responsible for disabling the rule
+// with the provided rule name, so that it is no longer evaluated.
+func (h *Handler) DisableRule(w http.ResponseWriter, r *http.Request) {
+	h.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+		h.setRuleEnabled(w, r, h.engine.DisableRule)
+	})
+}
+
+// setRuleEnabled applies the given enable or disable function to the rule named in the
+// request, returning 404 if the rule does not exist.
+func (h *Handler) setRuleEnabled(w http.ResponseWriter, r *http.Request, apply func(string) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ruleName := r.URL.Query().Get("name")
+	if ruleName == "" {
+		http.Error(w, "Missing rule name", http.StatusBadRequest)
+		return
+	}
+
+	if err := apply(ruleName); err != nil {
+		var notExistErr *engine.RuleDoesNotExistError
+		if errors.As(err, &notExistErr) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// InFlight returns the number of fact evaluations currently being handled.
+func (h *Handler) InFlight() int64 {
+	return h.inFlight.Load()
+}
+
+// WaitForInFlight waits until no fact evaluations are being handled, or until the context is
+// done, in which case it returns the context's error. It is used on shutdown to let in-flight
+// evaluations finish.
+func (h *Handler) WaitForInFlight(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for h.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Stats is a method of the `Handler` struct. It returns runtime statistics about the server,
+// currently the number of in-flight fact evaluations, as `{"inFlight":n}`.
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"inFlight": h.InFlight()})
+}
+
+// Summary is a method of the `Handler` struct. It returns the rule, enabled rule and fact
+// counts, the limit on the number of rules and the operators used by the rules, without listing
+// the rules themselves.
+func (h *Handler) Summary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.engine.Summary())
+}
+
+// RuleStats is a method of the `Handler` struct. It returns the number of times each rule has
+// matched, keyed by rule name, including rules that have never matched.
+func (h *Handler) RuleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.engine.RuleStats())
+}
+
+// DebugIndex returns the rule index of the engine, mapping each fact name to the names of the
+// rules indexed under it in priority order, to show why a rule is, or is not, evaluated for a
+// fact. It is only served when DebugEndpoints is set.
+func (h *Handler) DebugIndex(w http.ResponseWriter, r *http.Request) {
+	if !h.DebugEndpoints {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.engine.IndexedRuleNames())
 }
 
 // ServeHTTP` is a method of the `Handler` struct that implements the `http.Handler`
@@ -106,6 +612,30 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.RemoveRule(w, r)
 	case "/evaluatefact":
 		h.EvaluateFact(w, r)
+	case "/match":
+		h.MatchRules(w, r)
+	case "/validaterule":
+		h.ValidateRule(w, r)
+	case "/tryrule":
+		h.TryRule(w, r)
+	case "/listrules":
+		h.ListRules(w, r)
+	case "/rule":
+		h.Rule(w, r)
+	case "/rule/enable":
+		h.EnableRule(w, r)
+	case "/rule/disable":
+		h.DisableRule(w, r)
+	case "/stats":
+		h.Stats(w, r)
+	case "/summary":
+		h.Summary(w, r)
+	case "/rulestats":
+		h.RuleStats(w, r)
+	case "/debug/index":
+		h.DebugIndex(w, r)
+	case "/openapi.json":
+		h.OpenAPI(w, r)
 	default:
 		http.NotFound(w, r)
 	}
@@ -2,10 +2,17 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rgehrsitz/rulegopher/pkg/engine"
 	"github.com/rgehrsitz/rulegopher/pkg/facts"
@@ -79,6 +86,343 @@ func TestEvaluateFact(t *testing.T) {
 	}
 }
 
+func TestEvaluateFactLargeIntegers(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	// 2^53 + 1 has no float64 of its own, and would equal 2^53 once decoded as one
+	rule := `{"name": "IDRule", "conditions": {"all": [{"fact": "id", "operator": "equal", "value": 9007199254740993}]}, "event": {"eventType": "match"}}`
+	req, _ := http.NewRequest("POST", "/addrule", bytes.NewBufferString(rule))
+	rr := httptest.NewRecorder()
+	h.AddRule(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to add rule: %v %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		fact    string
+		matched bool
+	}{
+		{`{"id": 9007199254740992}`, false},
+		{`{"id": 9007199254740993}`, true},
+		{`{"id": 9007199254740994}`, false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(tt.fact))
+		rr := httptest.NewRecorder()
+		h.EvaluateFact(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if matched := strings.Contains(rr.Body.String(), `"match"`); matched != tt.matched {
+			t.Errorf("expected matched %v for %s, got %s", tt.matched, tt.fact, rr.Body.String())
+		}
+	}
+}
+
+func TestEvaluateFactNoContentOnEmpty(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// Without the header, no events is still a 200 with an empty array
+	req, _ := http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": 20}`))
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Expected 200 with [], got %v with %q", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": 20}`))
+	req.Header.Set(NoContentOnEmptyHeader, "true")
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected an empty body, got %q", rr.Body.String())
+	}
+
+	// Matching facts still get their events
+	req, _ = http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": 35}`))
+	req.Header.Set(NoContentOnEmptyHeader, "true")
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"hot"`) {
+		t.Errorf("Expected 200 with the hot event, got %v with %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEvaluateFactCSV(t *testing.T) {
+	e := engine.NewEngine()
+	e.ReportRuleName = true
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event: rules.Event{
+			EventType:      "hot",
+			CustomProperty: map[string]interface{}{"action": "cool", "target": map[string]interface{}{"zone": "north"}},
+		},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": 35}`))
+	req.Header.Set("Accept", "text/csv, application/json;q=0.5")
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Expected a text/csv content type, got %q", contentType)
+	}
+	expected := "ruleName,eventType,customProperty\nHotRule,hot,action=cool;target.zone=north\n"
+	if rr.Body.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, rr.Body.String())
+	}
+
+	// Grouped and explained responses cannot be written as CSV
+	for _, query := range []string{"?groupBy=eventType", "?explainMissing=true"} {
+		req, _ := http.NewRequest("POST", "/evaluatefact"+query, bytes.NewBufferString(`{"temperature": 35}`))
+		req.Header.Set("Accept", "text/csv")
+		rr := httptest.NewRecorder()
+		h.EvaluateFact(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, query, rr.Code)
+		}
+	}
+}
+
+func TestEvaluateFactStrictFacts(t *testing.T) {
+	e := engine.NewEngine()
+	e.StrictFacts = true
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": 35, "password": "secret"}`))
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "unexpected facts not referenced by any rule: password") {
+		t.Errorf("Expected the unexpected key to be reported, got %q", body)
+	}
+}
+
+func TestEvaluateFactRichErrors(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// Without RichErrors, a type error is a generic 500
+	req, _ := http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": true}`))
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+
+	h.RichErrors = true
+	req, _ = http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": true}`))
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "unsupported type: bool for fact: temperature") {
+		t.Errorf("Expected the type error to be described, got %q", body)
+	}
+
+	// A type error alongside an error that is not caused by the fact's data stays 500
+	e.AddDerivedFact("heatIndex", func(rules.Fact) (interface{}, error) {
+		return nil, errors.New("weather service unavailable")
+	})
+	req, _ = http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": true}`))
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestEvaluateFactExplainMissing(t *testing.T) {
+	e := engine.NewEngine()
+	e.UnmatchedFactBehavior = "Ignore"
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name: "HumidHotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{
+			{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			{Fact: "humidity", Operator: "greaterThan", Value: 80},
+		}},
+		Event: rules.Event{EventType: "muggy"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/evaluatefact?explainMissing=true", bytes.NewBufferString(`{"temperature": 35}`))
+	req.Header.Set(NoContentOnEmptyHeader, "true")
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response struct {
+		Events       []rules.Event       `json:"events"`
+		MissingFacts map[string][]string `json:"missingFacts"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", rr.Body.String(), err)
+	}
+	if len(response.Events) != 0 {
+		t.Errorf("Expected no events, got %v", response.Events)
+	}
+	if !reflect.DeepEqual(response.MissingFacts, map[string][]string{"HumidHotRule": {"humidity"}}) {
+		t.Errorf("Expected humidity to be reported missing for HumidHotRule, got %v", response.MissingFacts)
+	}
+
+	req, _ = http.NewRequest("POST", "/evaluatefact?explainMissing=maybe", bytes.NewBufferString(`{"temperature": 35}`))
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEvaluateFactEvalDurationHeader(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "alert"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/evaluatefact", bytes.NewBufferString(`{"temperature": 35}`))
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	header := rr.Header().Get(EvalDurationHeader)
+	if header == "" {
+		t.Fatalf("Expected the %s header to be set", EvalDurationHeader)
+	}
+	if duration, err := strconv.ParseInt(header, 10, 64); err != nil || duration < 0 {
+		t.Errorf("Expected a non-negative number of microseconds, got %q", header)
+	}
+}
+
+func TestEvaluateFactGroupByEventType(t *testing.T) {
+	e := engine.NewEngine()
+	e.ReportRuleName = true
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Priority:   1,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "alert"},
+		},
+		{
+			Name:       "VeryHotRule",
+			Priority:   2,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 33}}},
+			Event:      rules.Event{EventType: "alert"},
+		},
+		{
+			Name:       "ReadingRule",
+			Priority:   3,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 0}}},
+			Event:      rules.Event{EventType: "info"},
+		},
+	} {
+		if err := e.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/evaluatefact?groupBy=eventType", bytes.NewBufferString(`{"temperature": 35}`))
+	rr := httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var groups map[string][]rules.Event
+	if err := json.Unmarshal(rr.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("Failed to decode grouped events: %v (%s)", err, rr.Body.String())
+	}
+	ruleNames := make(map[string][]string)
+	for eventType, events := range groups {
+		for _, event := range events {
+			if event.EventType != eventType {
+				t.Errorf("Expected only %s events under %s, got %v", eventType, eventType, event)
+			}
+			ruleNames[eventType] = append(ruleNames[eventType], event.RuleName)
+		}
+	}
+	expected := map[string][]string{"alert": {"HotRule", "VeryHotRule"}, "info": {"ReadingRule"}}
+	if !reflect.DeepEqual(ruleNames, expected) {
+		t.Errorf("Expected grouped rules %v, got %v", expected, ruleNames)
+	}
+
+	req, _ = http.NewRequest("POST", "/evaluatefact?groupBy=ruleName", bytes.NewBufferString(`{"temperature": 35}`))
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
 func TestHandlerAddRuleWithMissingFields(t *testing.T) {
 	// Create a new engine and fact handler
 	eng := engine.NewEngine()
@@ -114,6 +458,33 @@ func TestHandlerAddRuleWithMissingFields(t *testing.T) {
 	}
 }
 
+func TestHandlerAddRuleStrictDecoding(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+	h.StrictRuleDecoding = true
+
+	ruleJSON := `{
+		"name": "TestRule",
+		"priority": 1,
+		"conditons": {"all": [{"fact": "temperature", "operator": "greaterThan", "value": 30}]},
+		"event": {"eventType": "alert"}
+	}`
+	req, _ := http.NewRequest("POST", "/addrule", strings.NewReader(ruleJSON))
+	rr := httptest.NewRecorder()
+	h.AddRule(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	if !strings.Contains(rr.Body.String(), `unknown field "conditons"`) {
+		t.Errorf("Expected the response to name the unknown field, got %q", rr.Body.String())
+	}
+	if _, err := e.GetRule("TestRule"); err == nil {
+		t.Errorf("Expected the rule not to be added")
+	}
+}
+
 func TestHandlerRemoveRuleWithNonexistentRuleName(t *testing.T) {
 	// Create a new engine and fact handler
 	eng := engine.NewEngine()
@@ -165,3 +536,670 @@ func TestHandlerEvaluateFactWithInvalidInput(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
 	}
 }
+
+func TestHandlerEnableDisabledRule(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:     "TestRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := e.DisableRule(rule.Name); err != nil {
+		t.Fatalf("Failed to disable rule: %v", err)
+	}
+
+	fact := rules.Fact{
+		"temperature": 35,
+	}
+
+	// A disabled rule should not produce any events
+	events, err := e.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("Expected no events from a disabled rule, got %d", len(events))
+	}
+
+	req, _ := http.NewRequest("POST", "/rule/enable?name="+rule.Name, nil)
+	rr := httptest.NewRecorder()
+	h.EnableRule(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	events, err = e.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected 1 event from the enabled rule, got %d", len(events))
+	}
+}
+
+func TestHandlerDisableNonexistentRule(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	req, _ := http.NewRequest("POST", "/rule/disable?name=NonexistentRule", nil)
+	rr := httptest.NewRecorder()
+	h.DisableRule(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestHandlerAddRuleWithInvalidOperators(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	req, _ := http.NewRequest("POST", "/addrule", bytes.NewBuffer([]byte(`{
+		"name": "InvalidRule",
+		"conditions": {
+			"all": [
+				{"fact": "temperature", "operator": "hotterThan", "value": 30},
+				{"fact": "humidity", "operator": "wetterThan", "value": 50}
+			]
+		},
+		"event": {"eventType": "alert"}
+	}`)))
+	rr := httptest.NewRecorder()
+	h.AddRule(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "hotterThan") || !strings.Contains(body, "wetterThan") {
+		t.Errorf("Expected both invalid operators in the response, got: %s", body)
+	}
+}
+
+func TestHandlerValidateRuleWithoutConditions(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	for _, rule := range []string{
+		`{"name": "NoConditions", "event": {"eventType": "alert"}}`,
+		`{"event": {"eventType": "alert"}}`,
+	} {
+		req, _ := http.NewRequest("POST", "/validateRule", bytes.NewBufferString(rule))
+		rr := httptest.NewRecorder()
+		h.ValidateRule(rr, req)
+
+		if status := rr.Code; status != http.StatusUnprocessableEntity {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+		}
+		var response struct {
+			Errors map[string]string `json:"errors"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if message, ok := response.Errors["conditions"]; !ok || !strings.Contains(message, "cannot be nil") {
+			t.Errorf("Expected an error for conditions, got %v", response.Errors)
+		}
+	}
+
+	// The missing conditions are reported along with the other invalid fields
+	req, _ := http.NewRequest("POST", "/validateRule", bytes.NewBufferString(`{"event": {"eventType": "alert"}}`))
+	rr := httptest.NewRecorder()
+	h.ValidateRule(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, `"name"`) || !strings.Contains(body, `"conditions"`) {
+		t.Errorf("Expected errors for both name and conditions, got %s", body)
+	}
+}
+
+func TestHandlerMatchRules(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	for i, threshold := range []int{30, 20, 40} {
+		rule := rules.Rule{
+			Name:     fmt.Sprintf("Rule%d", i+1),
+			Priority: i + 1,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{
+					{
+						Fact:     "temperature",
+						Operator: "greaterThan",
+						Value:    threshold,
+					},
+				},
+			},
+			Event: rules.Event{
+				EventType: "alert",
+			},
+		}
+		if err := e.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	factJSON, _ := json.Marshal(rules.Fact{"temperature": 35})
+	req, _ := http.NewRequest("POST", "/match", bytes.NewBuffer(factJSON))
+	rr := httptest.NewRecorder()
+	h.MatchRules(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response struct {
+		Rules []string `json:"rules"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Rules) != 2 || response.Rules[0] != "Rule1" || response.Rules[1] != "Rule2" {
+		t.Errorf("Expected matched rules [Rule1 Rule2], got %v", response.Rules)
+	}
+}
+
+func TestHandlerTryRule(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := `{
+		"name": "TestRule",
+		"priority": 1,
+		"conditions": {
+			"all": [{"fact": "temperature", "operator": "greaterThan", "value": 30}]
+		},
+		"event": {"eventType": "alert"}
+	}`
+
+	tests := []struct {
+		name     string
+		fact     string
+		expected bool
+	}{
+		{"matching fact", `{"temperature": 35}`, true},
+		{"non-matching fact", `{"temperature": 25}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"rule": ` + rule + `, "fact": ` + tt.fact + `}`
+			req, _ := http.NewRequest("POST", "/tryRule", bytes.NewBufferString(body))
+			rr := httptest.NewRecorder()
+			h.TryRule(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+
+			var response struct {
+				Matched bool          `json:"matched"`
+				Events  []rules.Event `json:"events"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Matched != tt.expected {
+				t.Errorf("Expected matched %v, got %v", tt.expected, response.Matched)
+			}
+			if tt.expected && (len(response.Events) != 1 || response.Events[0].EventType != "alert") {
+				t.Errorf("Expected the alert event, got %v", response.Events)
+			}
+		})
+	}
+
+	// The rule must not have been stored
+	if len(e.ListRules()) != 0 {
+		t.Errorf("Expected the engine to have no rules, got %d", len(e.ListRules()))
+	}
+}
+
+func TestHandlerTryRuleWithInvalidRule(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	body := `{
+		"rule": {
+			"name": "TestRule",
+			"conditions": {"all": [{"fact": "temperature", "operator": "hotterThan", "value": 30}]},
+			"event": {"eventType": "alert"}
+		},
+		"fact": {"temperature": 35}
+	}`
+	req, _ := http.NewRequest("POST", "/tryRule", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	h.TryRule(rr, req)
+
+	var response struct {
+		Matched         bool   `json:"matched"`
+		ValidationError string `json:"validationError"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Matched || !strings.Contains(response.ValidationError, "hotterThan") {
+		t.Errorf("Expected a validation error naming the invalid operator, got %+v", response)
+	}
+}
+
+func TestHandlerCustomPropertyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name           string
+		customProperty string
+		expected       interface{}
+	}{
+		{"string", `"AC turned on"`, "AC turned on"},
+		{"number", `42.5`, 42.5},
+		{"integer", `42`, float64(42)},
+		{"object", `{"channel": "email", "retries": 3}`, map[string]interface{}{"channel": "email", "retries": float64(3)}},
+		{"array", `["email", 2, true]`, []interface{}{"email", float64(2), true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := engine.NewEngine()
+			fh := facts.NewFactHandler(e)
+			h := NewHandler(e, fh)
+
+			rule := `{
+				"name": "TestRule",
+				"priority": 1,
+				"conditions": {"all": [{"fact": "temperature", "operator": "greaterThan", "value": 30}]},
+				"event": {"eventType": "alert", "customProperty": ` + tt.customProperty + `}
+			}`
+			req, _ := http.NewRequest("POST", "/addRule", bytes.NewBufferString(rule))
+			rr := httptest.NewRecorder()
+			h.AddRule(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Failed to add rule: %v %s", rr.Code, rr.Body.String())
+			}
+
+			req, _ = http.NewRequest("POST", "/evaluateFact", bytes.NewBufferString(`{"temperature": 35}`))
+			rr = httptest.NewRecorder()
+			h.EvaluateFact(rr, req)
+
+			var events []rules.Event
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			if !reflect.DeepEqual(events[0].CustomProperty, tt.expected) {
+				t.Errorf("Expected custom property %#v, got %#v", tt.expected, events[0].CustomProperty)
+			}
+		})
+	}
+}
+
+func TestHandlerNilCustomPropertyIsOmitted(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := `{
+		"name": "TestRule",
+		"priority": 1,
+		"conditions": {"all": [{"fact": "temperature", "operator": "greaterThan", "value": 30}]},
+		"event": {"eventType": "alert"}
+	}`
+	req, _ := http.NewRequest("POST", "/addRule", bytes.NewBufferString(rule))
+	rr := httptest.NewRecorder()
+	h.AddRule(rr, req)
+
+	req, _ = http.NewRequest("POST", "/evaluateFact", bytes.NewBufferString(`{"temperature": 35}`))
+	rr = httptest.NewRecorder()
+	h.EvaluateFact(rr, req)
+
+	if strings.Contains(rr.Body.String(), "customProperty") {
+		t.Errorf("Expected the nil custom property to be omitted, got %s", rr.Body.String())
+	}
+}
+
+func TestHandlerAddRuleReportsValidationPaths(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := `{
+		"name": "InvalidRule",
+		"conditions": {
+			"all": [
+				{"fact": "temperature", "operator": "greaterThan", "value": 30},
+				{"any": [{"fact": "humidity", "operator": "wetterThan", "value": 50}]}
+			]
+		},
+		"event": {"eventType": "alert"}
+	}`
+
+	for _, endpoint := range []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"AddRule", h.AddRule},
+		{"ValidateRule", h.ValidateRule},
+	} {
+		t.Run(endpoint.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(rule))
+			rr := httptest.NewRecorder()
+			endpoint.handler(rr, req)
+
+			if status := rr.Code; status != http.StatusUnprocessableEntity {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+			}
+
+			var response struct {
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			message, ok := response.Errors["conditions.all[1].any[0].operator"]
+			if !ok || !strings.Contains(message, "wetterThan") {
+				t.Errorf("Expected an error for conditions.all[1].any[0].operator, got %v", response.Errors)
+			}
+			if len(response.Errors) != 1 {
+				t.Errorf("Expected exactly one invalid field, got %v", response.Errors)
+			}
+		})
+	}
+
+	if len(e.ListRules()) != 0 {
+		t.Errorf("Expected the invalid rule not to be added")
+	}
+}
+
+func TestHandlerSummary(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "hot"},
+		},
+		{
+			Name:       "ColdRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "lessThan", Value: 5}}},
+			Event:      rules.Event{EventType: "cold"},
+		},
+	} {
+		if err := e.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	if err := e.DisableRule("ColdRule"); err != nil {
+		t.Fatalf("Failed to disable rule: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.Summary(rr, httptest.NewRequest("GET", "/summary", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	expected := `{"ruleCount":2,"maxRules":0,"enabledCount":1,"factCount":1,"operatorsUsed":["greaterThan","lessThan"]}`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+}
+
+func TestHandlerRuleStats(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if _, err := e.Evaluate(rules.Fact{"temperature": 35}); err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/rulestats", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"HotRule":1}` {
+		t.Errorf(`Expected {"HotRule":1}, got %s`, body)
+	}
+}
+
+func TestHandlerDebugIndex(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Priority:   2,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "hot"},
+		},
+		{
+			Name:     "HumidHeatRule",
+			Priority: 1,
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 25},
+				{Fact: "humidity", Operator: "greaterThan", Value: 80},
+			}},
+			Event: rules.Event{EventType: "muggy"},
+		},
+	} {
+		if err := e.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	// The endpoint is hidden unless the debug endpoints are enabled
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/index", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	h.DebugEndpoints = true
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/index", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	var index map[string][]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &index); err != nil {
+		t.Fatalf("Failed to decode index: %v (%s)", err, rr.Body.String())
+	}
+	expected := map[string][]string{
+		"temperature": {"HumidHeatRule", "HotRule"},
+		"humidity":    {"HumidHeatRule"},
+	}
+	if !reflect.DeepEqual(index, expected) {
+		t.Errorf("Expected index %v, got %v", expected, index)
+	}
+}
+
+func TestHandlerGetRule(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	expiresAt := time.Now().Add(time.Hour + 30*time.Second)
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "PromotionRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "cartTotal", Operator: "greaterThan", Value: 50}}},
+			Event:      rules.Event{EventType: "discount"},
+			ExpiresAt:  &expiresAt,
+		},
+		{
+			Name:       "PermanentRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "cartTotal", Operator: "greaterThan", Value: 500}}},
+			Event:      rules.Event{EventType: "freeShipping"},
+		},
+	} {
+		if err := e.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.GetRule(rr, httptest.NewRequest("GET", "/rule?name=PromotionRule", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	var response struct {
+		Rule       rules.Rule `json:"rule"`
+		TTLSeconds *int64     `json:"ttlSeconds"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Rule.Name != "PromotionRule" {
+		t.Errorf("Expected the promotion rule, got %v", response.Rule.Name)
+	}
+	if response.TTLSeconds == nil || *response.TTLSeconds < 3580 || *response.TTLSeconds > 3630 {
+		t.Errorf("Expected a TTL of about 3630 seconds, got %v", response.TTLSeconds)
+	}
+
+	rr = httptest.NewRecorder()
+	h.GetRule(rr, httptest.NewRequest("GET", "/rule?name=PermanentRule", nil))
+	if strings.Contains(rr.Body.String(), "ttlSeconds") {
+		t.Errorf("Expected no TTL for a rule without an expiry time, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.GetRule(rr, httptest.NewRequest("GET", "/rule?name=MissingRule", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing rule, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+// blockingReader blocks reads until release is closed, and then reads from the wrapped reader.
+type blockingReader struct {
+	release chan struct{}
+	reader  *strings.Reader
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	<-b.release
+	return b.reader.Read(p)
+}
+
+func TestHandlerPatchRule(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Priority:   10,
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, "/rule?name=HotRule", strings.NewReader(`{"priority": 1}`))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	patched, _ := e.GetRule("HotRule")
+	if patched.Priority != 1 || !reflect.DeepEqual(patched.Conditions, rule.Conditions) {
+		t.Errorf("Expected only the priority to change, got %+v", patched)
+	}
+
+	req, _ = http.NewRequest(http.MethodPatch, "/rule?name=ColdRule", strings.NewReader(`{"priority": 1}`))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// GET requests still return the rule
+	req, _ = http.NewRequest(http.MethodGet, "/rule?name=HotRule", nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"priority":1`) {
+		t.Errorf("Expected the patched rule, got %v with %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandlerWaitForInFlightEvaluations(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	body := &blockingReader{release: make(chan struct{}), reader: strings.NewReader(`{"temperature": 35}`)}
+	req, _ := http.NewRequest("POST", "/evaluateFact", body)
+	done := make(chan struct{})
+	go func() {
+		h.EvaluateFact(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for h.InFlight() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the evaluation to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rr := httptest.NewRecorder()
+	h.Stats(rr, httptest.NewRequest("GET", "/stats", nil))
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"inFlight":1}` {
+		t.Errorf("Expected one in-flight evaluation in the stats, got %s", body)
+	}
+
+	// Shutdown gives up if the evaluation does not finish in time
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := h.WaitForInFlight(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected WaitForInFlight to time out, got %v", err)
+	}
+
+	// and returns once it finishes
+	close(body.release)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.WaitForInFlight(ctx); err != nil {
+		t.Errorf("Expected WaitForInFlight to return once the evaluation finished, got %v", err)
+	}
+	<-done
+	if h.InFlight() != 0 {
+		t.Errorf("Expected no in-flight evaluations, got %d", h.InFlight())
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// IdempotencyKeyHeader is the request header that makes a mutating request safe to retry. A
+// request repeating the key of an earlier request to the same endpoint gets the response of the
+// earlier request, and is not applied again. Reusing a key for a request with a different query
+// or body is rejected with 422 Unprocessable Entity.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeys is the number of recent idempotency keys that are remembered. Once it is
+// reached, the oldest key is forgotten whenever a new one is added.
+const maxIdempotencyKeys = 1024
+
+// idempotentResponse is the response recorded for a request with an idempotency key. requestHash
+// is the hash of the query and body of the request. done is closed once the response has been
+// recorded.
+type idempotentResponse struct {
+	requestHash [sha256.Size]byte
+	done        chan struct{}
+	status      int
+	contentType string
+	body        []byte
+}
+
+// idempotencyCache remembers the responses to recent requests with an idempotency key.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	keys      []string // in the order they were added, oldest first
+}
+
+// newIdempotencyCache returns an empty idempotencyCache.
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{responses: make(map[string]*idempotentResponse)}
+}
+
+// start returns the response recorded for the key, and false, if the key has been seen before.
+// Otherwise it reserves the key for the request with the given hash and returns a new response to
+// record, and true.
+func (c *idempotencyCache) start(key string, requestHash [sha256.Size]byte) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if response, ok := c.responses[key]; ok {
+		return response, false
+	}
+
+	if len(c.keys) >= maxIdempotencyKeys {
+		delete(c.responses, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+	response := &idempotentResponse{requestHash: requestHash, done: make(chan struct{})}
+	c.responses[key] = response
+	c.keys = append(c.keys, key)
+	return response, true
+}
+
+// forget removes the key, so that the next request with it is handled again.
+func (c *idempotencyCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.responses, key)
+	for i, k := range c.keys {
+		if k == key {
+			c.keys = append(c.keys[:i], c.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// responseRecorder is an http.ResponseWriter that records the status and body written through
+// it to the wrapped ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent handles a mutating request. A request with an idempotency key already used for
+// the same endpoint gets the recorded response of the first request, waiting for it if it is
+// still being handled, instead of being handled again, unless its query or body differs from
+// that of the first request, in which case it is rejected. Server errors, including panics, are
+// not remembered, so a request that failed with one can be retried with the same key.
+func (h *Handler) idempotent(w http.ResponseWriter, r *http.Request, handle http.HandlerFunc) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		handle(w, r)
+		return
+	}
+	key = r.URL.Path + " " + key
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	requestHash := sha256.Sum256([]byte(r.URL.RawQuery + "\n" + string(body)))
+
+	response, first := h.idempotency.start(key, requestHash)
+	if !first {
+		if response.requestHash != requestHash {
+			http.Error(w, "Idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+			return
+		}
+		<-response.done
+		if response.contentType != "" {
+			w.Header().Set("Content-Type", response.contentType)
+		}
+		w.WriteHeader(response.status)
+		w.Write(response.body)
+		return
+	}
+
+	rec := &responseRecorder{ResponseWriter: w}
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			// Whatever was written before the panic, the request was not handled
+			response.status = http.StatusInternalServerError
+			response.contentType = "text/plain; charset=utf-8"
+			response.body = []byte(http.StatusText(http.StatusInternalServerError) + "\n")
+		} else {
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			response.status = rec.status
+			response.contentType = w.Header().Get("Content-Type")
+			response.body = rec.body.Bytes()
+		}
+		if response.status >= http.StatusInternalServerError {
+			h.idempotency.forget(key)
+		}
+		close(response.done)
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+	handle(rec, r)
+}
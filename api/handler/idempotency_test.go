@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/facts"
+)
+
+func TestHandlerAddRuleWithIdempotencyKey(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	body := `{"name":"TestRule","conditions":{"all":[{"fact":"temperature","operator":"greaterThan","value":30}]},"event":{"eventType":"alert"}}`
+	addRule := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/addRule", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		h.AddRule(rr, req)
+		return rr
+	}
+
+	// The retry gets the original response instead of a conflict
+	for i := 0; i < 2; i++ {
+		if rr := addRule("retry-1"); rr.Code != http.StatusCreated {
+			t.Errorf("Expected status code %d for attempt %d, got %d: %s", http.StatusCreated, i+1, rr.Code, rr.Body.String())
+		}
+	}
+	if len(e.ListRules()) != 1 {
+		t.Errorf("Expected the rule to be created once, got %d rules", len(e.ListRules()))
+	}
+
+	// A new key, or no key, applies the request again
+	if rr := addRule("retry-2"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a new key, got %d", http.StatusConflict, rr.Code)
+	}
+	if rr := addRule(""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d without a key, got %d", http.StatusConflict, rr.Code)
+	}
+
+	// Keys are scoped to the endpoint
+	req := httptest.NewRequest("GET", "/removeRule?name=TestRule", nil)
+	req.Header.Set(IdempotencyKeyHeader, "retry-1")
+	rr := httptest.NewRecorder()
+	h.RemoveRule(rr, req)
+	if rr.Code != http.StatusOK || len(e.ListRules()) != 0 {
+		t.Errorf("Expected the rule to be removed, got status %d and %d rules", rr.Code, len(e.ListRules()))
+	}
+}
+
+func TestHandlerIdempotencyKeyReusedForDifferentRequest(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	addRule := func(name string) *httptest.ResponseRecorder {
+		body := `{"name":"` + name + `","conditions":{"all":[{"fact":"temperature","operator":"greaterThan","value":30}]},"event":{"eventType":"alert"}}`
+		req := httptest.NewRequest("POST", "/addRule", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+		rr := httptest.NewRecorder()
+		h.AddRule(rr, req)
+		return rr
+	}
+
+	if rr := addRule("First"); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if rr := addRule("Second"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for a different body, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if len(e.ListRules()) != 1 {
+		t.Errorf("Expected only the first rule to be created, got %d rules", len(e.ListRules()))
+	}
+
+	// The first request can still be retried
+	if rr := addRule("First"); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status code %d for a retry, got %d", http.StatusCreated, rr.Code)
+	}
+}
+
+func TestHandlerIdempotencyKeyOfPanickingRequest(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	handled := 0
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		handled++
+		if handled == 1 {
+			panic("handler failed")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/addRule", strings.NewReader("{}"))
+		req.Header.Set(IdempotencyKeyHeader, "retry-1")
+		rr := httptest.NewRecorder()
+		h.idempotent(rr, req, handle)
+		return rr
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the panic to be passed on")
+			}
+		}()
+		request()
+	}()
+
+	// The panicking request is not remembered, so the retry is handled
+	if rr := request(); rr.Code != http.StatusCreated || handled != 2 {
+		t.Errorf("Expected the retry to be handled, got status code %d after %d calls", rr.Code, handled)
+	}
+}
+
+func TestIdempotencyCacheForgetsOldestKeys(t *testing.T) {
+	c := newIdempotencyCache()
+	for i := 0; i <= maxIdempotencyKeys; i++ {
+		c.start(fmt.Sprintf("key-%d", i), [32]byte{})
+	}
+
+	if _, first := c.start("key-0", [32]byte{}); !first {
+		t.Errorf("Expected the oldest key to be forgotten")
+	}
+	if _, first := c.start(fmt.Sprintf("key-%d", maxIdempotencyKeys), [32]byte{}); first {
+		t.Errorf("Expected the newest key to be remembered")
+	}
+
+	c.forget("key-2")
+	if _, first := c.start("key-2", [32]byte{}); !first {
+		t.Errorf("Expected a forgotten key to be handled again")
+	}
+}
@@ -0,0 +1,600 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 description of the HTTP API exposed by the server. The paths
+// match the routes registered in `cmd/server/main.go`, so it needs to be updated whenever a
+// route is added or changed.
+var openAPISpec = map[string]interface{}{
+	"openapi": "3.0.3",
+	"info": map[string]interface{}{
+		"title":       "Rulegopher API",
+		"description": "HTTP API for managing rules and evaluating facts against them.",
+		"version":     "1.0.0",
+	},
+	"paths": map[string]interface{}{
+		"/addRule": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Add a new rule",
+				"operationId": "addRule",
+				"parameters":  []interface{}{idempotencyKeyParameter()},
+				"requestBody": jsonRequestBody("#/components/schemas/Rule"),
+				"responses": map[string]interface{}{
+					"201": map[string]interface{}{"description": "Rule created"},
+					"400": map[string]interface{}{"description": "Invalid input, or a field that rules do not have when strict rule decoding is on"},
+					"409": map[string]interface{}{"description": "Rule already exists, or the engine already holds its maximum number of rules"},
+					"422": validationErrorResponse(),
+				},
+			},
+		},
+		"/validateRule": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Validate a rule without adding it",
+				"operationId": "validateRule",
+				"requestBody": jsonRequestBody("#/components/schemas/Rule"),
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Rule is valid", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"valid": map[string]interface{}{"type": "boolean"},
+						},
+					}),
+					"400": map[string]interface{}{"description": "Invalid input, or a field that rules do not have when strict rule decoding is on"},
+					"422": validationErrorResponse(),
+				},
+			},
+		},
+		"/removeRule": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Remove a rule by name",
+				"operationId": "removeRule",
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name":     "name",
+						"in":       "query",
+						"required": true,
+						"schema":   map[string]interface{}{"type": "string"},
+					},
+					idempotencyKeyParameter(),
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{"description": "Rule removed"},
+					"400": map[string]interface{}{"description": "Missing rule name"},
+					"422": map[string]interface{}{"description": "Idempotency key already used for a different request"},
+				},
+			},
+		},
+		"/evaluateFact": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Evaluate a fact against the rules",
+				"operationId": "evaluateFact",
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name":        NoContentOnEmptyHeader,
+						"in":          "header",
+						"required":    false,
+						"description": "Set to true to get a 204 response instead of an empty array when no events are triggered",
+						"schema":      map[string]interface{}{"type": "boolean"},
+					},
+					map[string]interface{}{
+						"name":        "groupBy",
+						"in":          "query",
+						"required":    false,
+						"description": "Set to eventType to get an object mapping each event type to its events instead of an array",
+						"schema":      map[string]interface{}{"type": "string", "enum": []string{"eventType"}},
+					},
+					map[string]interface{}{
+						"name":        "explainMissing",
+						"in":          "query",
+						"required":    false,
+						"description": "Set to true to get an object holding the events and, under missingFacts, the facts each evaluated rule referenced but the fact lacked",
+						"schema":      map[string]interface{}{"type": "boolean"},
+					},
+				},
+				"requestBody": jsonRequestBody("#/components/schemas/Fact"),
+				"responses": map[string]interface{}{
+					"200": withEvalDurationHeader(withCSVContent(jsonResponse("Events triggered by the fact, keyed by event type with groupBy=eventType, or with an Accept header of text/csv, the events as CSV with ruleName, eventType and customProperty columns", map[string]interface{}{
+						"oneOf": []interface{}{
+							map[string]interface{}{
+								"type":  "array",
+								"items": map[string]interface{}{"$ref": "#/components/schemas/Event"},
+							},
+							map[string]interface{}{
+								"type": "object",
+								"additionalProperties": map[string]interface{}{
+									"type":  "array",
+									"items": map[string]interface{}{"$ref": "#/components/schemas/Event"},
+								},
+							},
+							map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"events": map[string]interface{}{"description": "The events, keyed by event type with groupBy=eventType"},
+									"missingFacts": map[string]interface{}{
+										"type": "object",
+										"additionalProperties": map[string]interface{}{
+											"type":  "array",
+											"items": map[string]interface{}{"type": "string"},
+										},
+									},
+								},
+							},
+						},
+					}))),
+					"204": withEvalDurationHeader(map[string]interface{}{"description": "No events were triggered, and the X-No-Content-On-Empty header was true"}),
+					"400": map[string]interface{}{"description": "Invalid fact, groupBy or explainMissing, groupBy or explainMissing with an Accept header of text/csv, or, with the -richErrors flag, fact data the rules cannot evaluate"},
+					"500": map[string]interface{}{"description": "Error evaluating fact"},
+				},
+			},
+		},
+		"/match": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Evaluate a fact and return the names of the matched rules",
+				"operationId": "matchRules",
+				"requestBody": jsonRequestBody("#/components/schemas/Fact"),
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Names of the rules that matched the fact", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"rules": map[string]interface{}{
+								"type":  "array",
+								"items": map[string]interface{}{"type": "string"},
+							},
+						},
+					}),
+					"400": map[string]interface{}{"description": "Invalid fact"},
+					"500": map[string]interface{}{"description": "Error evaluating fact"},
+				},
+			},
+		},
+		"/tryRule": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Evaluate a fact against a rule without storing the rule",
+				"operationId": "tryRule",
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"rule": map[string]interface{}{"$ref": "#/components/schemas/Rule"},
+									"fact": map[string]interface{}{"$ref": "#/components/schemas/Fact"},
+								},
+							},
+						},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Result of evaluating the fact against the rule", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"matched": map[string]interface{}{"type": "boolean"},
+							"events": map[string]interface{}{
+								"type":  "array",
+								"items": map[string]interface{}{"$ref": "#/components/schemas/Event"},
+							},
+							"validationError": map[string]interface{}{"type": "string"},
+							"error":           map[string]interface{}{"type": "string"},
+						},
+					}),
+					"400": map[string]interface{}{"description": "Invalid input, or a field that rules do not have when strict rule decoding is on"},
+				},
+			},
+		},
+		"/rule": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get a rule by name",
+				"operationId": "getRule",
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name":     "name",
+						"in":       "query",
+						"required": true,
+						"schema":   map[string]interface{}{"type": "string"},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": jsonResponse("The rule and the time left before it expires", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"rule": map[string]interface{}{"$ref": "#/components/schemas/Rule"},
+							"ttlSeconds": map[string]interface{}{
+								"type":        "integer",
+								"description": "Seconds left before the rule expires, only present for rules with an expiry time",
+							},
+						},
+					}),
+					"400": map[string]interface{}{"description": "Missing rule name"},
+					"404": map[string]interface{}{"description": "Rule does not exist"},
+				},
+			},
+			"patch": map[string]interface{}{
+				"summary":     "Change the priority, enabled flag or event of a rule, keeping its other fields",
+				"operationId": "patchRule",
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name":     "name",
+						"in":       "query",
+						"required": true,
+						"schema":   map[string]interface{}{"type": "string"},
+					},
+					idempotencyKeyParameter(),
+				},
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"priority": map[string]interface{}{"type": "integer"},
+									"enabled":  map[string]interface{}{"type": "boolean"},
+									"event":    map[string]interface{}{"$ref": "#/components/schemas/Event"},
+								},
+							},
+						},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{"description": "Rule patched"},
+					"400": map[string]interface{}{"description": "Missing rule name or invalid input"},
+					"404": map[string]interface{}{"description": "Rule does not exist"},
+					"422": validationErrorResponse(),
+				},
+			},
+		},
+		"/rule/enable": map[string]interface{}{
+			"post": ruleToggleOperation("enableRule", "Enable a rule by name"),
+		},
+		"/rule/disable": map[string]interface{}{
+			"post": ruleToggleOperation("disableRule", "Disable a rule by name"),
+		},
+		"/stats": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get server statistics",
+				"operationId": "stats",
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Server statistics", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"inFlight": map[string]interface{}{
+								"type":        "integer",
+								"description": "Number of fact evaluations currently being handled",
+							},
+						},
+					}),
+				},
+			},
+		},
+		"/ruleStats": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get the number of times each rule has matched",
+				"operationId": "ruleStats",
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Match counts keyed by rule name, including rules that have never matched", map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": map[string]interface{}{"type": "integer"},
+					}),
+				},
+			},
+		},
+		"/debug/index": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get the rule index, for troubleshooting; only served with the -debug flag",
+				"operationId": "debugIndex",
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Names of the rules indexed under each fact name, in priority order", map[string]interface{}{
+						"type": "object",
+						"additionalProperties": map[string]interface{}{
+							"type":  "array",
+							"items": map[string]interface{}{"type": "string"},
+						},
+					}),
+					"404": map[string]interface{}{"description": "The debug endpoints are not enabled"},
+				},
+			},
+		},
+		"/summary": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get rule counts and the operators in use",
+				"operationId": "summary",
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Summary of the rules loaded in the engine", map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"ruleCount": map[string]interface{}{"type": "integer"},
+							"maxRules": map[string]interface{}{
+								"type":        "integer",
+								"description": "Maximum number of rules the engine holds, or 0 if there is no limit",
+							},
+							"enabledCount": map[string]interface{}{"type": "integer"},
+							"factCount": map[string]interface{}{
+								"type":        "integer",
+								"description": "Number of distinct facts referenced by the rules",
+							},
+							"operatorsUsed": map[string]interface{}{
+								"type":  "array",
+								"items": map[string]interface{}{"type": "string"},
+							},
+						},
+					}),
+				},
+			},
+		},
+		"/listRules": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "List all rules",
+				"operationId": "listRules",
+				"responses": map[string]interface{}{
+					"200": jsonResponse("Rules loaded in the engine", map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"$ref": "#/components/schemas/Rule"},
+					}),
+				},
+			},
+		},
+	},
+	"components": map[string]interface{}{
+		"schemas": map[string]interface{}{
+			"Rule": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"name", "conditions"},
+				"properties": map[string]interface{}{
+					"name":       map[string]interface{}{"type": "string"},
+					"priority":   map[string]interface{}{"type": "integer"},
+					"conditions": map[string]interface{}{"$ref": "#/components/schemas/Conditions"},
+					"event":      map[string]interface{}{"$ref": "#/components/schemas/Event"},
+					"events": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"$ref": "#/components/schemas/Event"},
+					},
+					"enabled": map[string]interface{}{"type": "boolean"},
+					"expiresAt": map[string]interface{}{
+						"type":        "string",
+						"format":      "date-time",
+						"description": "Time from which the rule no longer matches",
+					},
+					"conditionRefs": map[string]interface{}{
+						"type":        "array",
+						"description": "Names of shared condition fragments whose conditions must also hold",
+						"items":       map[string]interface{}{"type": "string"},
+					},
+					"schemaVersion": map[string]interface{}{
+						"type":        "integer",
+						"description": "Version of the rule format the rule was written in, at most 2",
+					},
+				},
+			},
+			"Conditions": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"all": conditionArray(),
+					"any": conditionArray(),
+				},
+			},
+			"Condition": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"fact": map[string]interface{}{
+						"type":        "string",
+						"description": "Fact key, or a JSON Pointer starting with / into nested objects and lists",
+					},
+					"operator": map[string]interface{}{"type": "string"},
+					"value":    map[string]interface{}{},
+					"all":      conditionArray(),
+					"any":      conditionArray(),
+					"optional": map[string]interface{}{"type": "boolean"},
+					"weight":   map[string]interface{}{"type": "number"},
+					"label":    map[string]interface{}{"type": "string"},
+					"aggregate": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"countWhere"},
+					},
+					"inner": map[string]interface{}{"$ref": "#/components/schemas/Condition"},
+					"tolerance": map[string]interface{}{
+						"type":        "integer",
+						"description": "Tolerance in nanoseconds when comparing timestamps",
+					},
+					"ignoreCase": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Ignore case when the comparison operators order strings",
+					},
+					"valueFact": map[string]interface{}{
+						"type":        "string",
+						"description": "For the in operator, a fact whose list value is used instead of value",
+					},
+					"facts": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Facts given instead of fact; the condition holds if the operator holds for any of them",
+					},
+					"trend": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"increasing", "decreasing", "stable"},
+					},
+					"window": map[string]interface{}{
+						"type":        "integer",
+						"minimum":     2,
+						"description": "Number of recent values compared by a trend condition",
+					},
+					"glob": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"any", "all"},
+						"description": "Makes fact a glob pattern matched against the fact keys; the condition holds if the operator holds for any or all matching facts",
+					},
+					"expr": map[string]interface{}{
+						"type":        "string",
+						"description": "Arithmetic expression over numeric facts, such as weight / (height * height) > 25, given instead of fact, operator and value",
+					},
+					"min": map[string]interface{}{
+						"type":        "number",
+						"description": "Lower bound of a range condition on a numeric fact, given instead of operator and value",
+					},
+					"max": map[string]interface{}{
+						"type":        "number",
+						"description": "Upper bound of a range condition on a numeric fact, given instead of operator and value",
+					},
+					"exclusiveMin": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Exclude min itself from the range",
+					},
+					"exclusiveMax": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Exclude max itself from the range",
+					},
+				},
+			},
+			"Event": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"eventType"},
+				"properties": map[string]interface{}{
+					"eventType":      map[string]interface{}{"type": "string"},
+					"customProperty": map[string]interface{}{},
+					"facts": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string"},
+					},
+					"values": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{},
+					},
+					"ruleName": map[string]interface{}{"type": "string"},
+					"id": map[string]interface{}{
+						"type":        "string",
+						"description": "Stable identifier of the match, set when the engine reports event IDs",
+					},
+					"labels": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string"},
+					},
+					"paths": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string"},
+					},
+					"includeFacts": map[string]interface{}{
+						"type":        "array",
+						"description": "Fact keys whose values are added to facts and values whenever the rule matches",
+						"items":       map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+			"Fact": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": true,
+			},
+		},
+	},
+}
+
+// jsonRequestBody returns a required JSON request body referencing the given schema.
+func jsonRequestBody(ref string) map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": ref},
+			},
+		},
+	}
+}
+
+// jsonResponse returns a response object with the given description and JSON schema.
+func jsonResponse(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schema,
+			},
+		},
+	}
+}
+
+// withCSVContent adds a `text/csv` representation to a response.
+func withCSVContent(response map[string]interface{}) map[string]interface{} {
+	content := response["content"].(map[string]interface{})
+	content[csvContentType] = map[string]interface{}{
+		"schema": map[string]interface{}{"type": "string"},
+	}
+	return response
+}
+
+// withEvalDurationHeader adds the X-Eval-Duration-Us header, carrying the evaluation time, to the
+// response.
+func withEvalDurationHeader(response map[string]interface{}) map[string]interface{} {
+	response["headers"] = map[string]interface{}{
+		EvalDurationHeader: map[string]interface{}{
+			"description": "Time the engine spent evaluating the fact, in microseconds",
+			"schema":      map[string]interface{}{"type": "integer"},
+		},
+	}
+	return response
+}
+
+// validationErrorResponse returns the 422 response listing the invalid fields of a rule.
+func validationErrorResponse() map[string]interface{} {
+	return jsonResponse("Rule failed validation", map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"errors": map[string]interface{}{
+				"type":                 "object",
+				"description":          "Maps the path of each invalid field to its problem",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+			},
+		},
+	})
+}
+
+// ruleToggleOperation returns the operation object for the rule enable and disable endpoints.
+func ruleToggleOperation(operationID, summary string) map[string]interface{} {
+	return map[string]interface{}{
+		"summary":     summary,
+		"operationId": operationID,
+		"parameters": []interface{}{
+			map[string]interface{}{
+				"name":     "name",
+				"in":       "query",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			},
+			idempotencyKeyParameter(),
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{"description": "Rule updated"},
+			"400": map[string]interface{}{"description": "Missing rule name"},
+			"404": map[string]interface{}{"description": "Rule does not exist"},
+			"422": map[string]interface{}{"description": "Idempotency key already used for a different request"},
+		},
+	}
+}
+
+// idempotencyKeyParameter returns the optional `Idempotency-Key` header parameter of the
+// mutating endpoints.
+func idempotencyKeyParameter() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        IdempotencyKeyHeader,
+		"in":          "header",
+		"required":    false,
+		"description": "Key identifying the request, so that retries with the same key get the response of the first request instead of being applied again. Reusing the key for a different request is rejected with a 422",
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+// conditionArray returns the schema for an array of nested conditions.
+func conditionArray() map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"$ref": "#/components/schemas/Condition"},
+	}
+}
+
+// OpenAPI is a method of the `Handler` struct. It serves the OpenAPI 3 document describing
+// the HTTP API.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openAPISpec)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/facts"
+)
+
+func TestOpenAPI(t *testing.T) {
+	e := engine.NewEngine()
+	fh := facts.NewFactHandler(e)
+	h := NewHandler(e, fh)
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	h.OpenAPI(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Failed to parse OpenAPI document: %v", err)
+	}
+
+	if spec["openapi"] != "3.0.3" {
+		t.Errorf("Expected openapi version '3.0.3', got %v", spec["openapi"])
+	}
+
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("OpenAPI document has no paths")
+	}
+	if _, ok := paths["/evaluateFact"]; !ok {
+		t.Errorf("OpenAPI document does not describe the /evaluateFact path")
+	}
+}
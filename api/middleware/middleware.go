@@ -7,13 +7,17 @@ import (
 )
 
 // LoggingMiddleware is a middleware that logs the HTTP method, URL, and the time it took
-// to process the request.
+// to process the request, followed by the request ID if RequestIDMiddleware has set one.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 
 		next.ServeHTTP(w, r)
 
+		if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+			log.Printf("%s %s %d us request_id=%s", r.Method, r.URL, time.Since(startTime).Microseconds(), requestID)
+			return
+		}
 		log.Printf("%s %s %d us", r.Method, r.URL, time.Since(startTime).Microseconds())
 	})
 }
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the correlation ID of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key under which the request ID is stored.
+type requestIDKey struct{}
+
+// RequestIDMiddleware is a middleware that gives every request a correlation ID. The ID is taken
+// from the `X-Request-ID` request header, or generated if the header is missing. It is stored in
+// the request context, where RequestIDFromContext can read it, and echoed in the response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID stored in the context by RequestIDMiddleware, or an
+// empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// newRequestID returns a random 128-bit ID encoded as hex.
+func newRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddlewareEchoesHeader(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+
+	var contextID string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextID = RequestIDFromContext(r.Context())
+	}))
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("Expected the request ID to be echoed, got %q", got)
+	}
+	if contextID != "abc-123" {
+		t.Errorf("Expected the request ID in the context, got %q", contextID)
+	}
+}
+
+func TestRequestIDMiddlewareGeneratesID(t *testing.T) {
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ids := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/test", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(RequestIDHeader)
+		if len(id) != 32 {
+			t.Errorf("Expected a generated 32 character ID, got %q", id)
+		}
+		ids[id] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected a new ID for each request, got %v", ids)
+	}
+}
+
+func TestLoggingMiddlewareIncludesRequestID(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+
+	var buf bytes.Buffer
+	writer := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(writer) })
+
+	handler := RequestIDMiddleware(LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	handler.ServeHTTP(rr, req)
+
+	if logOutput := buf.String(); !strings.Contains(logOutput, "request_id=abc-123") {
+		t.Errorf("Expected the request ID in the access log, got %v", logOutput)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+	"gopkg.in/yaml.v3"
+)
+
+// loadRules reads the rules from a file containing an array of rules, or from every such file
+// in a directory. Files ending in `.yaml` or `.yml` are decoded as YAML, and all other files as
+// JSON. With strict set, rules with fields that rules do not have are rejected.
+func loadRules(path string, strict bool) ([]rules.Rule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rules file: %w", err)
+	}
+	if info.IsDir() {
+		return loadRulesDir(path, strict)
+	}
+	return loadRulesFile(path, strict)
+}
+
+// loadRulesFile reads and decodes a JSON or YAML file containing an array of rules, upgrading
+// rules in earlier schema versions, and expands the environment variable references in their
+// condition values. With strict set, a field that rules do not have is an error naming the field.
+func loadRulesFile(path string, strict bool) ([]rules.Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rules file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// The rules only have JSON field names, so the YAML is converted to JSON first
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("failed to decode rules file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return nil, fmt.Errorf("failed to decode rules file %s: %w", path, err)
+		}
+	}
+
+	var rawRules []json.RawMessage
+	if err := json.Unmarshal(data, &rawRules); err != nil {
+		return nil, fmt.Errorf("failed to decode rules file %s: %w", path, err)
+	}
+
+	ruleList := make([]rules.Rule, len(rawRules))
+	for i, rawRule := range rawRules {
+		upgraded, err := rules.UpgradeRuleJSON(rawRule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upgrade rule %d in %s: %w", i, path, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(upgraded))
+		decoder.UseNumber()
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&ruleList[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode rules file %s: %w", path, err)
+		}
+		ruleList[i].ConvertNumbers()
+	}
+
+	for i := range ruleList {
+		if err := expandEnvInConditions(ruleList[i].Conditions.All); err != nil {
+			return nil, fmt.Errorf("failed to load rule %s from %s: %w", ruleList[i].Name, path, err)
+		}
+		if err := expandEnvInConditions(ruleList[i].Conditions.Any); err != nil {
+			return nil, fmt.Errorf("failed to load rule %s from %s: %w", ruleList[i].Name, path, err)
+		}
+	}
+
+	return ruleList, nil
+}
+
+// envReference matches a `${NAME}` reference to an environment variable.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvInConditions replaces the `${NAME}` references in the string values of the conditions,
+// including nested and inner ones, and in strings inside list values, with the values of the
+// environment variables. A string that a reference was expanded in and that then holds a number
+// becomes that number, so that thresholds can come from the environment. Strings without
+// references are left untouched, and a reference to a variable that is not set is an error.
+func expandEnvInConditions(conditions []rules.Condition) error {
+	for i := range conditions {
+		condition := &conditions[i]
+		value, err := expandEnvInValue(condition.Value)
+		if err != nil {
+			return err
+		}
+		condition.Value = value
+		if condition.Inner != nil {
+			inner := []rules.Condition{*condition.Inner}
+			if err := expandEnvInConditions(inner); err != nil {
+				return err
+			}
+			condition.Inner = &inner[0]
+		}
+		if err := expandEnvInConditions(condition.All); err != nil {
+			return err
+		}
+		if err := expandEnvInConditions(condition.Any); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnvInValue expands the environment variable references in a condition value, which is a
+// string or a list of values as decoded from JSON.
+func expandEnvInValue(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if !envReference.MatchString(value) {
+			return value, nil
+		}
+		var missing []string
+		expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+		}
+		if number, err := strconv.ParseFloat(strings.TrimSpace(expanded), 64); err == nil {
+			return number, nil
+		}
+		return expanded, nil
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, v := range value {
+			expanded, err := expandEnvInValue(v)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = expanded
+		}
+		return list, nil
+	}
+	return value, nil
+}
+
+// loadRulesDir reads the rules from every `.json`, `.yaml` and `.yml` file in a directory, in
+// file name order. Subdirectories and other files are ignored. Rules with the same name in
+// different files, or twice in one file, are reported together, naming the files involved.
+func loadRulesDir(dir string, strict bool) ([]rules.Rule, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules directory: %w", err)
+	}
+
+	var ruleList []rules.Rule
+	var collisions *multierror.Error
+	ruleFiles := make(map[string]string) // file in which each rule name was first seen
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		fileRules, err := loadRulesFile(path, strict)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range fileRules {
+			if firstFile, ok := ruleFiles[rule.Name]; ok {
+				collisions = multierror.Append(collisions, fmt.Errorf("rule %q is defined in both %s and %s", rule.Name, firstFile, path))
+				continue
+			}
+			ruleFiles[rule.Name] = path
+			ruleList = append(ruleList, rule)
+		}
+	}
+
+	if err := collisions.ErrorOrNil(); err != nil {
+		return nil, fmt.Errorf("duplicate rule names in %s: %w", dir, err)
+	}
+	return ruleList, nil
+}
+
+// loadRulesIntoEngine reads the rules from a rules file or directory and adds them to the engine.
+// With strict set, rules with fields that rules do not have are rejected.
+func loadRulesIntoEngine(e *engine.Engine, path string, strict bool) error {
+	ruleList, err := loadRules(path, strict)
+	if err != nil {
+		return err
+	}
+
+	if err := e.AddRules(ruleList); err != nil {
+		return fmt.Errorf("failed to add rules: %w", err)
+	}
+
+	return nil
+}
+
+// loadFacts reads and decodes a JSON file containing either a single fact object or an array
+// of fact objects.
+func loadFacts(path string) ([]rules.Fact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read facts file: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var factList []rules.Fact
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := decoder.Decode(&factList); err != nil {
+			return nil, fmt.Errorf("failed to decode facts file: %w", err)
+		}
+	} else {
+		var fact rules.Fact
+		if err := decoder.Decode(&fact); err != nil {
+			return nil, fmt.Errorf("failed to decode facts file: %w", err)
+		}
+		factList = append(factList, fact)
+	}
+
+	// Large integers are kept exact, as for the rules
+	for _, fact := range factList {
+		fact.ConvertNumbers()
+	}
+	return factList, nil
+}
+
+// runValidate implements the `validate` subcommand. It loads the rules file into a new engine,
+// which validates every rule, and returns a non-zero exit code if any rule is invalid. With the
+// `-strict` flag, fields that rules do not have, such as misspelled ones, are errors as well.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	strict := flags.Bool("strict", false, "reject fields that rules do not have")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: rulegopher validate [-strict] <rules.json>")
+		return 2
+	}
+	path := flags.Arg(0)
+
+	if err := loadRulesIntoEngine(engine.NewEngine(), path, *strict); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s: OK\n", path)
+	return 0
+}
+
+// runEval implements the `eval` subcommand. It loads the rules file into a new engine, evaluates
+// every fact in the facts file, and prints the resulting events as JSON.
+func runEval(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprintln(stderr, "usage: rulegopher eval <rules.json> <facts.json>")
+		return 2
+	}
+
+	rulesEngine := engine.NewEngine()
+	rulesEngine.ReportRuleName = true
+	if err := loadRulesIntoEngine(rulesEngine, args[0], false); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	factList, err := loadFacts(args[1])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	events := make([]rules.Event, 0)
+	for _, fact := range factList {
+		factEvents, err := rulesEngine.Evaluate(fact)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to evaluate fact %v: %v\n", fact, err)
+			return 1
+		}
+		events = append(events, factEvents...)
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(events); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// writeTestFile writes the given content to a file in a temporary directory and returns its path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return path
+}
+
+const validRulesJSON = `[
+	{
+		"name": "TestRule",
+		"priority": 1,
+		"conditions": {
+			"all": [
+				{"fact": "temperature", "operator": "greaterThan", "value": 30}
+			]
+		},
+		"event": {"eventType": "alert", "customProperty": "AC turned on"}
+	}
+]`
+
+func TestRunValidateWithValidRules(t *testing.T) {
+	path := writeTestFile(t, "rules.json", validRulesJSON)
+
+	var stdout, stderr bytes.Buffer
+	if code := runValidate([]string{path}, &stdout, &stderr); code != 0 {
+		t.Errorf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+}
+
+func TestRunValidateWithInvalidRules(t *testing.T) {
+	path := writeTestFile(t, "rules.json", `[
+		{
+			"name": "InvalidRule",
+			"conditions": {
+				"all": [
+					{"fact": "temperature", "operator": "invalidOperator", "value": 30}
+				]
+			},
+			"event": {"eventType": "alert"}
+		}
+	]`)
+
+	var stdout, stderr bytes.Buffer
+	if code := runValidate([]string{path}, &stdout, &stderr); code == 0 {
+		t.Errorf("Expected a non-zero exit code for an invalid rules file")
+	}
+	if stderr.Len() == 0 {
+		t.Errorf("Expected the validation error to be reported")
+	}
+}
+
+func TestRunValidateStrictRejectsUnknownFields(t *testing.T) {
+	path := writeTestFile(t, "rules.json", `[
+		{
+			"name": "MisspelledRule",
+			"priority": 1,
+			"conditions": {
+				"all": [
+					{"fact": "temperature", "operator": "greaterThan", "value": 30}
+				]
+			},
+			"event": {"eventType": "alert", "customProperyt": "AC turned on"}
+		}
+	]`)
+
+	var stdout, stderr bytes.Buffer
+	if code := runValidate([]string{path}, &stdout, &stderr); code != 0 {
+		t.Errorf("Expected exit code 0 without -strict, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	stderr.Reset()
+	if code := runValidate([]string{"-strict", path}, &stdout, &stderr); code == 0 {
+		t.Errorf("Expected a non-zero exit code with -strict")
+	}
+	if !strings.Contains(stderr.String(), `unknown field "customProperyt"`) {
+		t.Errorf("Expected the unknown field to be named, got %q", stderr.String())
+	}
+}
+
+func TestRunEval(t *testing.T) {
+	rulesPath := writeTestFile(t, "rules.json", validRulesJSON)
+	factsPath := writeTestFile(t, "facts.json", `[{"temperature": 35}, {"temperature": 20}]`)
+
+	var stdout, stderr bytes.Buffer
+	if code := runEval([]string{rulesPath, factsPath}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	var events []rules.Event
+	if err := json.Unmarshal(stdout.Bytes(), &events); err != nil {
+		t.Fatalf("Failed to decode events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "alert" {
+		t.Errorf("Expected a single alert event, got %v", events)
+	}
+}
+
+func TestLoadRulesFromDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"climate.json": validRulesJSON,
+		"security.yaml": `
+- name: DoorRule
+  conditions:
+    all:
+      - fact: doorOpen
+        operator: equal
+        value: true
+  event:
+    eventType: doorAlert
+`,
+		"notes.txt": "not rules",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	ruleList, err := loadRules(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	if len(ruleList) != 2 || ruleList[0].Name != "TestRule" || ruleList[1].Name != "DoorRule" {
+		t.Fatalf("Expected the rules of both files, got %v", ruleList)
+	}
+	if ruleList[1].Event.EventType != "doorAlert" || ruleList[1].Conditions.All[0].Value != true {
+		t.Errorf("Expected the YAML rule to be decoded with its JSON field names, got %+v", ruleList[1])
+	}
+
+	// A second file defining a rule that already exists is reported with both file names
+	duplicatePath := filepath.Join(dir, "overrides.json")
+	if err := os.WriteFile(duplicatePath, []byte(validRulesJSON), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	_, err = loadRules(dir, false)
+	if err == nil {
+		t.Fatalf("Expected an error for a duplicate rule name")
+	}
+	for _, expected := range []string{`"TestRule"`, filepath.Join(dir, "climate.json"), duplicatePath} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected the error to contain %s, got: %v", expected, err)
+		}
+	}
+}
+
+func TestLoadRulesExpandsEnvironmentVariables(t *testing.T) {
+	t.Setenv("RULEGOPHER_TEST_THRESHOLD", "30")
+	t.Setenv("RULEGOPHER_TEST_SITE", "north")
+
+	path := writeTestFile(t, "rules.json", `[
+		{
+			"name": "SiteTemperature",
+			"conditions": {
+				"all": [
+					{"fact": "temperature", "operator": "greaterThan", "value": "${RULEGOPHER_TEST_THRESHOLD}"},
+					{"fact": "site", "operator": "equal", "value": "site-${RULEGOPHER_TEST_SITE}"},
+					{"fact": "humidity", "operator": "between", "value": [10, "${RULEGOPHER_TEST_THRESHOLD}"]},
+					{"fact": "note", "operator": "equal", "value": "$RULEGOPHER_TEST_SITE"}
+				]
+			},
+			"event": {"eventType": "alert"}
+		}
+	]`)
+
+	rulesEngine := engine.NewEngine()
+	if err := loadRulesIntoEngine(rulesEngine, path, false); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	conditions := rulesEngine.Rules["SiteTemperature"].Conditions.All
+	if value, ok := conditions[0].Value.(float64); !ok || value != 30 {
+		t.Errorf("Expected the threshold to be expanded to the number 30, got %#v", conditions[0].Value)
+	}
+	if conditions[1].Value != "site-north" {
+		t.Errorf("Expected value site-north, got %#v", conditions[1].Value)
+	}
+	if !reflect.DeepEqual(conditions[2].Value, []interface{}{10.0, 30.0}) {
+		t.Errorf("Expected value [10 30], got %#v", conditions[2].Value)
+	}
+	if conditions[3].Value != "$RULEGOPHER_TEST_SITE" {
+		t.Errorf("Expected a value without braces to be untouched, got %#v", conditions[3].Value)
+	}
+
+	events, err := rulesEngine.Evaluate(rules.Fact{"temperature": 35, "site": "site-north", "humidity": 20, "note": "$RULEGOPHER_TEST_SITE"})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected 1 event, got %d", len(events))
+	}
+}
+
+func TestLoadRulesWithUnsetEnvironmentVariable(t *testing.T) {
+	path := writeTestFile(t, "rules.json", `[
+		{
+			"name": "Threshold",
+			"conditions": {"all": [{"fact": "temperature", "operator": "greaterThan", "value": "${RULEGOPHER_TEST_UNSET}"}]},
+			"event": {"eventType": "alert"}
+		}
+	]`)
+
+	_, err := loadRules(path, false)
+	if err == nil || !strings.Contains(err.Error(), "RULEGOPHER_TEST_UNSET") {
+		t.Errorf("Expected an error naming the unset variable, got %v", err)
+	}
+}
+
+func TestLoadRulesUpgradesFlatRules(t *testing.T) {
+	path := writeTestFile(t, "rules.json", `[
+		{
+			"name": "LegacyRule",
+			"logic": "any",
+			"conditions": [
+				{"fact": "temperature", "operator": "greaterThan", "value": 30},
+				{"fact": "humidity", "operator": "greaterThan", "value": 80}
+			],
+			"event": {"eventType": "alert"}
+		}
+	]`)
+
+	rulesEngine := engine.NewEngine()
+	rulesEngine.UnmatchedFactBehavior = "Ignore"
+	if err := loadRulesIntoEngine(rulesEngine, path, true); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	rule := rulesEngine.Rules["LegacyRule"]
+	if rule.SchemaVersion != rules.CurrentSchemaVersion || len(rule.Conditions.Any) != 2 {
+		t.Errorf("Expected the rule to be upgraded to two any conditions, got %+v", rule)
+	}
+	events, err := rulesEngine.Evaluate(rules.Fact{"humidity": 90})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected 1 event, got %d", len(events))
+	}
+}
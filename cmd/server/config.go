@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the server settings. It can be loaded from a JSON or YAML file with the
+// `-config` flag, and any flag given explicitly on the command line overrides the value from
+// the file.
+type Config struct {
+	Port                  string `json:"port" yaml:"port"`
+	Logging               bool   `json:"logging" yaml:"logging"`
+	Rules                 string `json:"rules" yaml:"rules"`
+	ReportFacts           bool   `json:"reportFacts" yaml:"reportFacts"`
+	ReportRuleName        bool   `json:"reportRuleName" yaml:"reportRuleName"`
+	ReportEventIDs        bool   `json:"reportEventIDs" yaml:"reportEventIDs"`
+	UnmatchedFactBehavior string `json:"unmatchedFactBehavior" yaml:"unmatchedFactBehavior"`
+	MaxRules              int    `json:"maxRules" yaml:"maxRules"`
+	StrictRules           bool   `json:"strictRules" yaml:"strictRules"`
+	Debug                 bool   `json:"debug" yaml:"debug"`
+	RichErrors            bool   `json:"richErrors" yaml:"richErrors"`
+}
+
+// defaultConfig returns the settings used when neither a config file nor a flag sets them.
+func defaultConfig() Config {
+	return Config{
+		Port:                  "8080",
+		Logging:               false,
+		Rules:                 "",
+		ReportFacts:           false,
+		ReportRuleName:        true,
+		ReportEventIDs:        false,
+		UnmatchedFactBehavior: "Ignore",
+		MaxRules:              0,
+		StrictRules:           false,
+		Debug:                 false,
+		RichErrors:            false,
+	}
+}
+
+// loadConfig reads a config file over the given base settings, so that settings missing from the
+// file keep their base values. Files ending in `.yaml` or `.yml` are decoded as YAML, and all
+// other files as JSON.
+func loadConfig(path string, base Config) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := base
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return base, fmt.Errorf("failed to decode config file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// parseServeFlags parses the `serve` command-line flags into a Config. If `-config` is given, the
+// file is loaded first and the flags that were set explicitly are applied on top of it.
+func parseServeFlags(args []string) (Config, error) {
+	defaults := defaultConfig()
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configFile := flags.String("config", "", "JSON or YAML file containing the server configuration")
+	port := flags.String("port", defaults.Port, "port to listen on")
+	logging := flags.Bool("logging", defaults.Logging, "enable or disable logging")
+	rulesFile := flags.String("rules", defaults.Rules, "JSON or YAML file containing the rules, or a directory of such files")
+	reportFacts := flags.Bool("reportFacts", defaults.ReportFacts, "whether to report the facts that caused the event to trigger")
+	reportRuleName := flags.Bool("reportRuleName", defaults.ReportRuleName, "whether to report the name of the rule that was triggered")
+	reportEventIDs := flags.Bool("reportEventIDs", defaults.ReportEventIDs, "whether to give events a stable ID for deduplication")
+	unmatchedFactBehavior := flags.String("unmatchedFactBehavior", defaults.UnmatchedFactBehavior, "behavior for unmatched facts: Ignore, Log, or Error")
+	maxRules := flags.Int("maxRules", defaults.MaxRules, "maximum number of rules the engine holds, or 0 for no limit")
+	strictRules := flags.Bool("strictRules", defaults.StrictRules, "reject rules, in the rules file or added through the API, with fields that rules do not have")
+	debug := flags.Bool("debug", defaults.Debug, "serve the /debug/ endpoints, such as /debug/index, that expose the engine's internals")
+	richErrors := flags.Bool("richErrors", defaults.RichErrors, "respond 400 with the specific message, instead of 500, when a fact cannot be evaluated because of its data")
+
+	if err := flags.Parse(args); err != nil {
+		return defaults, err
+	}
+
+	cfg := defaults
+	if *configFile != "" {
+		var err error
+		if cfg, err = loadConfig(*configFile, defaults); err != nil {
+			return defaults, err
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "logging":
+			cfg.Logging = *logging
+		case "rules":
+			cfg.Rules = *rulesFile
+		case "reportFacts":
+			cfg.ReportFacts = *reportFacts
+		case "reportRuleName":
+			cfg.ReportRuleName = *reportRuleName
+		case "reportEventIDs":
+			cfg.ReportEventIDs = *reportEventIDs
+		case "unmatchedFactBehavior":
+			cfg.UnmatchedFactBehavior = *unmatchedFactBehavior
+		case "maxRules":
+			cfg.MaxRules = *maxRules
+		case "strictRules":
+			cfg.StrictRules = *strictRules
+		case "debug":
+			cfg.Debug = *debug
+		case "richErrors":
+			cfg.RichErrors = *richErrors
+		}
+	})
+
+	return cfg, nil
+}
+
+// newEngine creates a rules engine with the given settings and loads the configured rules file
+// or directory into it.
+func newEngine(cfg Config) (*engine.Engine, error) {
+	rulesEngine := engine.NewEngine()
+	rulesEngine.ReportFacts = cfg.ReportFacts
+	rulesEngine.ReportRuleName = cfg.ReportRuleName
+	rulesEngine.ReportEventIDs = cfg.ReportEventIDs
+	rulesEngine.UnmatchedFactBehavior = cfg.UnmatchedFactBehavior
+	rulesEngine.MaxRules = cfg.MaxRules
+
+	if cfg.Rules != "" {
+		if err := loadRulesIntoEngine(rulesEngine, cfg.Rules, cfg.StrictRules); err != nil {
+			return nil, err
+		}
+	}
+
+	return rulesEngine, nil
+}
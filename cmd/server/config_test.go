@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseServeFlagsWithConfigFile(t *testing.T) {
+	rulesPath := writeTestFile(t, "rules.json", validRulesJSON)
+	configPath := writeTestFile(t, "config.yaml", `
+port: "9090"
+logging: true
+rules: `+rulesPath+`
+reportFacts: true
+reportRuleName: false
+unmatchedFactBehavior: Error
+`)
+
+	// The explicit -port flag overrides the value from the config file
+	cfg, err := parseServeFlags([]string{"-config", configPath, "-port", "7070"})
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if cfg.Port != "7070" {
+		t.Errorf("Expected port '7070', got '%s'", cfg.Port)
+	}
+	if !cfg.Logging {
+		t.Errorf("Expected logging to be enabled by the config file")
+	}
+
+	rulesEngine, err := newEngine(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	if !rulesEngine.ReportFacts {
+		t.Errorf("Expected ReportFacts to be true")
+	}
+	if rulesEngine.ReportRuleName {
+		t.Errorf("Expected ReportRuleName to be false")
+	}
+	if rulesEngine.UnmatchedFactBehavior != "Error" {
+		t.Errorf("Expected UnmatchedFactBehavior 'Error', got '%s'", rulesEngine.UnmatchedFactBehavior)
+	}
+	if len(rulesEngine.Rules) != 1 {
+		t.Errorf("Expected 1 rule to be loaded, got %d", len(rulesEngine.Rules))
+	}
+}
+
+func TestParseServeFlagsWithJSONConfigFile(t *testing.T) {
+	configPath := writeTestFile(t, "config.json", `{"port": "9090", "reportFacts": true}`)
+
+	cfg, err := parseServeFlags([]string{"-config", configPath})
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if cfg.Port != "9090" || !cfg.ReportFacts {
+		t.Errorf("Expected settings from the config file, got %+v", cfg)
+	}
+	// Settings missing from the file keep their defaults
+	if !cfg.ReportRuleName || cfg.UnmatchedFactBehavior != "Ignore" {
+		t.Errorf("Expected default settings for values missing from the config file, got %+v", cfg)
+	}
+}
@@ -1,84 +1,140 @@
 package main
 
 import (
-	"encoding/json"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/rgehrsitz/rulegopher/api/handler"
 	"github.com/rgehrsitz/rulegopher/api/middleware"
-	"github.com/rgehrsitz/rulegopher/pkg/engine"
 	"github.com/rgehrsitz/rulegopher/pkg/facts"
-	"github.com/rgehrsitz/rulegopher/pkg/rules"
 )
 
-func main() {
-
-	// The code block is using the `flag` package in Go to define and parse command-line
-	// flags.
-	port := flag.String("port", "8080", "port to listen on")
-	logging := flag.Bool("logging", false, "enable or disable logging")
-	rulesFile := flag.String("rules", "", "JSON file containing the rules")
-	reportFacts := flag.Bool("reportFacts", false, "whether to report the facts that caused the event to trigger")
-	reportRuleName := flag.Bool("reportRuleName", true, "whether to report the name of the rule that was triggered")
-	unmatchedFactBehavior := flag.String("unmatchedFactBehavior", "Ignore", "behavior for unmatched facts: Ignore, Log, or Error")
-
-	flag.Parse()
+// shutdownTimeout is how long the server waits for in-flight requests to finish when it is
+// asked to stop.
+const shutdownTimeout = 10 * time.Second
 
-	// This block of code is creating a new instance of the rules engine and fact handler.
-	rulesEngine := engine.NewEngine()
-	rulesEngine.ReportFacts = *reportFacts
-	rulesEngine.ReportRuleName = *reportRuleName
-	rulesEngine.UnmatchedFactBehavior = *unmatchedFactBehavior
-	factHandler := facts.NewFactHandler(rulesEngine)
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	// This block of code is responsible for reading and decoding the rules from a JSON file, and then
-	// adding those rules to the rules engine.
-	if *rulesFile != "" {
-		file, err := os.Open(*rulesFile)
-		if err != nil {
-			fmt.Println("Failed to open rules file:", err)
-			return
+// run dispatches the command-line arguments to the matching subcommand and returns the exit
+// code. When no subcommand is given, the server is started for backwards compatibility.
+func run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			return runServe(args[1:])
+		case "validate":
+			return runValidate(args[1:], os.Stdout, os.Stderr)
+		case "eval":
+			return runEval(args[1:], os.Stdout, os.Stderr)
 		}
-		defer file.Close()
+	}
+	return runServe(args)
+}
 
-		var rules []rules.Rule
-		if err := json.NewDecoder(file).Decode(&rules); err != nil {
-			fmt.Println("Failed to decode rules file:", err)
-			return
-		}
+// runServe starts the HTTP server using the given command-line flags.
+func runServe(args []string) int {
+	// The command-line flags, and the config file if one is given, are parsed into a `Config`.
+	cfg, err := parseServeFlags(args)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
 
-		for _, rule := range rules {
-			if err := rulesEngine.AddRule(rule); err != nil {
-				fmt.Println("Failed to add rule:", err)
-				return
-			}
-		}
+	// This block of code is creating a new instance of the rules engine, loading the rules into it,
+	// and creating the fact handler.
+	rulesEngine, err := newEngine(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return 1
 	}
+	factHandler := facts.NewFactHandler(rulesEngine)
 
 	// The line `apiHandler := handler.NewHandler(rulesEngine, factHandler)` is creating a new instance of
 	// the `Handler` struct from the `handler` package. It is passing the `rulesEngine` and `factHandler`
 	// as arguments to the `NewHandler` function, which initializes the `Handler` struct with these
 	// dependencies. This `apiHandler` instance will be used to handle incoming API requests.
 	apiHandler := handler.NewHandler(rulesEngine, factHandler)
+	apiHandler.StrictRuleDecoding = cfg.StrictRules
+	apiHandler.DebugEndpoints = cfg.Debug
+	apiHandler.RichErrors = cfg.RichErrors
 
 	// This block of code is responsible for setting up the HTTP handlers for different API endpoints based
 	// on the value of the `logging` flag.
-	if *logging {
+	if cfg.Logging {
 		http.Handle("/addRule", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.AddRule)))
 		http.Handle("/removeRule", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.RemoveRule)))
 		http.Handle("/evaluateFact", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.EvaluateFact)))
+		http.Handle("/match", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.MatchRules)))
+		http.Handle("/validateRule", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.ValidateRule)))
+		http.Handle("/tryRule", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.TryRule)))
+		http.Handle("/listRules", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.ListRules)))
+		http.Handle("/rule", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.Rule)))
+		http.Handle("/rule/enable", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.EnableRule)))
+		http.Handle("/rule/disable", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.DisableRule)))
+		http.Handle("/stats", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.Stats)))
+		http.Handle("/summary", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.Summary)))
+		http.Handle("/ruleStats", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.RuleStats)))
+		http.Handle("/openapi.json", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.OpenAPI)))
+		http.Handle("/debug/index", middleware.LoggingMiddleware(http.HandlerFunc(apiHandler.DebugIndex)))
 	} else {
 		http.Handle("/addRule", http.HandlerFunc(apiHandler.AddRule))
 		http.Handle("/removeRule", http.HandlerFunc(apiHandler.RemoveRule))
 		http.Handle("/evaluateFact", http.HandlerFunc(apiHandler.EvaluateFact))
+		http.Handle("/match", http.HandlerFunc(apiHandler.MatchRules))
+		http.Handle("/validateRule", http.HandlerFunc(apiHandler.ValidateRule))
+		http.Handle("/tryRule", http.HandlerFunc(apiHandler.TryRule))
+		http.Handle("/listRules", http.HandlerFunc(apiHandler.ListRules))
+		http.Handle("/rule", http.HandlerFunc(apiHandler.Rule))
+		http.Handle("/rule/enable", http.HandlerFunc(apiHandler.EnableRule))
+		http.Handle("/rule/disable", http.HandlerFunc(apiHandler.DisableRule))
+		http.Handle("/stats", http.HandlerFunc(apiHandler.Stats))
+		http.Handle("/summary", http.HandlerFunc(apiHandler.Summary))
+		http.Handle("/ruleStats", http.HandlerFunc(apiHandler.RuleStats))
+		http.Handle("/openapi.json", http.HandlerFunc(apiHandler.OpenAPI))
+		http.Handle("/debug/index", http.HandlerFunc(apiHandler.DebugIndex))
 	}
 
 	// This code block is responsible for starting the HTTP server and listening for incoming requests on
-	// the specified port.
-	fmt.Printf("Starting server on port %s\n", *port)
-	http.ListenAndServe(":"+*port, nil)
-	fmt.Println("Server started")
+	// the specified port. Every request is given a correlation ID by `RequestIDMiddleware`. On SIGINT or
+	// SIGTERM, the server stops accepting new requests and waits, up to `shutdownTimeout`, for in-flight
+	// requests and fact evaluations to finish.
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: middleware.RequestIDMiddleware(http.DefaultServeMux)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	fmt.Printf("Starting server on port %s\n", cfg.Port)
+	select {
+	case err := <-serverErr:
+		fmt.Println("Server stopped:", err)
+		return 1
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error shutting down server:", err)
+		return 1
+	}
+	if err := apiHandler.WaitForInFlight(shutdownCtx); err != nil {
+		fmt.Printf("Gave up waiting for %d in-flight evaluations: %v\n", apiHandler.InFlight(), err)
+		return 1
+	}
+	return 0
 }
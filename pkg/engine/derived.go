@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// derivedFact is a fact computed from the other facts of an evaluated fact.
+type derivedFact struct {
+	name   string
+	derive func(rules.Fact) (interface{}, error)
+	inputs []string // the facts the derivation reads, or nil if it did not declare them
+}
+
+// AddDerivedFact registers a fact that is computed from each evaluated fact before the rules are
+// evaluated, such as `bmi` from `weight` and `height`, so that rules can reference it like any
+// other fact. Derived facts are computed in the order they were registered, so a derivation sees
+// the facts derived before it, and a derived value replaces a value for the same key in the
+// evaluated fact. Registering a name again replaces its derivation.
+//
+// The inputs list the facts the derivation reads, which StrictFacts then accepts even if no rule
+// references them. StrictFacts does not reject any key while a derivation that declares no
+// inputs is registered, since it cannot tell which facts that derivation needs.
+//
+// A derivation that fails, or panics, leaves its fact missing and its error, a
+// *DerivedFactError, is returned alongside the results of the evaluation, or on its own with FailFast. Derivations may
+// be called concurrently and must not modify the fact they are given.
+func (e *Engine) AddDerivedFact(name string, fn func(rules.Fact) (interface{}, error), inputs ...string) {
+	e.mu.Lock()
+	defer e.unlock()
+
+	// The list is replaced rather than modified, since evaluations read it without the lock
+	var derivations []derivedFact
+	if current := e.derivedFacts.Load(); current != nil {
+		derivations = append(derivations, *current...)
+	}
+	replaced := false
+	for i := range derivations {
+		if derivations[i].name == name {
+			derivations[i].derive = fn
+			derivations[i].inputs = inputs
+			replaced = true
+		}
+	}
+	if !replaced {
+		derivations = append(derivations, derivedFact{name: name, derive: fn, inputs: inputs})
+	}
+	e.derivedFacts.Store(&derivations)
+}
+
+// derivationsRead reports whether the derivations may read the fact key: whether one of them
+// declares it as an input, normalized if NormalizeKeys is set, or declares no inputs at all.
+func (e *Engine) derivationsRead(key string) bool {
+	derivations := e.derivedFacts.Load()
+	if derivations == nil {
+		return false
+	}
+	for _, derivation := range *derivations {
+		if derivation.inputs == nil {
+			return true
+		}
+		for _, input := range derivation.inputs {
+			if e.NormalizeKeys {
+				input = normalizeKey(input)
+			}
+			if rules.FactRoot(input) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deriveFacts returns a copy of the fact with the derived facts added, or the fact itself if no
+// facts are derived. The errors of failed derivations are collected into a multierror, unless
+// FailFast is set, in which case the first one is returned straight away.
+func (e *Engine) deriveFacts(fact rules.Fact) (rules.Fact, error) {
+	derivations := e.derivedFacts.Load()
+	if derivations == nil || len(*derivations) == 0 {
+		return fact, nil
+	}
+
+	fact = rules.MergeFacts(fact)
+	var result *multierror.Error
+	for _, derivation := range *derivations {
+		name := derivation.name
+		if e.NormalizeKeys {
+			name = normalizeKey(name)
+		}
+		value, err := derivation.call(fact)
+		if err != nil {
+			err = &DerivedFactError{Fact: name, Err: err}
+			if e.FailFast {
+				return fact, err
+			}
+			result = multierror.Append(result, err)
+			continue
+		}
+		fact[name] = value
+	}
+	return fact, result.ErrorOrNil()
+}
+
+// call computes the derived fact, recovering a panic in the derivation and returning it as an
+// error, so that one bad derivation cannot crash a whole evaluation.
+func (d *derivedFact) call(fact rules.Fact) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("derivation panicked: %v", r)
+		}
+	}()
+	return d.derive(fact)
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func TestDerivedFactIsMatched(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportFacts = true
+	engine.AddDerivedFact("bmi", func(fact rules.Fact) (interface{}, error) {
+		weight, ok1 := fact["weight"].(float64)
+		height, ok2 := fact["height"].(float64)
+		if !ok1 || !ok2 || height == 0 {
+			return nil, fmt.Errorf("weight and height are required")
+		}
+		return weight / (height * height), nil
+	})
+
+	rule := rules.Rule{
+		Name:       "Overweight",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "bmi", Operator: "greaterThanOrEqual", Value: 25}}},
+		Event:      rules.Event{EventType: "overweight"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// The rule is indexed under bmi, which the evaluated fact only has once it is derived
+	fact := rules.Fact{"weight": 90.0, "height": 1.8}
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "overweight" || events[0].Facts[0] != "bmi" {
+		t.Fatalf("Expected the overweight event triggered by bmi, got %v", events)
+	}
+	if _, ok := fact["bmi"]; ok {
+		t.Errorf("Expected the evaluated fact not to be modified")
+	}
+
+	events, err = engine.Evaluate(rules.Fact{"weight": 60.0, "height": 1.8})
+	if err != nil || len(events) != 0 {
+		t.Errorf("Expected no events and no error for a lower bmi, got %v, %v", events, err)
+	}
+
+	// A failed derivation leaves the fact missing and reports the error
+	events, err = engine.Evaluate(rules.Fact{"weight": 90.0})
+	var derivedErr *DerivedFactError
+	if !errors.As(err, &derivedErr) || derivedErr.Fact != "bmi" {
+		t.Errorf("Expected a DerivedFactError for bmi, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events, got %v", events)
+	}
+}
+
+func TestDerivedFactsSeeEarlierDerivations(t *testing.T) {
+	engine := NewEngine()
+	engine.AddDerivedFact("area", func(fact rules.Fact) (interface{}, error) {
+		return fact["width"].(float64) * fact["length"].(float64), nil
+	})
+	engine.AddDerivedFact("large", func(fact rules.Fact) (interface{}, error) {
+		return fact["area"].(float64) > 100, nil
+	})
+
+	rule := rules.Rule{
+		Name:       "LargeRoom",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "large", Operator: "equal", Value: true}}},
+		Event:      rules.Event{EventType: "large"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"width": 10.0, "length": 12.0})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected the large event, got %v", events)
+	}
+}
+
+func TestDerivedFactPanicIsRecovered(t *testing.T) {
+	engine := NewEngine()
+	engine.UnmatchedFactBehavior = "Ignore"
+	engine.AddDerivedFact("ratio", func(fact rules.Fact) (interface{}, error) {
+		return fact["numerator"].(float64) / fact["denominator"].(float64), nil
+	})
+
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// The derivation panics on the missing numerator, but the rules are still evaluated
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35})
+	var derivedErr *DerivedFactError
+	if !errors.As(err, &derivedErr) || derivedErr.Fact != "ratio" || !errors.Is(err, ErrDerivedFactFailed) {
+		t.Fatalf("Expected a DerivedFactError for ratio, got %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "hot" {
+		t.Errorf("Expected the hot event, got %v", events)
+	}
+}
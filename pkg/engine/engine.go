@@ -2,69 +2,415 @@ package engine
 
 import (
 	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime/debug"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/rgehrsitz/rulegopher/pkg/rules"
+	"github.com/rgehrsitz/rulegopher/pkg/store"
 )
 
 // Engine represents a rule engine.
+//
+// Evaluation reads the rule index through an immutable snapshot held in an atomic pointer, so
+// concurrent evaluations never contend for the engine lock. Mutations made through the engine's
+// methods build a new snapshot and publish it before they return. `Rules` and `RuleIndex` are
+// exported for inspection: evaluations do not read them, so code that adds, replaces or removes
+// rules in `Rules` directly must call RebuildIndex afterwards for evaluations to see the change.
+//
+// `Rules` holds every rule, keyed by its name, while `RuleIndex` only holds the enabled ones. The
+// index points at the rules stored in `Rules`, so there is a single copy of each rule. The engine
+// never modifies a stored rule: every change to a rule made through the engine stores a new copy
+// and indexes it in place of the old one, which evaluations still running may keep reading.
 type Engine struct {
-	Rules                 map[string]rules.Rule
+	Rules                 map[string]*rules.Rule
 	RuleIndex             map[string][]*rules.Rule
 	mu                    sync.RWMutex
 	ReportFacts           bool
 	ReportRuleName        bool
 	UnmatchedFactBehavior string
+	// MaxEvents, if greater than zero, is the number of events an evaluation returns at most.
+	// The rules are then evaluated in priority order, lowest number first and then by name, and
+	// the evaluation stops once the cap is reached, so the events kept are those of the
+	// highest-priority matches, in that order.
+	MaxEvents int
+	// MaxRules, if greater than zero, is the number of rules the engine holds at most. Adding a
+	// rule once it is reached returns a TooManyRulesError.
+	MaxRules int
+	// FailFast makes an evaluation stop at the first rule that fails with an error, and return
+	// that error and no events. By default the evaluation carries on, and returns the events of
+	// the rules that matched together with the errors of the others, collected in a multierror.
+	// The state of stateful rules evaluated before the error is still updated.
+	FailFast bool
+	// Now returns the current time used to expire rules and to time the matches of stateful
+	// rules. It defaults to time.Now; tests can replace it with a clock they control.
+	Now func() time.Time
+	// SampleRate, if between 0 and 1, makes evaluations emit each event of a matched rule with
+	// that probability and drop the others, for load testing downstream consumers with a fraction
+	// of the events. Rules still match, and their state and match counts are still updated, as
+	// without sampling. 0, the default, and 1 or more emit every event.
+	SampleRate float64
+	// Random returns the random numbers in [0, 1) that SampleRate is compared with. It defaults to
+	// rand.Float64; tests can replace it with a seeded source. It may be called concurrently.
+	Random func() float64
+	// ConditionFragments holds named lists of conditions that rules can share by listing their
+	// names in ConditionRefs. The references are expanded when a rule is added, updated, tried,
+	// validated or loaded from the store, so the engine, and its Store, only hold expanded rules;
+	// changing a fragment later does not change the rules that already use it.
+	ConditionFragments map[string][]rules.Condition
+	// FactResolver, if set, is called with the key of each fact that an evaluated rule
+	// references but the evaluated fact lacks, to fetch it on demand, for example from a cache
+	// or a database. It returns false if it cannot supply the fact, which is then handled by
+	// UnmatchedFactBehavior. Each key is resolved at most once per evaluation. Only rules indexed
+	// under a fact that is present are evaluated, so a rule is never evaluated for resolved facts
+	// alone. The resolver may be called concurrently and must not modify the engine.
+	FactResolver func(key string) (interface{}, bool)
+	// NormalizeKeys trims and lowercases fact keys, both in incoming facts, including the keys
+	// of the objects nested in them, and in the fact references of rules, including those of
+	// inner conditions, expressions and IncludeFacts, before matching. It must be set before rules are added, since rule
+	// fact references are normalized when the rule is added or updated.
+	NormalizeKeys bool
+	// NormalizeRuleNames makes rule names that only differ by leading or trailing whitespace
+	// collide, so that adding one when the other exists returns a RuleAlreadyExistsError. Rules
+	// are still stored under the name they were given, and GetRule, UpdateRule, PatchRule,
+	// RemoveRule, EnableRule and DisableRule find a rule by any name that collides with it.
+	NormalizeRuleNames bool
+	// FoldRuleNameCase, together with NormalizeRuleNames, also makes rule names that only differ
+	// by case collide.
+	FoldRuleNameCase bool
+	// StrictFacts makes evaluations reject facts with keys that no rule in the engine reads,
+	// whether as a fact, a valueFact or in an expression, or lists in the IncludeFacts of its
+	// events, that no glob condition matches and that no derived fact declares as an input,
+	// with an UnexpectedFactsError and no events, rather than ignoring the extraneous keys.
+	// Disabled rules count as well. TryRule, which evaluates a rule that is not in the engine,
+	// does not check the keys.
+	StrictFacts bool
+	// DefaultFacts supplies values for facts that are missing from an evaluated fact, so that
+	// rules such as "assume status=active unless told otherwise" can match. Keys present in the
+	// evaluated fact take precedence over the defaults.
+	DefaultFacts rules.Fact
+	// ReportPaths adds the paths of the conditions that caused a match, such as `any[1].all[0]`,
+	// to the events of the matched rules.
+	ReportPaths bool
+	// ReportEventIDs sets the ID of each emitted event to a stable hash of its rule name, event
+	// type and triggering facts and values, so that downstream systems can deduplicate identical
+	// matches. The triggering facts are reported along with the IDs, as if ReportFacts were set.
+	ReportEventIDs bool
+	// Store, if set, persists the rules. Every rule added, updated, removed, enabled or disabled
+	// through the engine is written through to the store before the in-memory rules change, and
+	// the change is abandoned if the store returns an error. Use LoadFromStore to load the stored
+	// rules when the engine starts.
+	Store      store.RuleStore
+	ruleStates map[string]*ruleState
+	// trendHistory holds the recent values of the trend facts of each rule, keyed by rule name
+	// and then fact name
+	trendHistory map[string]map[string][]interface{}
+	// matchCounts holds the number of times each rule has matched, keyed by rule name
+	matchCounts map[string]uint64
+	// allowedOperators, if not nil, is the set of operators that rules may use. It is replaced
+	// as a whole by AllowedOperators, since rules are validated without the lock.
+	allowedOperators atomic.Pointer[map[string]bool]
+	stateMu          sync.Mutex
+	snapshot         atomic.Pointer[snapshot]
+	indexChanged     bool                          // whether the rule index changed since the snapshot was published
+	derivedFacts     atomic.Pointer[[]derivedFact] // replaced as a whole by AddDerivedFact
 }
 
 // NewEngine returns a new instance of the Engine struct with initialized maps.
 func NewEngine() *Engine {
 	return &Engine{
-		Rules:                 make(map[string]rules.Rule),
+		Rules:                 make(map[string]*rules.Rule),
 		RuleIndex:             make(map[string][]*rules.Rule),
 		ReportFacts:           false,
 		ReportRuleName:        false,
 		UnmatchedFactBehavior: "Ignore",
+		MaxEvents:             0,
+		NormalizeKeys:         false,
+		ruleStates:            make(map[string]*ruleState),
+		trendHistory:          make(map[string]map[string][]interface{}),
+		matchCounts:           make(map[string]uint64),
+		Now:                   time.Now,
+		Random:                rand.Float64,
+	}
+}
+
+// now returns the current time according to the engine's clock, or time.Now if it has none.
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
 	}
+	return time.Now()
 }
 
 // AddRule adds a rule to the Engine.
 //
 // It takes a rule of type rules.Rule as a parameter and returns an error.
 func (e *Engine) AddRule(rule rules.Rule) error {
+	rule, err := rule.ExpandConditionRefs(e.ConditionFragments)
+	if err != nil {
+		return err
+	}
 	if err := e.validateRule(rule); err != nil {
 		return err
 	}
 
+	e.mu.Lock()
+	defer e.unlock()
+
 	if e.ruleExists(rule.Name) {
 		return &RuleAlreadyExistsError{RuleName: rule.Name}
 	}
 
-	e.addRuleToEngine(rule)
-	e.addToIndex(&rule)
+	if e.MaxRules > 0 && len(e.Rules) >= e.MaxRules {
+		return &TooManyRulesError{RuleName: rule.Name, MaxRules: e.MaxRules}
+	}
+
+	if e.NormalizeKeys {
+		rule = normalizeRuleFacts(rule)
+	}
+
+	if e.Store != nil {
+		if err := e.Store.Put(rule); err != nil {
+			return err
+		}
+	}
+
+	e.insertRule(rule)
+
+	return nil
+}
+
+// AddRules adds several rules at once, such as the rules of a rules file. Every rule is
+// validated, and checked against the rules in the engine and the others in the list, before any
+// is added, so either all of the rules are added or none are, and the problems of every rule are
+// returned together. Rather than inserting each rule into the index in priority order, which is
+// slow for many rules, the rules are appended to the index and each affected list is sorted once.
+func (e *Engine) AddRules(ruleList []rules.Rule) error {
+	var result *multierror.Error
+	expanded := make([]rules.Rule, 0, len(ruleList))
+	for _, rule := range ruleList {
+		rule, err := rule.ExpandConditionRefs(e.ConditionFragments)
+		if err == nil {
+			err = e.validateRule(rule)
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+		expanded = append(expanded, rule)
+	}
+
+	e.mu.Lock()
+	defer e.unlock()
+
+	added := make(map[string]bool, len(expanded))
+	for _, rule := range expanded {
+		name := e.normalizeRuleName(rule.Name)
+		if added[name] || e.ruleExists(rule.Name) {
+			result = multierror.Append(result, &RuleAlreadyExistsError{RuleName: rule.Name})
+		}
+		added[name] = true
+	}
+	if e.MaxRules > 0 && len(e.Rules)+len(ruleList) > e.MaxRules {
+		name := ruleList[max(e.MaxRules-len(e.Rules), 0)].Name
+		result = multierror.Append(result, &TooManyRulesError{RuleName: name, MaxRules: e.MaxRules})
+	}
+	if err := result.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	if e.NormalizeKeys {
+		for i := range expanded {
+			expanded[i] = normalizeRuleFacts(expanded[i])
+		}
+	}
+
+	if e.Store != nil {
+		for _, rule := range expanded {
+			if err := e.Store.Put(rule); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.insertRules(expanded)
 
 	return nil
 }
 
+// LoadFromStore adds every rule in the engine's store to the engine, without writing them back
+// to the store. Rules that are invalid or already in the engine are skipped, and the problems
+// found are returned as a single error.
+func (e *Engine) LoadFromStore() error {
+	if e.Store == nil {
+		return nil
+	}
+
+	storedRules, err := e.Store.List()
+	if err != nil {
+		return err
+	}
+
+	var result *multierror.Error
+	var validRules []rules.Rule
+	for _, rule := range storedRules {
+		rule, err := rule.ExpandConditionRefs(e.ConditionFragments)
+		if err == nil {
+			err = e.validateRule(rule)
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+		validRules = append(validRules, rule)
+	}
+
+	e.mu.Lock()
+	defer e.unlock()
+
+	loaded := make([]rules.Rule, 0, len(validRules))
+	loadedNames := make(map[string]bool, len(validRules))
+	for _, rule := range validRules {
+		name := e.normalizeRuleName(rule.Name)
+		if loadedNames[name] || e.ruleExists(rule.Name) {
+			result = multierror.Append(result, &RuleAlreadyExistsError{RuleName: rule.Name})
+			continue
+		}
+		loadedNames[name] = true
+		if e.NormalizeKeys {
+			rule = normalizeRuleFacts(rule)
+		}
+		loaded = append(loaded, rule)
+	}
+	e.insertRules(loaded)
+
+	return result.ErrorOrNil()
+}
+
+// ValidateRule validates a rule without adding it to the engine, returning every problem found
+// as a single error.
+func (e *Engine) ValidateRule(rule rules.Rule) error {
+	rule, err := rule.ExpandConditionRefs(e.ConditionFragments)
+	if err != nil {
+		return err
+	}
+	return e.validateRule(rule)
+}
+
+// TryRule validates a rule and evaluates the fact against it without adding the rule to the
+// engine. It reports whether the rule matched, along with the events it would generate, using
+// the engine's reporting and unmatched fact settings. Like EvaluateAll, it does not record the
+// values of trend facts: its trend conditions see the values recorded for the rule in the engine
+// with the same name, if any, followed by this fact's.
+func (e *Engine) TryRule(rule rules.Rule, fact rules.Fact) (bool, []rules.Event, error) {
+	rule, err := rule.ExpandConditionRefs(e.ConditionFragments)
+	if err != nil {
+		return false, nil, err
+	}
+	if err := e.validateRule(rule); err != nil {
+		return false, nil, err
+	}
+
+	if e.NormalizeKeys {
+		rule = normalizeRuleFacts(rule)
+	}
+	fact, err = e.prepareFact(fact)
+	if err != nil {
+		return false, nil, err
+	}
+	ruleCopy, satisfied, err := e.evaluateRule(&rule, e.newFactResolution(fact), false)
+	if err != nil || !satisfied {
+		return false, nil, err
+	}
+
+	return true, e.buildEvents([]rules.Rule{ruleCopy}), nil
+}
+
+// AllowedOperators restricts the operators that rules added to the engine may use. Rules using
+// any other operator, including in nested and aggregate conditions, fail validation. Calling it
+// with no operators allows every operator again, which is the default. It should be called
+// before rules are added, since rules already in the engine are not checked again.
+func (e *Engine) AllowedOperators(ops ...string) {
+	e.mu.Lock()
+	defer e.unlock()
+
+	if len(ops) == 0 {
+		e.allowedOperators.Store(nil)
+		return
+	}
+
+	allowed := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		allowed[op] = true
+	}
+	e.allowedOperators.Store(&allowed)
+}
+
+// checkOperators returns a validation error for each condition of the rule that uses an operator
+// that is not allowed.
+func (e *Engine) checkOperators(rule rules.Rule) error {
+	allowed := e.allowedOperators.Load()
+	if allowed == nil {
+		return nil
+	}
+
+	var result *multierror.Error
+	result = checkConditionOperators(result, *allowed, rule.Conditions.All, "conditions.all")
+	result = checkConditionOperators(result, *allowed, rule.Conditions.Any, "conditions.any")
+	return result.ErrorOrNil()
+}
+
+// checkConditionOperators appends a validation error to result for each condition in the list,
+// including nested ones, that uses an operator that is not in the allowed set.
+func checkConditionOperators(result *multierror.Error, allowed map[string]bool, conditions []rules.Condition, path string) *multierror.Error {
+	for i, condition := range conditions {
+		conditionPath := fmt.Sprintf("%s[%d]", path, i)
+		if condition.Operator != "" && !allowed[condition.Operator] {
+			result = multierror.Append(result, &rules.ValidationError{
+				Path:    conditionPath + ".operator",
+				Message: fmt.Sprintf("operator %s is not allowed", condition.Operator),
+			})
+		}
+		if condition.Inner != nil {
+			result = checkConditionOperators(result, allowed, []rules.Condition{*condition.Inner}, conditionPath+".inner")
+		}
+		result = checkConditionOperators(result, allowed, condition.All, conditionPath+".all")
+		result = checkConditionOperators(result, allowed, condition.Any, conditionPath+".any")
+	}
+	return result
+}
+
 // validateRule validates a rule in the Engine.
 //
-// It takes a rule as a parameter and checks if the rule name is empty.
-// If the rule name is empty, it returns an error message.
-// It also checks if the rule conditions are nil.
-// If the rule conditions are nil, it returns an error message.
-// Finally, it calls the Validate method of the rule and returns its result.
+// It takes a rule as a parameter and checks if the rule name is empty and if the rule conditions
+// are nil. It then calls the Validate method of the rule, which checks the rule name and every
+// condition, and returns all of the problems found as a single error.
 func (e *Engine) validateRule(rule rules.Rule) error {
+	var result *multierror.Error
+
 	if rule.Name == "" {
-		return fmt.Errorf("rule name cannot be empty")
+		result = multierror.Append(result, &EmptyRuleNameError{})
 	}
 
 	if rule.Conditions.All == nil && rule.Conditions.Any == nil {
-		return fmt.Errorf("rule conditions cannot be nil for rule: %s", rule.Name)
+		result = multierror.Append(result, &NilRuleConditionsError{RuleName: rule.Name})
+	}
+
+	if err := rule.Validate(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if err := e.checkOperators(rule); err != nil {
+		result = multierror.Append(result, err)
 	}
 
-	return rule.Validate()
+	return result.ErrorOrNil()
 }
 
 // ruleExists checks if a rule with the given name exists in the engine.
@@ -75,34 +421,138 @@ func (e *Engine) validateRule(rule rules.Rule) error {
 // Returns:
 // - bool: true if the rule exists, false otherwise.
 func (e *Engine) ruleExists(ruleName string) bool {
-	_, exists := e.Rules[ruleName]
+	_, exists := e.lookupRuleName(ruleName)
 	return exists
 }
 
+// lookupRuleName returns the name under which the rule with the given name is stored, which
+// differs from it when NormalizeRuleNames is set and the names only collide once normalized.
+// The second return value is false if there is no such rule. The caller must hold the engine
+// lock.
+func (e *Engine) lookupRuleName(ruleName string) (string, bool) {
+	if _, exists := e.Rules[ruleName]; exists {
+		return ruleName, true
+	}
+	if !e.NormalizeRuleNames {
+		return "", false
+	}
+
+	normalizedName := e.normalizeRuleName(ruleName)
+	for name := range e.Rules {
+		if e.normalizeRuleName(name) == normalizedName {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// normalizeRuleName returns the form of a rule name used to check for collisions, which is the
+// name itself unless NormalizeRuleNames is set.
+func (e *Engine) normalizeRuleName(ruleName string) string {
+	if !e.NormalizeRuleNames {
+		return ruleName
+	}
+	ruleName = strings.TrimSpace(ruleName)
+	if e.FoldRuleNameCase {
+		ruleName = strings.ToLower(ruleName)
+	}
+	return ruleName
+}
+
 // addRuleToEngine adds a rule to the Engine.
 //
-// It takes in a rule of type rules.Rule as a parameter and does not return anything.
-func (e *Engine) addRuleToEngine(rule rules.Rule) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+// It takes in a pointer to the rule to store, which must not be modified afterwards, and does not
+// return anything. The caller must hold the engine lock.
+func (e *Engine) addRuleToEngine(rule *rules.Rule) {
 	e.Rules[rule.Name] = rule
 }
 
-// addToIndex adds a rule to the rule index.
+// insertRule stores a copy of a rule in the engine under its name and indexes that same copy,
+// replacing the rule with that name and its index entries, if there was one. Every rule added or
+// changed goes through it, so the index always points at the rules the map holds. The rule is
+// passed by value so that the stored copy is owned by this call, rather than a loop variable
+// shared by every rule in a loop. The caller must hold the engine lock.
+func (e *Engine) insertRule(rule rules.Rule) {
+	if _, exists := e.Rules[rule.Name]; exists {
+		e.removeFromIndex(rule.Name)
+	}
+	e.addRuleToEngine(&rule)
+	e.addToIndex(&rule)
+}
+
+// insertRules stores rules that are not in the engine yet and indexes copies of them, like
+// insertRule, but builds the index by appending every rule and then sorting each list it
+// appended to once, instead of inserting each rule in priority order. The stable sort keeps rules
+// with the same priority in the order they were given, as insertRule would. The caller must hold
+// the engine lock.
+func (e *Engine) insertRules(ruleList []rules.Rule) {
+	stored := make([]rules.Rule, len(ruleList))
+	copy(stored, ruleList)
+
+	appended := make(map[string]bool)
+	for i := range stored {
+		rule := &stored[i]
+		e.addRuleToEngine(rule)
+		if !rule.IsEnabled() {
+			continue
+		}
+		factNames := make(map[string]bool)
+		collectFactNames(rule.Conditions.All, factNames)
+		collectFactNames(rule.Conditions.Any, factNames)
+		for factName := range factNames {
+			e.RuleIndex[factName] = append(e.RuleIndex[factName], rule)
+			appended[factName] = true
+		}
+	}
+
+	for factName := range appended {
+		matchingRules := e.RuleIndex[factName]
+		sort.SliceStable(matchingRules, func(i, j int) bool {
+			return matchingRules[i].Priority < matchingRules[j].Priority
+		})
+	}
+	e.markIndexChanged()
+}
+
+// addToIndex adds a rule to the rule index. The rule is indexed once under each distinct fact
+// referenced by its conditions, including nested ones. Disabled rules are left out of the index,
+// so that they cost evaluations nothing; enabling a rule indexes it again.
 func (e *Engine) addToIndex(rule *rules.Rule) {
-	e.processConditions(rule.Conditions.All, rule)
-	e.processConditions(rule.Conditions.Any, rule)
+	if !rule.IsEnabled() {
+		e.markIndexChanged()
+		return
+	}
+	factNames := make(map[string]bool)
+	collectFactNames(rule.Conditions.All, factNames)
+	collectFactNames(rule.Conditions.Any, factNames)
+	for factName := range factNames {
+		e.insertRuleIntoIndex(factName, rule)
+	}
+	e.markIndexChanged()
 }
 
-// processConditions processes conditions for indexing.
-func (e *Engine) processConditions(conditions []rules.Condition, rule *rules.Rule) {
+// collectFactNames adds the names of the facts referenced by the conditions, including nested
+// ones, and by their expressions, to the factNames set. A JSON Pointer reference adds the
+// top-level fact it reads, and a glob condition adds its pattern, which evaluations match
+// against the fact keys.
+func collectFactNames(conditions []rules.Condition, factNames map[string]bool) {
 	for _, condition := range conditions {
-		e.insertRuleIntoIndex(condition.Fact, rule)
+		if condition.Glob != "" {
+			factNames[condition.Fact] = true
+		} else if condition.Fact != "" {
+			factNames[rules.FactRoot(condition.Fact)] = true
+		}
+		for _, factName := range condition.Facts {
+			factNames[rules.FactRoot(factName)] = true
+		}
+		for _, factName := range condition.ExprFacts() {
+			factNames[factName] = true
+		}
 		if len(condition.All) > 0 {
-			e.processConditions(condition.All, rule)
+			collectFactNames(condition.All, factNames)
 		}
 		if len(condition.Any) > 0 {
-			e.processConditions(condition.Any, rule)
+			collectFactNames(condition.Any, factNames)
 		}
 	}
 }
@@ -125,87 +575,892 @@ func (e *Engine) insertRuleIntoIndex(fact string, rule *rules.Rule) {
 // RemoveRule removes a rule from the rule engine.
 func (e *Engine) RemoveRule(ruleName string) error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	defer e.unlock()
 
 	// Check if the rule exists
-	if _, exists := e.Rules[ruleName]; !exists {
+	storedName, exists := e.lookupRuleName(ruleName)
+	if !exists {
 		return &RuleDoesNotExistError{RuleName: ruleName}
 	}
+	ruleName = storedName
+
+	if e.Store != nil {
+		if err := e.Store.Delete(ruleName); err != nil {
+			return err
+		}
+	}
 
 	delete(e.Rules, ruleName)
 	e.removeFromIndex(ruleName)
+	e.resetRuleState(ruleName)
+	e.forgetMatchCount(ruleName)
 
 	return nil
 }
 
-// removeFromIndex removes a rule from the rule index.
+// RemoveExpiredRules removes every rule whose expiry time has passed, and returns the sorted
+// names of the removed rules. Expired rules never match, so calling it periodically only frees
+// the memory, and store entries, they hold.
+func (e *Engine) RemoveExpiredRules() ([]string, error) {
+	e.mu.Lock()
+	defer e.unlock()
+
+	now := e.now()
+	var removed []string
+	for name, rule := range e.Rules {
+		if rule.IsExpired(now) {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	for i, name := range removed {
+		if e.Store != nil {
+			if err := e.Store.Delete(name); err != nil {
+				return removed[:i], err
+			}
+		}
+		delete(e.Rules, name)
+		e.removeFromIndex(name)
+		e.resetRuleState(name)
+		e.forgetMatchCount(name)
+	}
+
+	return removed, nil
+}
+
+// RebuildIndex rebuilds `RuleIndex` from the rules in `Rules` and publishes a new snapshot of
+// it, so that evaluations see the changes made directly to `Rules`. Rules changed through the
+// engine's methods are indexed when they are changed, and need no rebuild.
+func (e *Engine) RebuildIndex() {
+	e.mu.Lock()
+	defer e.unlock()
+
+	e.RuleIndex = make(map[string][]*rules.Rule)
+	for _, rule := range e.Rules {
+		e.addToIndex(rule)
+	}
+	e.markIndexChanged()
+}
+
+// removeFromIndex removes every entry for a rule from the rule index, and removes any fact
+// entries that are left without rules.
 func (e *Engine) removeFromIndex(ruleName string) {
 	for factName, matchingRules := range e.RuleIndex {
-		for ruleIndex, r := range matchingRules {
-			if r.Name == ruleName {
-				e.RuleIndex[factName] = append(matchingRules[:ruleIndex], matchingRules[ruleIndex+1:]...)
-				break
+		remainingRules := matchingRules[:0]
+		for _, r := range matchingRules {
+			if r.Name != ruleName {
+				remainingRules = append(remainingRules, r)
 			}
 		}
+		if len(remainingRules) == 0 {
+			delete(e.RuleIndex, factName)
+			continue
+		}
+		// Clear the tail so that the removed rules can be garbage collected
+		for i := len(remainingRules); i < len(matchingRules); i++ {
+			matchingRules[i] = nil
+		}
+		e.RuleIndex[factName] = remainingRules
 	}
+	e.markIndexChanged()
 }
 
-// Evaluate evaluates the input fact against the rules.
+// Evaluate evaluates the input fact against the rules. The events are ordered by the priority
+// of their rules, lowest number first, and then by rule name; the events of a rule that defines
+// several keep their order.
 func (e *Engine) Evaluate(inputFact rules.Fact) ([]rules.Event, error) {
-	generatedEvents := make([]rules.Event, 0)
-	evaluatedRules := make(map[string]bool) // Keep track of evaluated rules
+	matchedRules, err := e.evaluateRules(inputFact, nil, nil, nil)
+	return e.sampleEvents(e.buildEvents(matchedRules)), err
+}
 
-	var matchingRules []*rules.Rule
+// EvaluateWithOverrides evaluates the input fact like Evaluate, but orders the events as if the
+// rules named in priorityOverrides had the given priorities, such as to boost some rules during
+// an incident. The overrides only apply to this call; the rules themselves are not modified.
+// With MaxEvents set, the overridden priorities also decide which matches are kept.
+func (e *Engine) EvaluateWithOverrides(inputFact rules.Fact, priorityOverrides map[string]int) ([]rules.Event, error) {
+	matchedRules, err := e.evaluateRules(inputFact, nil, priorityOverrides, nil)
+	return e.sampleEvents(e.buildEvents(matchedRules)), err
+}
+
+// EvaluateInPriorityRange evaluates the input fact against only the rules whose priority is
+// between min and max, inclusive, such as a band of high-priority rules being rolled out. Rules
+// outside the range are not evaluated at all, so the state of stateful ones is left unchanged.
+// The events are ordered as for Evaluate.
+func (e *Engine) EvaluateInPriorityRange(inputFact rules.Fact, min, max int) ([]rules.Event, error) {
+	matchedRules, err := e.evaluateRules(inputFact, func(rule *rules.Rule) bool {
+		return rule.Priority >= min && rule.Priority <= max
+	}, nil, nil)
+	return e.sampleEvents(e.buildEvents(matchedRules)), err
+}
+
+// EvaluateDelta evaluates the current fact against only the rules that reference fact keys
+// whose values changed since the previous fact, including keys that were added or removed. It is
+// meant for streams of updates to the same entity, where only a few keys change between
+// evaluations. Rules that only reference unchanged keys are not evaluated, so they produce no
+// events even if they match.
+func (e *Engine) EvaluateDelta(prev, current rules.Fact) ([]rules.Event, error) {
+	if err := e.checkFactKeys(current); err != nil {
+		return nil, err
+	}
+	// Errors deriving the facts of the previous fact were reported when it was evaluated
+	prev, _ = e.prepareFact(prev)
+	current, derivationErr := e.prepareFact(current)
+	if derivationErr != nil && e.FailFast {
+		return nil, derivationErr
+	}
+
+	var changedFacts []string
+	for factName, value := range current {
+		if prevValue, ok := prev[factName]; !ok || !reflect.DeepEqual(prevValue, value) {
+			changedFacts = append(changedFacts, factName)
+		}
+	}
+	for factName := range prev {
+		if _, ok := current[factName]; !ok {
+			changedFacts = append(changedFacts, factName)
+		}
+	}
+
+	matchedRules, err := e.evaluateRulesForFacts(current, changedFacts, nil, nil, nil)
+	return e.sampleEvents(e.buildEvents(matchedRules)), joinDerivationError(derivationErr, err)
+}
+
+// setMatchedPaths sets the paths of the conditions that caused the rule to match on each of its
+// events. The rule's `Events` slice is replaced rather than modified, since the rule is a copy
+// that shares it with the rule stored in the engine.
+func setMatchedPaths(rule *rules.Rule, paths []string) {
+	rule.Event.Paths = paths
+	if len(rule.Events) > 0 {
+		events := make([]rules.Event, len(rule.Events))
+		for i, event := range rule.Events {
+			event.Paths = paths
+			events[i] = event
+		}
+		rule.Events = events
+	}
+}
+
+// reportFacts reports whether evaluated rules should report their triggering facts, which event
+// IDs are computed from.
+func (e *Engine) reportFacts() bool {
+	return e.ReportFacts || e.ReportEventIDs
+}
+
+// buildEvents returns the events of the matched rules. A rule that defines several events
+// contributes all of them, in order, but no more events are returned than MaxEvents, so the
+// last matched rule may only contribute its first events.
+func (e *Engine) buildEvents(matchedRules []rules.Rule) []rules.Event {
+	generatedEvents := make([]rules.Event, 0, len(matchedRules))
+	for _, rule := range matchedRules {
+		for _, event := range rule.AllEvents() {
+			if e.ReportRuleName { // Check if the ReportRuleName option is enabled
+				event.RuleName = rule.Name // Set the RuleName field here
+			}
+			if e.ReportEventIDs {
+				event.ID = event.StableID(rule.Name)
+			}
+			generatedEvents = append(generatedEvents, event)
+		}
+	}
+	if e.MaxEvents > 0 && len(generatedEvents) > e.MaxEvents {
+		generatedEvents = generatedEvents[:e.MaxEvents]
+	}
+	return generatedEvents
+}
+
+// sampleEvents returns the events that are kept when sampling them at the engine's SampleRate,
+// in their order. The events are returned unchanged if the engine does not sample them.
+func (e *Engine) sampleEvents(events []rules.Event) []rules.Event {
+	if e.SampleRate <= 0 || e.SampleRate >= 1 {
+		return events
+	}
+	random := e.Random
+	if random == nil {
+		random = rand.Float64
+	}
+	sampled := events[:0]
+	for _, event := range events {
+		if random() < e.SampleRate {
+			sampled = append(sampled, event)
+		}
+	}
+	return sampled
+}
+
+// MatchedRuleNames evaluates the input fact against the rules and returns the names of the
+// rules that matched, without building the events.
+func (e *Engine) MatchedRuleNames(inputFact rules.Fact) ([]string, error) {
+	matchedRules, err := e.evaluateRules(inputFact, nil, nil, nil)
+
+	ruleNames := make([]string, 0, len(matchedRules))
+	for _, rule := range matchedRules {
+		ruleNames = append(ruleNames, rule.Name)
+	}
+
+	return ruleNames, err
+}
+
+// EvaluateAll evaluates the input fact against every rule in the engine, not only the rules
+// indexed under its facts, and returns whether each rule matched, keyed by rule name. Disabled
+// and expired rules are reported as not matching. It does not update the state of stateful rules, so their
+// result only reflects whether their conditions hold for this fact, nor record the values of
+// trend facts, whose conditions see the recorded values followed by this fact's. Errors from individual rules,
+// including the RulePanicError of a rule that panics, are collected into a multierror, and those
+// rules are reported as not matching.
+func (e *Engine) EvaluateAll(inputFact rules.Fact) (map[string]bool, error) {
+	if err := e.checkFactKeys(inputFact); err != nil {
+		return nil, err
+	}
+	inputFact, derivationErr := e.prepareFact(inputFact)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var errs *multierror.Error
+	if derivationErr != nil {
+		errs = multierror.Append(errs, derivationErr)
+	}
+	results := make(map[string]bool, len(e.Rules))
+	now := e.now()
+	resolution := e.newFactResolution(inputFact)
+	for name, rule := range e.Rules {
+		if !rule.IsEnabled() || rule.IsExpired(now) {
+			results[name] = false
+			continue
+		}
+		_, satisfied, err := e.evaluateRule(rule, resolution, false)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		results[name] = satisfied && err == nil
+	}
+
+	return results, errs.ErrorOrNil()
+}
+
+// RunTests evaluates the fact of each test case against the rules, and returns a failure for
+// every case whose fact did not match exactly its expected rules. The rules are evaluated with
+// EvaluateAll, so running the tests does not change the state of stateful rules.
+func (e *Engine) RunTests(cases []rules.TestCase) []rules.TestFailure {
+	var failures []rules.TestFailure
+	for _, testCase := range cases {
+		results, err := e.EvaluateAll(testCase.Fact)
+
+		matched := make([]string, 0)
+		for name, satisfied := range results {
+			if satisfied {
+				matched = append(matched, name)
+			}
+		}
+		sort.Strings(matched)
+
+		expected := make(map[string]bool, len(testCase.ExpectedRules))
+		failure := rules.TestFailure{Case: testCase, MatchedRules: matched, Err: err}
+		for _, name := range testCase.ExpectedRules {
+			expected[name] = true
+			if !results[name] {
+				failure.MissingRules = append(failure.MissingRules, name)
+			}
+		}
+		for _, name := range matched {
+			if !expected[name] {
+				failure.UnexpectedRules = append(failure.UnexpectedRules, name)
+			}
+		}
+
+		if err != nil || len(failure.MissingRules) > 0 || len(failure.UnexpectedRules) > 0 {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// evaluateRules evaluates the input fact against the rules indexed under its facts, and returns
+// evaluated copies of the rules that matched, in evaluation order. Errors from individual rules
+// are collected into a multierror and do not stop the evaluation of the remaining rules. If
+// include is not nil, only the rules it returns true for are evaluated. The rules named in
+// priorities are ordered by the priorities given there instead of their own. If missing is not
+// nil, the fact references that each evaluated rule's fact lacked are added to it.
+func (e *Engine) evaluateRules(inputFact rules.Fact, include func(*rules.Rule) bool, priorities map[string]int, missing map[string][]string) ([]rules.Rule, error) {
+	if err := e.checkFactKeys(inputFact); err != nil {
+		return nil, err
+	}
+	inputFact, derivationErr := e.prepareFact(inputFact)
+	if derivationErr != nil && e.FailFast {
+		return nil, derivationErr
+	}
 
+	factNames := make([]string, 0, len(inputFact))
 	for factName := range inputFact {
-		e.mu.RLock()
-		if rules, ok := e.RuleIndex[factName]; ok {
-			matchingRules = append(matchingRules, rules...)
+		factNames = append(factNames, factName)
+	}
+
+	matchedRules, err := e.evaluateRulesForFacts(inputFact, factNames, include, priorities, missing)
+	return matchedRules, joinDerivationError(derivationErr, err)
+}
+
+// joinDerivationError adds the error of deriving the facts of an evaluated fact to the error of
+// evaluating the rules against it. The evaluation error is returned unchanged when the facts
+// were derived without error.
+func joinDerivationError(derivationErr, err error) error {
+	if derivationErr == nil {
+		return err
+	}
+	return multierror.Append(derivationErr, err)
+}
+
+// evaluateRulesForFacts evaluates the input fact against the rules indexed under the given fact
+// names, and returns evaluated copies of the rules that matched, in evaluation order.
+func (e *Engine) evaluateRulesForFacts(inputFact rules.Fact, factNames []string, include func(*rules.Rule) bool, priorities map[string]int, missing map[string][]string) ([]rules.Rule, error) {
+	matchedRules := make([]rules.Rule, 0)
+	var evaluatedRules map[string]bool // Keep track of evaluated rules
+
+	var matchingRules []*rules.Rule
+
+	snapshot := e.loadSnapshot()
+	factNames = snapshot.withGlobs(factNames)
+	if len(factNames) == 1 {
+		// Fast path: a single index entry lists each rule once, so its rules can be evaluated
+		// straight from the snapshot without gathering them or tracking which were evaluated.
+		matchingRules = snapshot.ruleIndex[factNames[0]]
+	} else {
+		evaluatedRules = make(map[string]bool)
+		for _, factName := range factNames {
+			if rules, ok := snapshot.ruleIndex[factName]; ok {
+				matchingRules = append(matchingRules, rules...)
+			}
+		}
+	}
+
+	// When the number of events is capped, evaluate the rules in priority order so
+	// that the highest-priority matches are the ones that are kept.
+	if e.MaxEvents > 0 {
+		if evaluatedRules == nil {
+			// The snapshot must not be modified
+			matchingRules = append([]*rules.Rule(nil), matchingRules...)
 		}
-		e.mu.RUnlock()
+		sort.SliceStable(matchingRules, func(i, j int) bool {
+			return rulePrecedes(matchingRules[i], matchingRules[j], priorities)
+		})
 	}
 
 	var result *multierror.Error
+	now := e.now()
+	resolution := e.newFactResolution(inputFact)
+	resolution.missing = missing
+	eventCount := 0 // the events of the matched rules, which MaxEvents caps
 	for _, rule := range matchingRules {
+		if e.MaxEvents > 0 && eventCount >= e.MaxEvents {
+			break
+		}
+		if !rule.IsEnabled() || rule.IsExpired(now) || (include != nil && !include(rule)) {
+			continue
+		}
 		if _, alreadyEvaluated := evaluatedRules[rule.Name]; !alreadyEvaluated {
-			// Create a copy of the rule before evaluating it
-			ruleCopy := *rule
-			satisfied, err := ruleCopy.Evaluate(inputFact, e.ReportFacts, e.UnmatchedFactBehavior)
+			ruleCopy, satisfied, err := e.evaluateRule(rule, resolution, true)
 			if err != nil {
+				if e.FailFast {
+					return nil, err
+				}
 				result = multierror.Append(result, err)
 				continue
 			}
+			if rule.IsStateful() {
+				satisfied = e.updateRuleState(rule, satisfied)
+			}
 			if satisfied {
-				if e.ReportRuleName { // Check if the ReportRuleName option is enabled
-					ruleCopy.Event.RuleName = ruleCopy.Name // Set the RuleName field here
+				matchedRules = append(matchedRules, ruleCopy)
+				if e.MaxEvents > 0 {
+					eventCount += len(ruleCopy.AllEvents())
 				}
-				generatedEvents = append(generatedEvents, ruleCopy.Event)
 			}
-			evaluatedRules[rule.Name] = true
+			if evaluatedRules != nil {
+				evaluatedRules[rule.Name] = true
+			}
+		}
+	}
+
+	e.countMatches(matchedRules)
+
+	// The rules are gathered from the index in fact-map iteration order, so sort the matches to
+	// make the order of the events reproducible.
+	sort.SliceStable(matchedRules, func(i, j int) bool {
+		return rulePrecedes(&matchedRules[i], &matchedRules[j], priorities)
+	})
+
+	return matchedRules, result.ErrorOrNil()
+}
+
+// evaluateRule evaluates a copy of the rule against the fact resolved for it, and returns the
+// copy, with its matched paths set if ReportPaths is set and the rule is satisfied. The values of
+// its trend facts are recorded if record is set, and only read otherwise. A panic while
+// evaluating the rule, such as in the FactResolver or on a malformed value, is recovered and
+// returned as a RulePanicError, so that one bad rule cannot crash a whole evaluation.
+func (e *Engine) evaluateRule(rule *rules.Rule, resolution *factResolution, record bool) (ruleCopy rules.Rule, satisfied bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			satisfied = false
+			err = &RulePanicError{RuleName: rule.Name, Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	fact := resolution.factFor(rule)
+	ruleCopy = *rule
+	if windows := rule.TrendWindows(); windows != nil {
+		ruleCopy = ruleCopy.WithTrendSeries(e.trendSeries(rule.Name, windows, fact, record))
+	}
+	var paths []string
+	if e.ReportPaths {
+		satisfied, paths, err = ruleCopy.EvaluatePaths(fact, e.reportFacts(), e.UnmatchedFactBehavior)
+	} else {
+		satisfied, err = ruleCopy.Evaluate(fact, e.reportFacts(), e.UnmatchedFactBehavior)
+	}
+	if err != nil {
+		return ruleCopy, false, err
+	}
+	if satisfied && e.ReportPaths {
+		setMatchedPaths(&ruleCopy, paths)
+	}
+	return ruleCopy, satisfied, nil
+}
+
+// prepareFact returns the fact as it is evaluated: with its keys normalized if NormalizeKeys is
+// set, merged over the DefaultFacts, and with the derived facts added. The fact passed in is not
+// modified. The error holds the failed derivations, whose facts are left missing.
+func (e *Engine) prepareFact(fact rules.Fact) (rules.Fact, error) {
+	if e.NormalizeKeys {
+		fact = normalizeFactKeys(fact)
+	}
+	if len(e.DefaultFacts) > 0 {
+		defaults := e.DefaultFacts
+		if e.NormalizeKeys {
+			defaults = normalizeFactKeys(defaults)
+		}
+		fact = rules.MergeFacts(defaults, fact)
+	}
+	return e.deriveFacts(fact)
+}
+
+// checkFactKeys returns an UnexpectedFactsError listing the sorted keys of the fact, normalized
+// if NormalizeKeys is set, that StrictFacts does not accept, if it is set: keys that no rule
+// reads or includes in its events, that no glob pattern matches and that no derivation reads.
+// The keys the rules accept are kept in the snapshot, so the check takes no lock.
+func (e *Engine) checkFactKeys(fact rules.Fact) error {
+	if !e.StrictFacts {
+		return nil
+	}
+
+	snapshot := e.loadSnapshot()
+	var unexpected []string
+	for key := range fact {
+		if e.NormalizeKeys {
+			key = normalizeKey(key)
+		}
+		if snapshot.factKeys[key] || e.derivationsRead(key) {
+			continue
+		}
+		matched := false
+		for _, pattern := range snapshot.keyGlobs {
+			if rules.MatchesGlob(pattern, key) {
+				matched = true
+				break
+			}
 		}
+		if !matched {
+			unexpected = append(unexpected, key)
+		}
+	}
+	if len(unexpected) == 0 {
+		return nil
 	}
+	sort.Strings(unexpected)
+	return &UnexpectedFactsError{Keys: unexpected}
+}
 
-	return generatedEvents, result.ErrorOrNil()
+// rulePrecedes reports whether rule a comes before rule b in evaluation results: rules are
+// ordered by priority, lowest number first, and then by name. The rules named in priorities are
+// ordered by the priority given there instead of their own.
+func rulePrecedes(a, b *rules.Rule, priorities map[string]int) bool {
+	aPriority, bPriority := a.Priority, b.Priority
+	if priority, ok := priorities[a.Name]; ok {
+		aPriority = priority
+	}
+	if priority, ok := priorities[b.Name]; ok {
+		bPriority = priority
+	}
+	if aPriority != bPriority {
+		return aPriority < bPriority
+	}
+	return a.Name < b.Name
 }
 
-// UpdateRule updates an existing rule in the rule engine.
+// UpdateRule updates an existing rule in the rule engine. A new rule with a different name
+// replaces the existing one under its new name, and fails with a RuleAlreadyExistsError if that
+// name is taken by another rule.
 func (e *Engine) UpdateRule(ruleName string, newRule rules.Rule) error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	defer e.unlock()
 
-	// Validate the new rule before updating
-	if err := newRule.Validate(); err != nil {
+	// Expand and validate the new rule before updating
+	newRule, err := newRule.ExpandConditionRefs(e.ConditionFragments)
+	if err != nil || newRule.Validate() != nil || e.checkOperators(newRule) != nil {
 		return &InvalidRuleError{RuleName: newRule.Name}
 	}
 
 	// Check if the rule exists
-	if _, exists := e.Rules[ruleName]; !exists {
+	storedName, exists := e.lookupRuleName(ruleName)
+	if !exists {
 		return &RuleDoesNotExistError{RuleName: ruleName}
 	}
+	ruleName = storedName
+	renamed := newRule.Name != ruleName
+	if renamed && e.normalizeRuleName(newRule.Name) != e.normalizeRuleName(ruleName) && e.ruleExists(newRule.Name) {
+		return &RuleAlreadyExistsError{RuleName: newRule.Name}
+	}
 
-	e.removeFromIndex(ruleName)
-	e.Rules[ruleName] = newRule
-	e.addToIndex(&newRule)
+	if e.NormalizeKeys {
+		newRule = normalizeRuleFacts(newRule)
+	}
+
+	if e.Store != nil {
+		if err := e.Store.Put(newRule); err != nil {
+			return err
+		}
+		if renamed {
+			if err := e.Store.Delete(ruleName); err != nil {
+				return err
+			}
+		}
+	}
+
+	if renamed {
+		delete(e.Rules, ruleName)
+		e.removeFromIndex(ruleName)
+		e.forgetMatchCount(ruleName)
+	}
+	e.resetRuleState(ruleName)
+	e.insertRule(newRule)
 
 	return nil
 }
+
+// RulePatch holds the changes that PatchRule applies to a rule. Fields left nil keep the rule's
+// current value; the event, when given, replaces the rule's event as a whole.
+type RulePatch struct {
+	Priority *int         `json:"priority,omitempty"`
+	Enabled  *bool        `json:"enabled,omitempty"`
+	Event    *rules.Event `json:"event,omitempty"`
+}
+
+// PatchRule applies the non-nil fields of the patch to an existing rule, leaving its other
+// fields, such as its conditions, unchanged. The patched rule is validated, written through to
+// the store and re-indexed. Unlike UpdateRule, it keeps the state of a stateful rule, since its
+// conditions do not change.
+func (e *Engine) PatchRule(ruleName string, patch RulePatch) error {
+	e.mu.Lock()
+	defer e.unlock()
+
+	storedName, exists := e.lookupRuleName(ruleName)
+	if !exists {
+		return &RuleDoesNotExistError{RuleName: ruleName}
+	}
+	rule := e.Rules[storedName].Clone()
+	if patch.Priority != nil {
+		rule.Priority = *patch.Priority
+	}
+	if patch.Enabled != nil {
+		enabled := *patch.Enabled
+		rule.Enabled = &enabled
+	}
+	if patch.Event != nil {
+		rule.Event = *patch.Event
+	}
+
+	if err := e.validateRule(rule); err != nil {
+		return err
+	}
+
+	if e.Store != nil {
+		if err := e.Store.Put(rule); err != nil {
+			return err
+		}
+	}
+
+	e.insertRule(rule)
+
+	return nil
+}
+
+// EnableRule enables a rule so that it is evaluated again.
+func (e *Engine) EnableRule(ruleName string) error {
+	return e.setRuleEnabled(ruleName, true)
+}
+
+// DisableRule disables a rule so that it is skipped during evaluation without being removed
+// from the engine.
+func (e *Engine) DisableRule(ruleName string) error {
+	return e.setRuleEnabled(ruleName, false)
+}
+
+// setRuleEnabled sets the `Enabled` flag of an existing rule and re-indexes it.
+func (e *Engine) setRuleEnabled(ruleName string, enabled bool) error {
+	e.mu.Lock()
+	defer e.unlock()
+
+	storedName, exists := e.lookupRuleName(ruleName)
+	if !exists {
+		return &RuleDoesNotExistError{RuleName: ruleName}
+	}
+	// The stored rule may still be read by evaluations, so a copy is changed and stored instead
+	rule := *e.Rules[storedName]
+	rule.Enabled = &enabled
+	if e.Store != nil {
+		if err := e.Store.Put(rule); err != nil {
+			return err
+		}
+	}
+
+	e.insertRule(rule)
+
+	return nil
+}
+
+// ReferencedFacts returns the sorted names of the facts referenced by the conditions of the
+// rules in the engine, including nested conditions, each listed once. A fact source only needs
+// to supply these facts.
+func (e *Engine) ReferencedFacts() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	referenced := e.referencedFactNames()
+	factNames := make([]string, 0, len(referenced))
+	for factName := range referenced {
+		factNames = append(factNames, factName)
+	}
+	sort.Strings(factNames)
+
+	return factNames
+}
+
+// IndexedRuleNames returns the names of the rules indexed under each fact name, in the order
+// their events are reported: by priority, lowest number first, and then by name. It shows which
+// rules an evaluation considers for a fact, for troubleshooting. Disabled rules are not indexed,
+// and a glob condition indexes its rule under its pattern.
+func (e *Engine) IndexedRuleNames() map[string][]string {
+	snapshot := e.loadSnapshot()
+
+	indexed := make(map[string][]string, len(snapshot.ruleIndex))
+	for factName, factRules := range snapshot.ruleIndex {
+		sorted := append([]*rules.Rule(nil), factRules...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return rulePrecedes(sorted[i], sorted[j], nil)
+		})
+		ruleNames := make([]string, len(sorted))
+		for i, rule := range sorted {
+			ruleNames[i] = rule.Name
+		}
+		indexed[factName] = ruleNames
+	}
+	return indexed
+}
+
+// referencedFactNames returns the set of facts referenced by the conditions of the rules in the
+// engine, including disabled rules, which the rule index leaves out. The caller must hold the
+// engine lock.
+func (e *Engine) referencedFactNames() map[string]bool {
+	factNames := make(map[string]bool)
+	for _, rule := range e.Rules {
+		collectFactNames(rule.Conditions.All, factNames)
+		collectFactNames(rule.Conditions.Any, factNames)
+	}
+	return factNames
+}
+
+// Summary describes the rules loaded in an engine without listing them. MaxRules is the engine's
+// limit on the number of rules, or 0 if there is none.
+type Summary struct {
+	RuleCount     int      `json:"ruleCount"`
+	MaxRules      int      `json:"maxRules"`
+	EnabledCount  int      `json:"enabledCount"`
+	FactCount     int      `json:"factCount"`
+	OperatorsUsed []string `json:"operatorsUsed"`
+}
+
+// Summary counts the rules in the engine, the enabled rules and the referenced facts, and lists
+// the sorted operators used by their conditions, including nested and inner conditions.
+func (e *Engine) Summary() Summary {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	summary := Summary{RuleCount: len(e.Rules), MaxRules: e.MaxRules, FactCount: len(e.referencedFactNames())}
+	operators := make(map[string]bool)
+	for _, rule := range e.Rules {
+		if rule.IsEnabled() {
+			summary.EnabledCount++
+		}
+		collectOperators(operators, rule.Conditions.All)
+		collectOperators(operators, rule.Conditions.Any)
+	}
+
+	summary.OperatorsUsed = make([]string, 0, len(operators))
+	for operator := range operators {
+		summary.OperatorsUsed = append(summary.OperatorsUsed, operator)
+	}
+	sort.Strings(summary.OperatorsUsed)
+
+	return summary
+}
+
+// collectOperators adds the operators of the conditions, and of their nested and inner
+// conditions, to the operators set.
+func collectOperators(operators map[string]bool, conditions []rules.Condition) {
+	for _, condition := range conditions {
+		if condition.Operator != "" {
+			operators[condition.Operator] = true
+		}
+		if condition.Inner != nil {
+			collectOperators(operators, []rules.Condition{*condition.Inner})
+		}
+		collectOperators(operators, condition.All)
+		collectOperators(operators, condition.Any)
+	}
+}
+
+// GetRule returns a copy of the rule with the given name, or a RuleDoesNotExistError.
+func (e *Engine) GetRule(ruleName string) (rules.Rule, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	storedName, exists := e.lookupRuleName(ruleName)
+	if !exists {
+		return rules.Rule{}, &RuleDoesNotExistError{RuleName: ruleName}
+	}
+	return *e.Rules[storedName], nil
+}
+
+// ForEachRule calls fn with each rule in the engine, in no particular order, until fn returns
+// false. Unlike ListRules, it does not copy the whole rule set first. The engine's read lock is
+// held for the whole iteration, so fn must not add, update, remove, enable or disable rules, or
+// call anything else that takes the write lock: doing so deadlocks.
+func (e *Engine) ForEachRule(fn func(rules.Rule) bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, rule := range e.Rules {
+		if !fn(*rule) {
+			return
+		}
+	}
+}
+
+// ListRules returns a copy of all the rules in the engine, sorted by rule name.
+func (e *Engine) ListRules() []rules.Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ruleList := make([]rules.Rule, 0, len(e.Rules))
+	for _, rule := range e.Rules {
+		ruleList = append(ruleList, *rule)
+	}
+	sort.Slice(ruleList, func(i, j int) bool {
+		return ruleList[i].Name < ruleList[j].Name
+	})
+
+	return ruleList
+}
+
+// normalizeKey trims surrounding whitespace from a fact key and converts it to lowercase.
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+// normalizeFactKeys returns a copy of the fact with all of its keys normalized, including the
+// keys of the objects nested in its values, such as the objects of a list that an aggregate
+// condition counts. If two keys normalize to the same value, only one of their values is kept.
+func normalizeFactKeys(fact rules.Fact) rules.Fact {
+	normalized := make(rules.Fact, len(fact))
+	for key, value := range fact {
+		normalized[normalizeKey(key)] = normalizeNestedKeys(value)
+	}
+	return normalized
+}
+
+// normalizeNestedKeys returns a copy of an object or list value with the keys of the objects in
+// it normalized. Other values are returned unchanged.
+func normalizeNestedKeys(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return map[string]interface{}(normalizeFactKeys(value))
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, element := range value {
+			normalized[i] = normalizeNestedKeys(element)
+		}
+		return normalized
+	case []map[string]interface{}:
+		normalized := make([]map[string]interface{}, len(value))
+		for i, element := range value {
+			normalized[i] = normalizeFactKeys(element)
+		}
+		return normalized
+	}
+	return value
+}
+
+// normalizeRuleFacts returns a copy of the rule with the fact references of all of its
+// conditions, including nested and inner ones, and the facts its events include normalized.
+func normalizeRuleFacts(rule rules.Rule) rules.Rule {
+	rule.Conditions = rules.Conditions{
+		All: normalizeConditions(rule.Conditions.All),
+		Any: normalizeConditions(rule.Conditions.Any),
+	}
+	rule.Event.IncludeFacts = normalizeKeys(rule.Event.IncludeFacts)
+	if rule.Events != nil {
+		events := make([]rules.Event, len(rule.Events))
+		for i, event := range rule.Events {
+			event.IncludeFacts = normalizeKeys(event.IncludeFacts)
+			events[i] = event
+		}
+		rule.Events = events
+	}
+	return rule
+}
+
+// normalizeKeys returns a copy of the fact keys, normalized.
+func normalizeKeys(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	normalized := make([]string, len(keys))
+	for i, key := range keys {
+		normalized[i] = normalizeKey(key)
+	}
+	return normalized
+}
+
+// normalizeConditions returns a copy of the conditions with their fact references normalized.
+func normalizeConditions(conditions []rules.Condition) []rules.Condition {
+	if conditions == nil {
+		return nil
+	}
+	normalized := make([]rules.Condition, len(conditions))
+	for i, condition := range conditions {
+		condition.Fact = normalizeKey(condition.Fact)
+		if condition.ValueFact != "" {
+			condition.ValueFact = normalizeKey(condition.ValueFact)
+		}
+		condition.Facts = normalizeKeys(condition.Facts)
+		if condition.Expr != "" {
+			condition.Expr = rules.RenameExprFacts(condition.Expr, normalizeKey)
+		}
+		if condition.Inner != nil {
+			inner := normalizeConditions([]rules.Condition{*condition.Inner})[0]
+			condition.Inner = &inner
+		}
+		condition.All = normalizeConditions(condition.All)
+		condition.Any = normalizeConditions(condition.Any)
+		normalized[i] = condition
+	}
+	return normalized
+}
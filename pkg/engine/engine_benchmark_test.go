@@ -257,3 +257,110 @@ func BenchmarkOperators(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkEvaluateSingleFactKey compares evaluating a fact with a single key, which takes the
+// fast path, with evaluating the same fact plus a key that no rule references, which gathers the
+// same rules through the general path.
+func BenchmarkEvaluateSingleFactKey(b *testing.B) {
+	engine := engine.NewEngine()
+	for i := 0; i < 10; i++ {
+		rule := rules.Rule{
+			Name:     fmt.Sprintf("Rule %d", i),
+			Priority: i,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: i * 10}},
+			},
+			Event: rules.Event{EventType: "High Temperature"},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			b.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	for _, bm := range []struct {
+		name string
+		fact rules.Fact
+	}{
+		{"FastPath", rules.Fact{"temperature": 55}},
+		{"GeneralPath", rules.Fact{"temperature": 55, "unreferenced": 1}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := engine.Evaluate(bm.fact); err != nil {
+					b.Fatalf("Failed to evaluate fact: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEvaluateWithDisabledRules compares evaluating a fact against 1,000 enabled rules
+// alone and alongside 9,000 disabled rules on the same fact. Disabled rules are not indexed, so
+// both take about the same time.
+func BenchmarkEvaluateWithDisabledRules(b *testing.B) {
+	for _, disabledCount := range []int{0, 9000} {
+		b.Run(fmt.Sprintf("Disabled%d", disabledCount), func(b *testing.B) {
+			e := engine.NewEngine()
+			disabled := false
+			for i := 0; i < 1000+disabledCount; i++ {
+				rule := rules.Rule{
+					Name:       fmt.Sprintf("Rule %d", i),
+					Priority:   i,
+					Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: i}}},
+					Event:      rules.Event{EventType: "High Temperature"},
+				}
+				if i >= 1000 {
+					rule.Enabled = &disabled
+				}
+				if err := e.AddRule(rule); err != nil {
+					b.Fatalf("Failed to add rule: %v", err)
+				}
+			}
+			fact := rules.Fact{"temperature": 500}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := e.Evaluate(fact); err != nil {
+					b.Fatalf("Failed to evaluate fact: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLoadRules compares adding 50,000 rules one at a time, which inserts each rule into the
+// index in priority order, with adding them in one AddRules call. The priorities descend, so that
+// every incremental insertion lands at the front of the index list.
+func BenchmarkLoadRules(b *testing.B) {
+	const ruleCount = 50000
+	ruleList := make([]rules.Rule, ruleCount)
+	for i := range ruleList {
+		ruleList[i] = rules.Rule{
+			Name:       fmt.Sprintf("Rule %d", i),
+			Priority:   ruleCount - i,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: i}}},
+			Event:      rules.Event{EventType: "High Temperature"},
+		}
+	}
+
+	b.Run("AddRule", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e := engine.NewEngine()
+			for _, rule := range ruleList {
+				if err := e.AddRule(rule); err != nil {
+					b.Fatalf("Failed to add rule: %v", err)
+				}
+			}
+		}
+	})
+
+	b.Run("AddRules", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e := engine.NewEngine()
+			if err := e.AddRules(ruleList); err != nil {
+				b.Fatalf("Failed to add rules: %v", err)
+			}
+		}
+	})
+}
@@ -1,9 +1,20 @@
 package engine
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/rgehrsitz/rulegopher/pkg/rules"
+	"github.com/rgehrsitz/rulegopher/pkg/store"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -94,6 +105,9 @@ func TestAddDuplicateRule(t *testing.T) {
 				},
 			},
 		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
 	}
 
 	// Add the rule for the first time
@@ -710,6 +724,10 @@ func TestAddRuleWithEmptyName(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected error when adding rule with empty name, but got none")
 	}
+	var emptyNameErr *EmptyRuleNameError
+	if !errors.Is(err, ErrEmptyRuleName) || !errors.As(err, &emptyNameErr) {
+		t.Errorf("Expected an EmptyRuleNameError, got %v", err)
+	}
 }
 
 func TestIntegrationEngineWithRealWorldScenario(t *testing.T) {
@@ -875,7 +893,7 @@ func TestEngine_EvaluateRules_InvalidRule(t *testing.T) {
 	}
 
 	// Directly add the invalid rule to the engine's Rules map
-	engine.Rules[invalidRule.Name] = invalidRule
+	engine.Rules[invalidRule.Name] = &invalidRule
 
 	// Also add the invalid rule to the engine's RuleIndex map
 	engine.RuleIndex["temperature"] = append(engine.RuleIndex["temperature"], &invalidRule)
@@ -890,6 +908,149 @@ func TestEngine_EvaluateRules_InvalidRule(t *testing.T) {
 	}
 }
 
+func TestRebuildIndexAfterDirectChanges(t *testing.T) {
+	engine := NewEngine()
+	hotRule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := engine.AddRule(hotRule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// Rules changed directly are not evaluated until the index is rebuilt
+	warmRule := hotRule
+	warmRule.Name = "WarmRule"
+	warmRule.Event = rules.Event{EventType: "warm"}
+	engine.Rules[warmRule.Name] = &warmRule
+	delete(engine.Rules, hotRule.Name)
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 35}); len(events) != 1 || events[0].EventType != "hot" {
+		t.Errorf("Expected the published index to be evaluated, got %v", events)
+	}
+
+	engine.RebuildIndex()
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 35}); len(events) != 1 || events[0].EventType != "warm" {
+		t.Errorf("Expected only the rule added directly to match after the rebuild, got %v", events)
+	}
+	if indexed := engine.RuleIndex["temperature"]; len(indexed) != 1 || indexed[0] != engine.Rules["WarmRule"] {
+		t.Errorf("Expected the index to point at the stored rule, got %v", indexed)
+	}
+}
+
+func TestUpdateRuleIndexesStoredCopy(t *testing.T) {
+	engine := NewEngine()
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	previous := engine.RuleIndex["temperature"][0]
+	if err := engine.UpdateRule("HotRule", rule.WithThreshold("temperature", 40)); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+
+	// The index points at the rule stored in the map, which is replaced rather than modified
+	stored := engine.Rules["HotRule"]
+	indexed := engine.RuleIndex["temperature"]
+	if len(indexed) != 1 || indexed[0] != stored || stored == previous {
+		t.Fatalf("Expected the index to point at the new stored rule %p, got %v", stored, indexed)
+	}
+	if value := stored.Conditions.All[0].Value; value != 40 || previous.Conditions.All[0].Value != 30 {
+		t.Errorf("Expected the new rule to hold the new threshold and the old one to be unchanged, got %v and %v", value, previous.Conditions.All[0].Value)
+	}
+
+	// Evaluation goes through the index, so the new threshold governs it
+	for _, tc := range []struct {
+		temperature int
+		expected    int
+	}{
+		{35, 0},
+		{45, 1},
+	} {
+		events, err := engine.Evaluate(rules.Fact{"temperature": tc.temperature})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(events) != tc.expected {
+			t.Errorf("Expected %d events at %d degrees, got %v", tc.expected, tc.temperature, events)
+		}
+	}
+
+	// A renamed rule replaces the old name in both the map and the index
+	renamed := rule.WithName("VeryHotRule")
+	if err := engine.UpdateRule("HotRule", renamed); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+	if _, err := engine.GetRule("HotRule"); err == nil {
+		t.Errorf("Expected the old name to be gone after renaming")
+	}
+	if err := engine.RemoveRule("VeryHotRule"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if indexed := engine.RuleIndex["temperature"]; len(indexed) != 0 {
+		t.Errorf("Expected no stale index entries after removing the renamed rule, got %v", indexed)
+	}
+
+	other := rule.WithName("OtherRule")
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := engine.AddRule(other); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	var existsErr *RuleAlreadyExistsError
+	if err := engine.UpdateRule("HotRule", other); !errors.As(err, &existsErr) {
+		t.Errorf("Expected a RuleAlreadyExistsError when renaming onto another rule, got %v", err)
+	}
+}
+
+func TestAddRules(t *testing.T) {
+	newRule := func(name string, priority int) rules.Rule {
+		return rules.Rule{
+			Name:       name,
+			Priority:   priority,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: name},
+		}
+	}
+
+	engine := NewEngine()
+	if err := engine.AddRule(newRule("Existing", 2)); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := engine.AddRules([]rules.Rule{newRule("Third", 3), newRule("First", 1), newRule("Second", 2)}); err != nil {
+		t.Fatalf("Failed to add rules: %v", err)
+	}
+
+	// The index list is in priority order, with ties in the order the rules were added
+	var names []string
+	for _, rule := range engine.RuleIndex["temperature"] {
+		names = append(names, rule.Name)
+	}
+	if expected := []string{"First", "Existing", "Second", "Third"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the index to list %v, got %v", expected, names)
+	}
+
+	// A duplicate or invalid rule keeps the whole list out
+	invalid := newRule("Invalid", 1)
+	invalid.Conditions.All[0].Operator = "invalidOperator"
+	err := engine.AddRules([]rules.Rule{newRule("Fourth", 4), newRule("First", 1), invalid})
+	var existsErr *RuleAlreadyExistsError
+	if !errors.As(err, &existsErr) || existsErr.RuleName != "First" {
+		t.Errorf("Expected a RuleAlreadyExistsError for First, got %v", err)
+	}
+	if len(rules.ValidationErrors(err)) == 0 {
+		t.Errorf("Expected the validation error of Invalid as well, got %v", err)
+	}
+	if _, err := engine.GetRule("Fourth"); err == nil {
+		t.Errorf("Expected none of the rules to be added")
+	}
+}
+
 func TestEngine_EvaluateRules_MixedValidity(t *testing.T) {
 	engine := NewEngine()
 
@@ -1121,3 +1282,2266 @@ func TestEvaluateWithDeeplyNestedConditions(t *testing.T) {
 		t.Fatalf("Expected event type 'Complex Weather Condition', got '%s'", events[0].EventType)
 	}
 }
+
+func TestEvaluateWithMaxEvents(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxEvents = 3
+
+	// Add the rules in reverse priority order so the index order differs from insertion order
+	for i := 10; i >= 1; i-- {
+		rule := rules.Rule{
+			Name:     fmt.Sprintf("Rule%d", i),
+			Priority: i,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{
+					{
+						Fact:     "temperature",
+						Operator: "greaterThan",
+						Value:    30,
+					},
+				},
+			},
+			Event: rules.Event{
+				EventType: fmt.Sprintf("Event%d", i),
+			},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	fact := rules.Fact{
+		"temperature": 35,
+	}
+
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	for i, event := range events {
+		expected := fmt.Sprintf("Event%d", i+1)
+		if event.EventType != expected {
+			t.Errorf("Expected event %d to be '%s', got '%s'", i, expected, event.EventType)
+		}
+	}
+}
+
+func TestEvaluateWithMaxEventsCountsEveryEvent(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxEvents = 3
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "Overheat",
+			Priority:   1,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Events:     []rules.Event{{EventType: "alarm"}, {EventType: "page"}},
+		},
+		{
+			Name:       "Warm",
+			Priority:   2,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 20}}},
+			Events:     []rules.Event{{EventType: "fan"}, {EventType: "log"}},
+		},
+		{
+			Name:       "Mild",
+			Priority:   3,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 10}}},
+			Event:      rules.Event{EventType: "mild"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	var eventTypes []string
+	for _, event := range events {
+		eventTypes = append(eventTypes, event.EventType)
+	}
+	if expected := []string{"alarm", "page", "fan"}; !reflect.DeepEqual(eventTypes, expected) {
+		t.Errorf("Expected events %v, got %v", expected, eventTypes)
+	}
+
+	engine.MaxEvents = 1
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 35}); len(events) != 1 || events[0].EventType != "alarm" {
+		t.Errorf("Expected only the first event of the first rule, got %v", events)
+	}
+}
+
+func TestEvaluateWithPartiallyMatchingAllConditions(t *testing.T) {
+	engine := NewEngine()
+
+	rule := rules.Rule{
+		Name:     "TestRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+				{
+					Fact:     "humidity",
+					Operator: "lessThan",
+					Value:    0.5,
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType:      "alert",
+			CustomProperty: "AC turned on",
+		},
+	}
+
+	err := engine.AddRule(rule)
+	if err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// Only the temperature condition holds, so the rule must not match
+	fact := rules.Fact{
+		"temperature": 35,
+		"humidity":    0.8,
+	}
+
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(events) != 0 {
+		t.Errorf("Expected no events when only one of the All conditions holds, got %d", len(events))
+	}
+}
+
+func TestEvaluateWithReportFactsMultipleConditions(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportFacts = true
+
+	rule := rules.Rule{
+		Name:     "TestRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+				{
+					Fact:     "humidity",
+					Operator: "lessThan",
+					Value:    0.5,
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType:      "alert",
+			CustomProperty: "AC turned on",
+		},
+	}
+
+	err := engine.AddRule(rule)
+	if err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	fact := rules.Fact{
+		"temperature": 35,
+		"humidity":    0.4,
+	}
+
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	event := events[0]
+	if len(event.Facts) != 2 || event.Facts[0] != "temperature" || event.Facts[1] != "humidity" {
+		t.Errorf("Expected both triggering facts to be reported, got %v", event.Facts)
+	}
+	if len(event.Values) != 2 || event.Values[0] != 35 || event.Values[1] != 0.4 {
+		t.Errorf("Expected both triggering fact values to be reported, got %v", event.Values)
+	}
+}
+
+func TestEvaluateWithNormalizeKeys(t *testing.T) {
+	engine := NewEngine()
+	engine.NormalizeKeys = true
+
+	rule := rules.Rule{
+		Name:     "TestRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "Temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
+	}
+
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// The fact key differs from the rule's fact reference in casing and whitespace
+	fact := rules.Fact{
+		" TEMPERATURE ": 35,
+	}
+
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	// Without normalization the same fact does not match
+	engine = NewEngine()
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	events, err = engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events without normalization, got %d", len(events))
+	}
+}
+
+func TestEvaluateWithNormalizeKeysNormalizesNestedReferences(t *testing.T) {
+	engine := NewEngine()
+	engine.NormalizeKeys = true
+
+	rule := rules.Rule{
+		Name: "Errors",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "Records", Aggregate: "countWhere", Inner: &rules.Condition{Fact: "Status", Operator: "equal", Value: "error"}, Operator: "greaterThanOrEqual", Value: 2},
+				{Expr: "Load * 1E2 > 50"},
+			},
+		},
+		Event: rules.Event{EventType: "errors", IncludeFacts: []string{"Region"}},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	fact := rules.Fact{
+		"RECORDS": []interface{}{
+			map[string]interface{}{"STATUS": "error"},
+			map[string]interface{}{" Status ": "error"},
+			map[string]interface{}{"status": "ok"},
+		},
+		"LOAD":   0.6,
+		"REGION": "north",
+	}
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0].Facts, []string{"region"}) || !reflect.DeepEqual(events[0].Values, []interface{}{"north"}) {
+		t.Errorf("Expected the included region, got facts %v and values %v", events[0].Facts, events[0].Values)
+	}
+
+	// The string values of the fact are left as they are
+	if fact["RECORDS"].([]interface{})[0].(map[string]interface{})["STATUS"] != "error" {
+		t.Errorf("Expected the fact to be left unchanged, got %v", fact)
+	}
+}
+
+func TestAddRuleReportsAllValidationErrors(t *testing.T) {
+	engine := NewEngine()
+
+	rule := rules.Rule{
+		Name: "TestRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "hotterThan", Value: 30},
+				{Fact: "humidity", Operator: "wetterThan", Value: 50},
+			},
+		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
+	}
+
+	err := engine.AddRule(rule)
+	if err == nil {
+		t.Fatalf("Expected error when adding rule with invalid operators, got nil")
+	}
+	if !strings.Contains(err.Error(), "hotterThan") || !strings.Contains(err.Error(), "wetterThan") {
+		t.Errorf("Expected both invalid operators to be reported, got: %v", err)
+	}
+}
+
+func TestEvaluateStatefulRuleWithConsecutiveCount(t *testing.T) {
+	engine := NewEngine()
+
+	rule := rules.Rule{
+		Name:             "SustainedHighTemperature",
+		Priority:         1,
+		ConsecutiveCount: 3,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
+	}
+
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	readings := []struct {
+		temperature int
+		expectEvent bool
+	}{
+		{35, false},
+		{36, false},
+		{25, false}, // resets the count
+		{35, false},
+		{36, false},
+		{37, true},
+		{38, true},
+	}
+
+	for i, reading := range readings {
+		events, err := engine.Evaluate(rules.Fact{"temperature": reading.temperature})
+		if err != nil {
+			t.Fatalf("Error evaluating fact: %v", err)
+		}
+		if fired := len(events) == 1; fired != reading.expectEvent {
+			t.Errorf("Reading %d (%d): expected event %v, got %v", i, reading.temperature, reading.expectEvent, fired)
+		}
+	}
+}
+
+func TestEvaluateStatefulRuleWithinDuration(t *testing.T) {
+	engine := NewEngine()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	engine.Now = func() time.Time { return now }
+
+	rule := rules.Rule{
+		Name:             "SustainedHighTemperature",
+		Priority:         1,
+		ConsecutiveCount: 2,
+		WithinDuration:   time.Minute,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
+	}
+
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	fact := rules.Fact{"temperature": 35}
+	if _, err := engine.Evaluate(fact); err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	// The second match happens outside of the window, so it starts a new run
+	now = now.Add(2 * time.Minute)
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events when the matches are further apart than the duration, got %d", len(events))
+	}
+}
+
+func TestUpdateRuleKeepsIndexStable(t *testing.T) {
+	engine := NewEngine()
+
+	// The rule references the temperature fact twice, once in a nested condition
+	rule := rules.Rule{
+		Name:     "TestRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{
+					Fact:     "temperature",
+					Operator: "greaterThan",
+					Value:    30,
+				},
+				{
+					Any: []rules.Condition{
+						{
+							Fact:     "temperature",
+							Operator: "lessThan",
+							Value:    50,
+						},
+						{
+							Fact:     "humidity",
+							Operator: "lessThan",
+							Value:    0.5,
+						},
+					},
+				},
+			},
+		},
+		Event: rules.Event{
+			EventType: "alert",
+		},
+	}
+
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := engine.UpdateRule(rule.Name, rule); err != nil {
+			t.Fatalf("Failed to update rule: %v", err)
+		}
+	}
+
+	if len(engine.RuleIndex) != 2 {
+		t.Errorf("Expected 2 indexed facts, got %d: %v", len(engine.RuleIndex), engine.RuleIndex)
+	}
+	for _, factName := range []string{"temperature", "humidity"} {
+		if n := len(engine.RuleIndex[factName]); n != 1 {
+			t.Errorf("Expected 1 indexed rule for %s, got %d", factName, n)
+		}
+	}
+
+	if err := engine.RemoveRule(rule.Name); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if len(engine.RuleIndex) != 0 {
+		t.Errorf("Expected an empty index after removing the rule, got %v", engine.RuleIndex)
+	}
+}
+
+func TestEvaluateDelta(t *testing.T) {
+	engine := NewEngine()
+
+	// Each rule also reads a fact that the evaluated facts lack, so the FactResolver is called
+	// for it exactly when the rule is evaluated
+	temperatureRule := rules.Rule{
+		Name:     "TemperatureRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "temperatureSite", Operator: "equal", Value: "north"},
+			},
+		},
+		Event: rules.Event{EventType: "temperature"},
+	}
+	humidityRule := rules.Rule{
+		Name:     "HumidityRule",
+		Priority: 2,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "humidity", Operator: "greaterThan", Value: 80},
+				{Fact: "humiditySite", Operator: "equal", Value: "north"},
+			},
+		},
+		Event: rules.Event{EventType: "humidity"},
+	}
+	for _, rule := range []rules.Rule{temperatureRule, humidityRule} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	var resolved []string
+	engine.FactResolver = func(key string) (interface{}, bool) {
+		resolved = append(resolved, key)
+		return "north", true
+	}
+
+	prev := rules.Fact{"temperature": 25, "humidity": 90}
+	current := rules.Fact{"temperature": 35, "humidity": 90}
+
+	events, err := engine.EvaluateDelta(prev, current)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(resolved) != 1 || resolved[0] != "temperatureSite" {
+		t.Errorf("Expected only TemperatureRule to be evaluated, got the facts it resolved: %v", resolved)
+	}
+	if len(events) != 1 || events[0].EventType != "temperature" {
+		t.Errorf("Expected a single temperature event, got %v", events)
+	}
+}
+
+func TestEvaluateRuleWithMultipleEvents(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportRuleName = true
+
+	rule := rules.Rule{
+		Name:     "TemperatureRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			},
+		},
+		Events: []rules.Event{
+			{EventType: "notifyEmail"},
+			{EventType: "notifySlack"},
+		},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %v", len(events), events)
+	}
+	for i, expected := range []string{"notifyEmail", "notifySlack"} {
+		if events[i].EventType != expected {
+			t.Errorf("Expected event %d to be %s, got %s", i, expected, events[i].EventType)
+		}
+		if events[i].RuleName != "TemperatureRule" {
+			t.Errorf("Expected event %d to report rule name TemperatureRule, got %s", i, events[i].RuleName)
+		}
+	}
+}
+
+func TestAddRuleWithoutEvents(t *testing.T) {
+	engine := NewEngine()
+
+	rule := rules.Rule{
+		Name: "TemperatureRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			},
+		},
+	}
+	err := engine.AddRule(rule)
+	if err == nil || !strings.Contains(err.Error(), "at least one event") {
+		t.Errorf("Expected an error about the missing event, got %v", err)
+	}
+}
+
+func TestEvaluateAll(t *testing.T) {
+	engine := NewEngine()
+
+	for _, rule := range []rules.Rule{
+		{
+			Name: "HotRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+			},
+			Event: rules.Event{EventType: "hot"},
+		},
+		{
+			Name: "ColdRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "lessThan", Value: 10}},
+			},
+			Event: rules.Event{EventType: "cold"},
+		},
+		{
+			Name: "HumidRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "humidity", Operator: "greaterThan", Value: 80}},
+			},
+			Event: rules.Event{EventType: "humid"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	results, err := engine.EvaluateAll(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	expected := map[string]bool{"HotRule": true, "ColdRule": false, "HumidRule": false}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func TestEvaluateReportsMatchedBranchLabels(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportFacts = true
+
+	rule := rules.Rule{
+		Name: "AlertRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "enabled", Operator: "equal", Value: true},
+			},
+			Any: []rules.Condition{
+				{Label: "tooHot", Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{
+					Label: "tooHumid",
+					All: []rules.Condition{
+						{Fact: "humidity", Operator: "greaterThan", Value: 80},
+					},
+				},
+			},
+		},
+		Event: rules.Event{EventType: "alert"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"enabled": true, "temperature": 20, "humidity": 90})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0].Labels, []string{"tooHumid"}) {
+		t.Errorf("Expected labels [tooHumid], got %v", events[0].Labels)
+	}
+
+	// The labels do not depend on the engine reporting facts
+	engine.ReportFacts = false
+	events, err = engine.Evaluate(rules.Fact{"enabled": true, "temperature": 35, "humidity": 90})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Labels, []string{"tooHot", "tooHumid"}) || len(events[0].Facts) != 0 {
+		t.Errorf("Expected labels [tooHot tooHumid] and no facts, got %+v", events)
+	}
+}
+
+func TestEngineWritesThroughToStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.db")
+
+	s, err := store.OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	engine := NewEngine()
+	engine.Store = s
+
+	for _, name := range []string{"HotRule", "RemovedRule"} {
+		rule := rules.Rule{
+			Name: name,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+			},
+			Event: rules.Event{EventType: "hot"},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	if err := engine.RemoveRule("RemovedRule"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if err := engine.DisableRule("HotRule"); err != nil {
+		t.Fatalf("Failed to disable rule: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	// A new engine backed by the reopened store sees the same rules
+	s, err = store.OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer s.Close()
+	engine = NewEngine()
+	engine.Store = s
+	if err := engine.LoadFromStore(); err != nil {
+		t.Fatalf("Failed to load rules from store: %v", err)
+	}
+
+	ruleList := engine.ListRules()
+	if len(ruleList) != 1 || ruleList[0].Name != "HotRule" {
+		t.Fatalf("Expected only HotRule to be loaded, got %v", ruleList)
+	}
+	if ruleList[0].IsEnabled() {
+		t.Errorf("Expected HotRule to still be disabled")
+	}
+
+	if err := engine.EnableRule("HotRule"); err != nil {
+		t.Fatalf("Failed to enable rule: %v", err)
+	}
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected 1 event, got %d", len(events))
+	}
+}
+
+func TestEvaluateReportsMatchedPaths(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportPaths = true
+
+	rule := rules.Rule{
+		Name: "AlertRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "enabled", Operator: "equal", Value: true},
+			},
+			Any: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{
+					All: []rules.Condition{
+						{Fact: "humidity", Operator: "greaterThan", Value: 80},
+						{Fact: "temperature", Operator: "greaterThan", Value: 15},
+					},
+				},
+			},
+		},
+		Event: rules.Event{EventType: "alert"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"enabled": true, "temperature": 20, "humidity": 90})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	expected := []string{"all[0]", "any[1].all[0]", "any[1].all[1]"}
+	if !reflect.DeepEqual(events[0].Paths, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, events[0].Paths)
+	}
+}
+
+func TestAddRuleWithNormalizedRuleNames(t *testing.T) {
+	newRule := func(name string) rules.Rule {
+		return rules.Rule{
+			Name: name,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+			},
+			Event: rules.Event{EventType: "alert"},
+		}
+	}
+
+	tests := []struct {
+		name               string
+		normalizeRuleNames bool
+		foldRuleNameCase   bool
+		conflict           bool
+	}{
+		{"without normalization", false, false, false},
+		{"trimming only", true, false, false},
+		{"trimming and case folding", true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine()
+			engine.NormalizeRuleNames = tt.normalizeRuleNames
+			engine.FoldRuleNameCase = tt.foldRuleNameCase
+
+			if err := engine.AddRule(newRule("TestRule")); err != nil {
+				t.Fatalf("Failed to add rule: %v", err)
+			}
+			err := engine.AddRule(newRule("testrule "))
+
+			var existsErr *RuleAlreadyExistsError
+			if conflict := errors.As(err, &existsErr); conflict != tt.conflict {
+				t.Errorf("Expected conflict %v, got error %v", tt.conflict, err)
+			}
+		})
+	}
+
+	// Trimming alone makes names that only differ by whitespace collide
+	engine := NewEngine()
+	engine.NormalizeRuleNames = true
+	if err := engine.AddRule(newRule("TestRule")); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	var existsErr *RuleAlreadyExistsError
+	if err := engine.AddRule(newRule(" TestRule ")); !errors.As(err, &existsErr) {
+		t.Errorf("Expected a RuleAlreadyExistsError, got %v", err)
+	}
+}
+
+func TestLookupRulesWithNormalizedRuleNames(t *testing.T) {
+	newRule := func(name string) rules.Rule {
+		return rules.Rule{
+			Name: name,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+			},
+			Event: rules.Event{EventType: "alert"},
+		}
+	}
+
+	engine := NewEngine()
+	engine.NormalizeRuleNames = true
+	engine.FoldRuleNameCase = true
+	if err := engine.AddRule(newRule("TestRule")); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	if rule, err := engine.GetRule("testrule "); err != nil || rule.Name != "TestRule" {
+		t.Errorf("Expected to get TestRule, got %v and %v", rule.Name, err)
+	}
+	if err := engine.DisableRule(" TESTRULE"); err != nil {
+		t.Errorf("Failed to disable rule: %v", err)
+	}
+	priority := 5
+	if err := engine.PatchRule("testrule", RulePatch{Priority: &priority}); err != nil {
+		t.Errorf("Failed to patch rule: %v", err)
+	}
+	if rule, _ := engine.GetRule("TestRule"); rule.Priority != 5 || rule.IsEnabled() || len(engine.Rules) != 1 {
+		t.Errorf("Expected the stored rule to be patched and disabled, got %+v", engine.Rules)
+	}
+	if err := engine.UpdateRule("testRule", newRule("TestRule")); err != nil || len(engine.Rules) != 1 {
+		t.Errorf("Failed to update rule: %v, rules %v", err, engine.Rules)
+	}
+	if err := engine.RemoveRule("TESTRULE"); err != nil || len(engine.Rules) != 0 {
+		t.Errorf("Failed to remove rule: %v, rules %v", err, engine.Rules)
+	}
+
+	// Without normalization, lookups are exact, and a batch may hold names differing by case
+	// or whitespace
+	engine = NewEngine()
+	if err := engine.AddRules([]rules.Rule{newRule("TestRule"), newRule("TestRule ")}); err != nil {
+		t.Fatalf("Failed to add rules: %v", err)
+	}
+	var notExistErr *RuleDoesNotExistError
+	if _, err := engine.GetRule("testrule"); !errors.As(err, &notExistErr) {
+		t.Errorf("Expected a RuleDoesNotExistError, got %v", err)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	engine := NewEngine()
+
+	for _, rule := range []rules.Rule{
+		{
+			Name: "HotRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+			},
+			Event: rules.Event{EventType: "hot"},
+		},
+		{
+			Name: "HumidRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: "humidity", Operator: "greaterThan", Value: 80}},
+			},
+			Event: rules.Event{EventType: "humid"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	failures := engine.RunTests([]rules.TestCase{
+		{
+			Name:          "hot and humid",
+			Fact:          rules.Fact{"temperature": 35, "humidity": 90},
+			ExpectedRules: []string{"HotRule", "HumidRule"},
+		},
+		{
+			Name:          "hot only",
+			Fact:          rules.Fact{"temperature": 35, "humidity": 90},
+			ExpectedRules: []string{"HotRule", "ColdRule"},
+		},
+	})
+
+	if len(failures) != 1 {
+		t.Fatalf("Expected 1 failure, got %d: %v", len(failures), failures)
+	}
+	failure := failures[0]
+	if failure.Case.Name != "hot only" {
+		t.Errorf("Expected the hot only case to fail, got %s", failure.Case.Name)
+	}
+	if !reflect.DeepEqual(failure.MissingRules, []string{"ColdRule"}) {
+		t.Errorf("Expected ColdRule to be missing, got %v", failure.MissingRules)
+	}
+	if !reflect.DeepEqual(failure.UnexpectedRules, []string{"HumidRule"}) {
+		t.Errorf("Expected HumidRule to be unexpected, got %v", failure.UnexpectedRules)
+	}
+	if msg := failure.Error(); !strings.Contains(msg, "missing: ColdRule") || !strings.Contains(msg, "unexpected: HumidRule") {
+		t.Errorf("Unexpected failure message: %s", msg)
+	}
+}
+
+func TestReferencedFacts(t *testing.T) {
+	engine := NewEngine()
+
+	for _, rule := range []rules.Rule{
+		{
+			Name: "HotRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{
+					{Fact: "temperature", Operator: "greaterThan", Value: 30},
+					{Any: []rules.Condition{{Fact: "humidity", Operator: "greaterThan", Value: 80}}},
+				},
+			},
+			Event: rules.Event{EventType: "hot"},
+		},
+		{
+			Name: "HumidRule",
+			Conditions: rules.Conditions{
+				Any: []rules.Condition{
+					{Fact: "humidity", Operator: "greaterThan", Value: 80},
+					{Fact: "dewPoint", Operator: "greaterThan", Value: 20},
+				},
+			},
+			Event: rules.Event{EventType: "humid"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	expected := []string{"dewPoint", "humidity", "temperature"}
+	if facts := engine.ReferencedFacts(); !reflect.DeepEqual(facts, expected) {
+		t.Errorf("Expected %v, got %v", expected, facts)
+	}
+
+	if err := engine.RemoveRule("HumidRule"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	expected = []string{"humidity", "temperature"}
+	if facts := engine.ReferencedFacts(); !reflect.DeepEqual(facts, expected) {
+		t.Errorf("Expected %v after removing a rule, got %v", expected, facts)
+	}
+}
+
+func TestEvaluateRecoversRulePanics(t *testing.T) {
+	engine := NewEngine()
+	engine.UnmatchedFactBehavior = "Ignore"
+	engine.FactResolver = func(key string) (interface{}, bool) {
+		panic("lookup of " + key + " failed")
+	}
+
+	for _, rule := range []rules.Rule{
+		{
+			Name: "BrokenRule",
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "humidity", Operator: "greaterThan", Value: 80},
+			}},
+			Event: rules.Event{EventType: "muggy"},
+		},
+		{
+			Name:       "HotRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "hot"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35})
+	if len(events) != 1 || events[0].EventType != "hot" {
+		t.Errorf("Expected the other rule to still match, got %v", events)
+	}
+	var panicErr *RulePanicError
+	if !errors.As(err, &panicErr) || !errors.Is(err, ErrRulePanicked) {
+		t.Fatalf("Expected a RulePanicError, got %v", err)
+	}
+	if panicErr.RuleName != "BrokenRule" || !strings.Contains(err.Error(), "rule BrokenRule panicked: lookup of humidity failed") {
+		t.Errorf("Expected the panic of BrokenRule to be reported, got %v", err)
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Errorf("Expected the stack trace of the panic")
+	}
+
+	// The other ways of evaluating rules recover the panic as well
+	results, err := engine.EvaluateAll(rules.Fact{"temperature": 35})
+	if !errors.Is(err, ErrRulePanicked) || results["BrokenRule"] || !results["HotRule"] {
+		t.Errorf("Expected EvaluateAll to report the panic and the other rule matching, got %v and %v", results, err)
+	}
+	brokenRule, _ := engine.GetRule("BrokenRule")
+	if matched, _, err := engine.TryRule(brokenRule, rules.Fact{"temperature": 35}); matched || !errors.Is(err, ErrRulePanicked) {
+		t.Errorf("Expected TryRule to report the panic, got %v and %v", matched, err)
+	}
+	failures := engine.RunTests([]rules.TestCase{{Fact: rules.Fact{"temperature": 35}, ExpectedRules: []string{"HotRule"}}})
+	if len(failures) != 1 || !errors.Is(failures[0].Err, ErrRulePanicked) {
+		t.Errorf("Expected RunTests to report the panic, got %v", failures)
+	}
+}
+
+func TestStrictFacts(t *testing.T) {
+	engine := NewEngine()
+	engine.StrictFacts = true
+	engine.UnmatchedFactBehavior = "Ignore"
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "hot"},
+		},
+		{
+			Name:       "ZoneRule",
+			Conditions: rules.Conditions{Any: []rules.Condition{{Fact: "zone_*", Glob: "any", Operator: "equal", Value: "north"}}},
+			Event:      rules.Event{EventType: "zone"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35, "zone_a": "north"})
+	if err != nil || len(events) != 2 {
+		t.Errorf("Expected 2 events for referenced keys, got %v and %v", events, err)
+	}
+
+	events, err = engine.Evaluate(rules.Fact{"temperature": 35, "password": "secret", "debug": true})
+	var unexpectedErr *UnexpectedFactsError
+	if !errors.As(err, &unexpectedErr) || !errors.Is(err, ErrUnexpectedFacts) {
+		t.Fatalf("Expected an UnexpectedFactsError, got %v", err)
+	}
+	if !reflect.DeepEqual(unexpectedErr.Keys, []string{"debug", "password"}) {
+		t.Errorf("Expected the unexpected keys debug and password, got %v", unexpectedErr.Keys)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events for a rejected fact, got %v", events)
+	}
+
+	engine.StrictFacts = false
+	if events, err := engine.Evaluate(rules.Fact{"temperature": 35, "password": "secret"}); err != nil || len(events) != 1 {
+		t.Errorf("Expected the extra key to be ignored without StrictFacts, got %v and %v", events, err)
+	}
+}
+
+func TestStrictFactsAcceptsReadFacts(t *testing.T) {
+	engine := NewEngine()
+	engine.StrictFacts = true
+	engine.UnmatchedFactBehavior = "Ignore"
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "AllowedRole",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}}},
+			Event:      rules.Event{EventType: "allowed", IncludeFacts: []string{"user"}},
+		},
+		{
+			Name:       "HighBMI",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "bmi", Operator: "greaterThan", Value: 30}}},
+			Events:     []rules.Event{{EventType: "bmi", IncludeFacts: []string{"/patient/id"}}},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	engine.AddDerivedFact("bmi", func(fact rules.Fact) (interface{}, error) {
+		weight, _ := fact["weight"].(float64)
+		height, _ := fact["height"].(float64)
+		return weight / (height * height), nil
+	}, "weight", "height")
+
+	fact := rules.Fact{
+		"role":         "admin",
+		"allowedRoles": []interface{}{"admin"},
+		"user":         "ada",
+		"patient":      map[string]interface{}{"id": "p1"},
+		"weight":       100.0,
+		"height":       1.7,
+	}
+	events, err := engine.Evaluate(fact)
+	if err != nil || len(events) != 2 {
+		t.Errorf("Expected 2 events for keys the rules and derivations read, got %v and %v", events, err)
+	}
+
+	var unexpectedErr *UnexpectedFactsError
+	if _, err := engine.Evaluate(rules.Fact{"role": "admin", "age": 30}); !errors.As(err, &unexpectedErr) || !reflect.DeepEqual(unexpectedErr.Keys, []string{"age"}) {
+		t.Errorf("Expected age to be unexpected, got %v", err)
+	}
+
+	// A derivation that does not declare its inputs may read any key
+	engine.AddDerivedFact("ageGroup", func(fact rules.Fact) (interface{}, error) {
+		return fact["age"], nil
+	})
+	if _, err := engine.Evaluate(rules.Fact{"role": "admin", "age": 30}); err != nil {
+		t.Errorf("Expected every key to be accepted with an undeclared derivation, got %v", err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	engine := NewEngine()
+
+	disabled := false
+	for _, rule := range []rules.Rule{
+		{
+			Name: "HotRule",
+			Conditions: rules.Conditions{
+				All: []rules.Condition{
+					{Fact: "temperature", Operator: "greaterThan", Value: 30},
+					{Any: []rules.Condition{{Fact: "humidity", Operator: "greaterThanOrEqual", Value: 80}}},
+				},
+			},
+			Event: rules.Event{EventType: "hot"},
+		},
+		{
+			Name: "ErrorRule",
+			Conditions: rules.Conditions{
+				Any: []rules.Condition{
+					{Fact: "humidity", Operator: "greaterThan", Value: 90},
+					{Fact: "records", Aggregate: "countWhere", Inner: &rules.Condition{Fact: "status", Operator: "equal", Value: "error"}, Operator: "greaterThan", Value: 1},
+				},
+			},
+			Event:   rules.Event{EventType: "errors"},
+			Enabled: &disabled,
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	expected := Summary{
+		RuleCount:     2,
+		EnabledCount:  1,
+		FactCount:     3,
+		OperatorsUsed: []string{"equal", "greaterThan", "greaterThanOrEqual"},
+	}
+	if summary := engine.Summary(); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+
+	expected = Summary{OperatorsUsed: []string{}}
+	if summary := NewEngine().Summary(); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected %+v for an empty engine, got %+v", expected, summary)
+	}
+}
+
+func TestEvaluateOrdersEventsDeterministically(t *testing.T) {
+	engine := NewEngine()
+
+	// Rules referencing different facts are gathered from the index in fact-map iteration order
+	for i, name := range []string{"Delta", "Alpha", "Charlie", "Bravo", "Echo", "Foxtrot"} {
+		rule := rules.Rule{
+			Name:     name,
+			Priority: i % 2,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{{Fact: fmt.Sprintf("sensor%d", i), Operator: "greaterThan", Value: 0}},
+			},
+			Event: rules.Event{EventType: name},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	fact := rules.Fact{"sensor0": 1, "sensor1": 1, "sensor2": 1, "sensor3": 1, "sensor4": 1, "sensor5": 1}
+	expected := []string{"Charlie", "Delta", "Echo", "Alpha", "Bravo", "Foxtrot"}
+
+	for i := 0; i < 20; i++ {
+		events, err := engine.Evaluate(fact)
+		if err != nil {
+			t.Fatalf("Error evaluating fact: %v", err)
+		}
+		eventTypes := make([]string, len(events))
+		for j, event := range events {
+			eventTypes[j] = event.EventType
+		}
+		if !reflect.DeepEqual(eventTypes, expected) {
+			t.Fatalf("Evaluation %d: expected events in order %v, got %v", i, expected, eventTypes)
+		}
+	}
+}
+
+func TestAddRuleWithDisallowedOperator(t *testing.T) {
+	engine := NewEngine()
+	engine.AllowedOperators("equal", "greaterThan", "lessThan")
+
+	regexRule := rules.Rule{
+		Name: "RegexRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Any: []rules.Condition{{Fact: "hostname", Operator: "matches", Value: "^db-"}}},
+			},
+		},
+		Event: rules.Event{EventType: "alert"},
+	}
+
+	err := engine.AddRule(regexRule)
+	if err == nil {
+		t.Fatalf("Expected the rule using a disallowed operator to be rejected")
+	}
+	validationErrors := rules.ValidationErrors(err)
+	if len(validationErrors) != 1 || validationErrors[0].Path != "conditions.all[1].any[0].operator" ||
+		!strings.Contains(validationErrors[0].Message, "operator matches is not allowed") {
+		t.Errorf("Expected a single error for the matches operator, got %v", err)
+	}
+
+	allowedRule := regexRule.WithName("AllowedRule")
+	allowedRule.Conditions.All = allowedRule.Conditions.All[:1]
+	if err := engine.AddRule(allowedRule); err != nil {
+		t.Errorf("Expected the rule using allowed operators to be added, got %v", err)
+	}
+
+	// With no operators, every operator is allowed again
+	engine.AllowedOperators()
+	if err := engine.AddRule(regexRule); err != nil {
+		t.Errorf("Expected the regex rule to be added once all operators are allowed, got %v", err)
+	}
+}
+
+func TestAllowedOperatorsWhileAddingRules(t *testing.T) {
+	engine := NewEngine()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			engine.AllowedOperators("equal", "greaterThan")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			rule := rules.Rule{
+				Name:       fmt.Sprintf("Rule%d", i),
+				Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+				Event:      rules.Event{EventType: "alert"},
+			}
+			if err := engine.AddRule(rule); err != nil {
+				t.Errorf("Failed to add rule: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(engine.ListRules()) != 10 {
+		t.Errorf("Expected 10 rules, got %d", len(engine.ListRules()))
+	}
+}
+
+func TestEvaluateWithDefaultFacts(t *testing.T) {
+	engine := NewEngine()
+	engine.DefaultFacts = rules.Fact{"status": "active"}
+
+	rule := rules.Rule{
+		Name: "ActiveRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{{Fact: "status", Operator: "equal", Value: "active"}},
+		},
+		Event: rules.Event{EventType: "active"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// The default applies when the fact is absent
+	fact := rules.Fact{"temperature": 20}
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "active" {
+		t.Errorf("Expected the rule to match via the default, got %v", events)
+	}
+	if _, ok := fact["status"]; ok {
+		t.Errorf("Expected the evaluated fact not to be modified, got %v", fact)
+	}
+
+	// and the incoming value takes precedence when present
+	events, err = engine.Evaluate(rules.Fact{"status": "suspended"})
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected the incoming status to override the default, got %v", events)
+	}
+
+	events, err = engine.Evaluate(rules.Fact{"status": "active"})
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected the rule to match via the real value, got %v", events)
+	}
+}
+
+func TestEvaluateSkipsExpiredRules(t *testing.T) {
+	engine := NewEngine()
+
+	expired := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "ExpiredPromotion",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "cartTotal", Operator: "greaterThan", Value: 50}}},
+			Event:      rules.Event{EventType: "expiredDiscount"},
+			ExpiresAt:  &expired,
+		},
+		{
+			Name:       "CurrentPromotion",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "cartTotal", Operator: "greaterThan", Value: 50}}},
+			Event:      rules.Event{EventType: "currentDiscount"},
+			ExpiresAt:  &future,
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"cartTotal": 80})
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "currentDiscount" {
+		t.Errorf("Expected only the current promotion to fire, got %v", events)
+	}
+
+	results, err := engine.EvaluateAll(rules.Fact{"cartTotal": 80})
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if results["ExpiredPromotion"] || !results["CurrentPromotion"] {
+		t.Errorf("Expected only the current promotion to match, got %v", results)
+	}
+
+	removed, err := engine.RemoveExpiredRules()
+	if err != nil {
+		t.Fatalf("Failed to remove expired rules: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"ExpiredPromotion"}) {
+		t.Errorf("Expected the expired promotion to be removed, got %v", removed)
+	}
+	if _, err := engine.GetRule("ExpiredPromotion"); err == nil {
+		t.Errorf("Expected the expired promotion to no longer exist")
+	}
+	if rule, err := engine.GetRule("CurrentPromotion"); err != nil || rule.Name != "CurrentPromotion" {
+		t.Errorf("Expected to get the current promotion, got %v, %v", rule, err)
+	}
+}
+
+func TestEvaluateSingleFactKeyMatchesGeneralPath(t *testing.T) {
+	for _, maxEvents := range []int{0, 2} {
+		engine := NewEngine()
+		engine.MaxEvents = maxEvents
+		engine.ReportRuleName = true
+
+		for i, name := range []string{"Delta", "Alpha", "Charlie", "Bravo", "Echo"} {
+			rule := rules.Rule{
+				Name:     name,
+				Priority: i % 2,
+				Conditions: rules.Conditions{
+					All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: i * 10}},
+				},
+				Event: rules.Event{EventType: "alert"},
+			}
+			if err := engine.AddRule(rule); err != nil {
+				t.Fatalf("Failed to add rule: %v", err)
+			}
+		}
+
+		// The unreferenced key makes the second fact take the general path
+		fastEvents, err := engine.Evaluate(rules.Fact{"temperature": 25})
+		if err != nil {
+			t.Fatalf("Failed to evaluate fact: %v", err)
+		}
+		generalEvents, err := engine.Evaluate(rules.Fact{"temperature": 25, "unreferenced": 1})
+		if err != nil {
+			t.Fatalf("Failed to evaluate fact: %v", err)
+		}
+		if !reflect.DeepEqual(fastEvents, generalEvents) {
+			t.Errorf("Expected the same events with MaxEvents %d, got %v and %v", maxEvents, fastEvents, generalEvents)
+		}
+		if len(fastEvents) == 0 {
+			t.Errorf("Expected some events with MaxEvents %d", maxEvents)
+		}
+
+		// Sorting for MaxEvents must not reorder the snapshot's index entry, which keeps rules of
+		// the same priority in the order they were added
+		var names []string
+		for _, rule := range engine.loadSnapshot().ruleIndex["temperature"] {
+			names = append(names, rule.Name)
+		}
+		if expected := []string{"Delta", "Charlie", "Echo", "Alpha", "Bravo"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected the index entry %v to be unchanged, got %v", expected, names)
+		}
+	}
+}
+
+func TestEvaluateTrendCondition(t *testing.T) {
+	engine := NewEngine()
+
+	rule := rules.Rule{
+		Name: "RisingTemperature",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{{Fact: "temperature", Trend: "increasing", Window: 3}},
+		},
+		Event: rules.Event{EventType: "rising"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// The values decrease, then increase for three evaluations in a row
+	var fired []bool
+	for _, temperature := range []interface{}{25, 24, 23, 24, 25, 26} {
+		events, err := engine.Evaluate(rules.Fact{"temperature": temperature})
+		if err != nil {
+			t.Fatalf("Failed to evaluate fact: %v", err)
+		}
+		fired = append(fired, len(events) == 1)
+	}
+	expected := []bool{false, false, false, false, true, true}
+	if !reflect.DeepEqual(fired, expected) {
+		t.Errorf("Expected the rule to fire %v, got %v", expected, fired)
+	}
+
+	// Facts without the trend fact leave the history unchanged
+	if _, err := engine.Evaluate(rules.Fact{"humidity": 50}); err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 27}); len(events) != 1 {
+		t.Errorf("Expected the rule to keep firing, got %v", events)
+	}
+
+	// Resetting the state discards the history
+	engine.ResetRuleState("RisingTemperature")
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 28}); len(events) != 0 {
+		t.Errorf("Expected the rule not to fire right after a reset, got %v", events)
+	}
+}
+
+func TestTrendHistoryOnlyRecordedByEvaluate(t *testing.T) {
+	engine := NewEngine()
+
+	rule := rules.Rule{
+		Name: "RisingTemperature",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{{Fact: "temperature", Trend: "increasing"}},
+		},
+		Event: rules.Event{EventType: "rising"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if _, err := engine.Evaluate(rules.Fact{"temperature": 20}); err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+
+	// EvaluateAll, RunTests and TryRule see the recorded values followed by the fact's, but do
+	// not record them
+	for i := 0; i < 2; i++ {
+		results, err := engine.EvaluateAll(rules.Fact{"temperature": 25})
+		if err != nil || !results["RisingTemperature"] {
+			t.Errorf("Expected EvaluateAll to match, got %v and %v", results, err)
+		}
+		failures := engine.RunTests([]rules.TestCase{{Fact: rules.Fact{"temperature": 25}, ExpectedRules: []string{"RisingTemperature"}}})
+		if len(failures) != 0 {
+			t.Errorf("Expected the test case to pass, got %v", failures)
+		}
+		if matched, _, err := engine.TryRule(rule, rules.Fact{"temperature": 25}); err != nil || !matched {
+			t.Errorf("Expected TryRule to match, got %v and %v", matched, err)
+		}
+	}
+
+	// Only the value given to Evaluate was recorded, so 22 follows 20 rather than 25
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 22}); len(events) != 1 {
+		t.Errorf("Expected the rule to fire, got %v", events)
+	}
+}
+
+func TestLoadFromStoreIndexesEachRule(t *testing.T) {
+	s, err := store.OpenBoltStore(filepath.Join(t.TempDir(), "rules.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer s.Close()
+
+	for _, name := range []string{"DoorRule", "WindowRule"} {
+		rule := rules.Rule{
+			Name:       name,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: name + "Open", Operator: "equal", Value: true}}},
+			Event:      rules.Event{EventType: name},
+		}
+		if err := s.Put(rule); err != nil {
+			t.Fatalf("Failed to store rule: %v", err)
+		}
+	}
+
+	engine := NewEngine()
+	engine.Store = s
+	if err := engine.LoadFromStore(); err != nil {
+		t.Fatalf("Failed to load rules from store: %v", err)
+	}
+
+	// Each loaded rule is indexed under its own facts, not those of the last rule loaded
+	for _, name := range []string{"DoorRule", "WindowRule"} {
+		events, err := engine.Evaluate(rules.Fact{name + "Open": true})
+		if err != nil {
+			t.Fatalf("Error evaluating fact: %v", err)
+		}
+		if len(events) != 1 || events[0].EventType != name {
+			t.Errorf("Expected %s to fire, got %v", name, events)
+		}
+	}
+}
+
+func TestAddRuleMaxRules(t *testing.T) {
+	engine := NewEngine()
+	engine.MaxRules = 3
+
+	for i := 0; i < 3; i++ {
+		rule := rules.Rule{
+			Name:       fmt.Sprintf("Rule%d", i),
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: i}}},
+			Event:      rules.Event{EventType: "alert"},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule %d of 3: %v", i+1, err)
+		}
+	}
+
+	overflow := rules.Rule{
+		Name:       "Overflow",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 10}}},
+		Event:      rules.Event{EventType: "alert"},
+	}
+	err := engine.AddRule(overflow)
+	var tooManyErr *TooManyRulesError
+	if !errors.As(err, &tooManyErr) {
+		t.Fatalf("Expected a TooManyRulesError, got %v", err)
+	}
+	if tooManyErr.RuleName != "Overflow" || tooManyErr.MaxRules != 3 {
+		t.Errorf("Expected the error to name rule Overflow and limit 3, got %+v", tooManyErr)
+	}
+	if _, exists := engine.Rules["Overflow"]; exists {
+		t.Errorf("Expected the rule over the limit not to be added")
+	}
+
+	summary := engine.Summary()
+	if summary.RuleCount != 3 || summary.MaxRules != 3 {
+		t.Errorf("Expected a summary with 3 rules and a limit of 3, got %+v", summary)
+	}
+
+	// Removing a rule makes room for another
+	if err := engine.RemoveRule("Rule0"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if err := engine.AddRule(overflow); err != nil {
+		t.Errorf("Expected the rule to be added after removing one, got %v", err)
+	}
+}
+
+func TestForEachRuleStopsEarly(t *testing.T) {
+	engine := NewEngine()
+	for i := 0; i < 5; i++ {
+		rule := rules.Rule{
+			Name:       fmt.Sprintf("Rule%d", i),
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: i}}},
+			Event:      rules.Event{EventType: "alert"},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	var visited []string
+	engine.ForEachRule(func(rule rules.Rule) bool {
+		visited = append(visited, rule.Name)
+		return len(visited) < 2
+	})
+	if len(visited) != 2 {
+		t.Fatalf("Expected the iteration to stop after 2 rules, visited %v", visited)
+	}
+	if visited[0] == visited[1] {
+		t.Errorf("Expected 2 different rules, visited %v", visited)
+	}
+
+	count := 0
+	engine.ForEachRule(func(rules.Rule) bool {
+		count++
+		return true
+	})
+	if count != 5 {
+		t.Errorf("Expected to visit all 5 rules, visited %d", count)
+	}
+}
+
+func TestDisabledRulesAreNotIndexed(t *testing.T) {
+	engine := NewEngine()
+	disabled := false
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "hot"},
+		},
+		{
+			Name:       "HumidRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "humidity", Operator: "greaterThan", Value: 80}}},
+			Event:      rules.Event{EventType: "humid"},
+			Enabled:    &disabled,
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	if _, ok := engine.RuleIndex["humidity"]; ok {
+		t.Errorf("Expected a rule added disabled not to be indexed, got %v", engine.RuleIndex)
+	}
+
+	if err := engine.DisableRule("HotRule"); err != nil {
+		t.Fatalf("Failed to disable rule: %v", err)
+	}
+	if len(engine.RuleIndex) != 0 {
+		t.Errorf("Expected a disabled rule to be removed from the index, got %v", engine.RuleIndex)
+	}
+
+	// Disabled rules still count as referencing their facts
+	if facts := engine.ReferencedFacts(); !reflect.DeepEqual(facts, []string{"humidity", "temperature"}) {
+		t.Errorf("Expected referenced facts [humidity temperature], got %v", facts)
+	}
+
+	if err := engine.EnableRule("HumidRule"); err != nil {
+		t.Fatalf("Failed to enable rule: %v", err)
+	}
+	if n := len(engine.RuleIndex["humidity"]); n != 1 {
+		t.Errorf("Expected an enabled rule to be indexed again, got %d entries", n)
+	}
+	events, err := engine.Evaluate(rules.Fact{"humidity": 90, "temperature": 35})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "humid" {
+		t.Errorf("Expected only the humid event, got %v", events)
+	}
+}
+
+func TestEvaluateFailFast(t *testing.T) {
+	newTestEngine := func(failFast bool) *Engine {
+		engine := NewEngine()
+		engine.FailFast = failFast
+		for _, rule := range []rules.Rule{
+			{
+				Name:       "HotRule",
+				Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+				Event:      rules.Event{EventType: "hot"},
+			},
+			{
+				Name:       "StatusRule",
+				Conditions: rules.Conditions{All: []rules.Condition{{Fact: "status", Operator: "greaterThan", Value: 1}}},
+				Event:      rules.Event{EventType: "status"},
+			},
+		} {
+			if err := engine.AddRule(rule); err != nil {
+				t.Fatalf("Failed to add rule: %v", err)
+			}
+		}
+		return engine
+	}
+	// The status is an object, which cannot be compared with a number, so StatusRule fails
+	fact := rules.Fact{"temperature": 35, "status": map[string]interface{}{"code": 2}}
+
+	events, err := newTestEngine(false).Evaluate(fact)
+	var merr *multierror.Error
+	if !errors.As(err, &merr) || len(merr.Errors) != 1 {
+		t.Fatalf("Expected a multierror with 1 error, got %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "hot" {
+		t.Errorf("Expected the hot event alongside the error, got %v", events)
+	}
+
+	events, err = newTestEngine(true).Evaluate(fact)
+	var typeErr *rules.UnsupportedFactTypeError
+	if !errors.As(err, &typeErr) || typeErr.Fact != "status" {
+		t.Fatalf("Expected the error of StatusRule, got %v", err)
+	}
+	if errors.As(err, &merr) {
+		t.Errorf("Expected the first error rather than a multierror, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events, got %v", events)
+	}
+}
+
+func TestEvaluateWithOverrides(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportRuleName = true
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "Routine",
+			Priority:   1,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 0}}},
+			Event:      rules.Event{EventType: "reading"},
+		},
+		{
+			Name:       "Overheat",
+			Priority:   5,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "alert"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	ruleNames := func(events []rules.Event) []string {
+		var names []string
+		for _, event := range events {
+			names = append(names, event.RuleName)
+		}
+		return names
+	}
+
+	events, err := engine.EvaluateWithOverrides(rules.Fact{"temperature": 35}, map[string]int{"Overheat": 0})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if names := ruleNames(events); !reflect.DeepEqual(names, []string{"Overheat", "Routine"}) {
+		t.Errorf("Expected the boosted rule first, got %v", names)
+	}
+
+	// The override only applies to that call
+	events, err = engine.Evaluate(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if names := ruleNames(events); !reflect.DeepEqual(names, []string{"Routine", "Overheat"}) {
+		t.Errorf("Expected the rules in their own priority order, got %v", names)
+	}
+	if rule, _ := engine.GetRule("Overheat"); rule.Priority != 5 {
+		t.Errorf("Expected the rule's priority to be unchanged, got %d", rule.Priority)
+	}
+
+	// With a cap on the events, the overridden priorities decide which matches are kept
+	engine.MaxEvents = 1
+	events, _ = engine.EvaluateWithOverrides(rules.Fact{"temperature": 35}, map[string]int{"Overheat": 0})
+	if names := ruleNames(events); !reflect.DeepEqual(names, []string{"Overheat"}) {
+		t.Errorf("Expected only the boosted rule to be kept, got %v", names)
+	}
+}
+
+func TestEvaluateInPriorityRange(t *testing.T) {
+	engine := NewEngine()
+	for _, priority := range []int{1, 5, 10, 11, 50} {
+		rule := rules.Rule{
+			Name:       fmt.Sprintf("Priority%d", priority),
+			Priority:   priority,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: fmt.Sprintf("priority%d", priority)},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	events, err := engine.EvaluateInPriorityRange(rules.Fact{"temperature": 35}, 1, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var eventTypes []string
+	for _, event := range events {
+		eventTypes = append(eventTypes, event.EventType)
+	}
+	if expected := []string{"priority1", "priority5", "priority10"}; !reflect.DeepEqual(eventTypes, expected) {
+		t.Errorf("Expected events %v, got %v", expected, eventTypes)
+	}
+
+	events, err = engine.EvaluateInPriorityRange(rules.Fact{"temperature": 35}, 20, 40)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events for an empty range, got %v", events)
+	}
+}
+
+func TestConditionFactsAreIndexed(t *testing.T) {
+	engine := NewEngine()
+	rule := rules.Rule{
+		Name:       "KnownPhone",
+		Conditions: rules.Conditions{All: []rules.Condition{{Facts: []string{"homePhone", "workPhone"}, Operator: "equal", Value: "555-0100"}}},
+		Event:      rules.Event{EventType: "known"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// A fact with only the second listed key still reaches the rule through the index
+	events, err := engine.Evaluate(rules.Fact{"workPhone": "555-0100"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "known" {
+		t.Errorf("Expected the known event, got %v", events)
+	}
+}
+
+func TestReportEventIDs(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportEventIDs = true
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "alert"},
+		},
+		{
+			Name:       "HumidRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "humidity", Operator: "greaterThan", Value: 80}}},
+			Event:      rules.Event{EventType: "alert"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	eventID := func(fact rules.Fact) string {
+		t.Helper()
+		events, err := engine.Evaluate(fact)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(events) != 1 || events[0].ID == "" {
+			t.Fatalf("Expected one event with an ID, got %v", events)
+		}
+		return events[0].ID
+	}
+
+	first := eventID(rules.Fact{"temperature": 35})
+	if second := eventID(rules.Fact{"temperature": 35.0}); second != first {
+		t.Errorf("Expected identical matches to get the same ID, got %s and %s", first, second)
+	}
+	if other := eventID(rules.Fact{"temperature": 36}); other == first {
+		t.Errorf("Expected a different triggering value to get a different ID")
+	}
+	if other := eventID(rules.Fact{"humidity": 85}); other == first {
+		t.Errorf("Expected a different rule to get a different ID")
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportRuleName = true
+	engine.SampleRate = 0.5
+	engine.Random = rand.New(rand.NewSource(1)).Float64
+	for i := 0; i < 8; i++ {
+		rule := rules.Rule{
+			Name:       fmt.Sprintf("Rule%d", i),
+			Priority:   8 - i,
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "alert"},
+		}
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var sampled []string
+	for _, event := range events {
+		sampled = append(sampled, event.RuleName)
+	}
+	expected := []string{"Rule4", "Rule3", "Rule1", "Rule0"}
+	if !reflect.DeepEqual(sampled, expected) {
+		t.Errorf("Expected sampled events %v, got %v", expected, sampled)
+	}
+
+	engine.SampleRate = 0
+	if events, _ := engine.Evaluate(rules.Fact{"temperature": 35}); len(events) != 8 {
+		t.Errorf("Expected every event without sampling, got %d", len(events))
+	}
+}
+
+func TestPatchRule(t *testing.T) {
+	engine := NewEngine()
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Priority:   10,
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	priority := 1
+	if err := engine.PatchRule("HotRule", RulePatch{Priority: &priority}); err != nil {
+		t.Fatalf("Failed to patch rule: %v", err)
+	}
+
+	patched, err := engine.GetRule("HotRule")
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	if patched.Priority != 1 {
+		t.Errorf("Expected priority 1, got %d", patched.Priority)
+	}
+	if !reflect.DeepEqual(patched.Conditions, rule.Conditions) || !reflect.DeepEqual(patched.Event, rule.Event) {
+		t.Errorf("Expected the conditions and event to be unchanged, got %+v", patched)
+	}
+	if indexed := engine.RuleIndex["temperature"]; len(indexed) != 1 || indexed[0].Priority != 1 {
+		t.Errorf("Expected the index to hold the patched rule, got %v", indexed)
+	}
+
+	if err := engine.PatchRule("HotRule", RulePatch{Event: &rules.Event{}}); err == nil {
+		t.Errorf("Expected an error for a patch leaving the rule without an event type")
+	}
+	var notExistErr *RuleDoesNotExistError
+	if err := engine.PatchRule("ColdRule", RulePatch{Priority: &priority}); !errors.As(err, &notExistErr) {
+		t.Errorf("Expected a RuleDoesNotExistError, got %v", err)
+	}
+}
+
+func TestJSONPointerFactsAreIndexedUnderTheirRoot(t *testing.T) {
+	engine := NewEngine()
+	rule := rules.Rule{
+		Name:       "BostonUser",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "/user/addresses/0/city", Operator: "equal", Value: "Boston"}}},
+		Event:      rules.Event{EventType: "boston"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if facts := engine.ReferencedFacts(); !reflect.DeepEqual(facts, []string{"user"}) {
+		t.Errorf("Expected the rule to reference the user fact, got %v", facts)
+	}
+
+	var fact rules.Fact
+	if err := json.Unmarshal([]byte(`{"user": {"addresses": [{"city": "Boston"}]}}`), &fact); err != nil {
+		t.Fatalf("Failed to decode fact: %v", err)
+	}
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "boston" {
+		t.Errorf("Expected the boston event, got %v", events)
+	}
+}
+
+func TestExprConditionIsIndexedUnderItsFacts(t *testing.T) {
+	engine := NewEngine()
+	engine.NormalizeKeys = true
+	rule := rules.Rule{
+		Name:       "Overweight",
+		Conditions: rules.Conditions{All: []rules.Condition{{Expr: "Weight / (Height * Height) > 25"}}},
+		Event:      rules.Event{EventType: "overweight"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if facts := engine.ReferencedFacts(); !reflect.DeepEqual(facts, []string{"height", "weight"}) {
+		t.Errorf("Expected the rule to reference the facts of its expression, got %v", facts)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"WEIGHT": 90, "height": 1.8})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "overweight" {
+		t.Errorf("Expected the overweight event, got %v", events)
+	}
+	if events, _ := engine.Evaluate(rules.Fact{"weight": 70, "height": 1.8}); len(events) != 0 {
+		t.Errorf("Expected no event for an expression that does not hold, got %v", events)
+	}
+}
+
+func TestGlobConditionMatchesFactKeys(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportFacts = true
+	rule := rules.Rule{
+		Name:       "HotMetric",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "metric.*", Glob: "any", Operator: "greaterThan", Value: 90}}},
+		Event:      rules.Event{EventType: "threshold"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"metric.cpu": 50, "metric.mem": 95})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Facts, []string{"metric.mem"}) {
+		t.Errorf("Expected one event for metric.mem, got %v", events)
+	}
+
+	if events, _ := engine.Evaluate(rules.Fact{"metric.cpu": 50, "metric.mem": 60}); len(events) != 0 {
+		t.Errorf("Expected no event when no metric exceeds the threshold, got %v", events)
+	}
+	if events, _ := engine.Evaluate(rules.Fact{"load": 95}); len(events) != 0 {
+		t.Errorf("Expected no event for a fact that does not match the pattern, got %v", events)
+	}
+
+	// Only the changed facts are matched against the pattern by EvaluateDelta
+	events, err = engine.EvaluateDelta(rules.Fact{"metric.cpu": 50}, rules.Fact{"metric.cpu": 97})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected one event for the changed metric, got %v", events)
+	}
+}
+
+func TestEngineClockExpiresRules(t *testing.T) {
+	engine := NewEngine()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	engine.Now = func() time.Time { return now }
+
+	expiresAt := now.Add(time.Hour)
+	rule := rules.Rule{
+		Name:       "Promotion",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "cartTotal", Operator: "greaterThan", Value: 50}}},
+		Event:      rules.Event{EventType: "discount"},
+		ExpiresAt:  &expiresAt,
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	events, err := engine.Evaluate(rules.Fact{"cartTotal": 80})
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Expected the promotion to fire before it expires, got %v", events)
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	events, err = engine.Evaluate(rules.Fact{"cartTotal": 80})
+	if err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected the promotion not to fire once the clock passes its expiry, got %v", events)
+	}
+
+	removed, err := engine.RemoveExpiredRules()
+	if err != nil {
+		t.Fatalf("Failed to remove expired rules: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"Promotion"}) {
+		t.Errorf("Expected the promotion to be removed, got %v", removed)
+	}
+}
+
+func TestConditionFragments(t *testing.T) {
+	engine := NewEngine()
+	engine.ConditionFragments = map[string][]rules.Condition{
+		"acmeUS": {
+			{Fact: "tenant", Operator: "equal", Value: "acme"},
+			{Fact: "region", Operator: "equal", Value: "us"},
+		},
+	}
+
+	for _, rule := range []rules.Rule{
+		{
+			Name:          "AcmeUSHot",
+			ConditionRefs: []string{"acmeUS"},
+			Conditions:    rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:         rules.Event{EventType: "hot"},
+		},
+		{
+			Name:          "AcmeUSHumid",
+			ConditionRefs: []string{"acmeUS"},
+			Conditions:    rules.Conditions{All: []rules.Condition{{Fact: "humidity", Operator: "greaterThan", Value: 80}}},
+			Event:         rules.Event{EventType: "humid"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	tests := []struct {
+		fact     rules.Fact
+		expected []string
+	}{
+		{rules.Fact{"tenant": "acme", "region": "us", "temperature": 35, "humidity": 90}, []string{"hot", "humid"}},
+		{rules.Fact{"tenant": "acme", "region": "us", "temperature": 35, "humidity": 50}, []string{"hot"}},
+		{rules.Fact{"tenant": "acme", "region": "eu", "temperature": 35, "humidity": 90}, []string{}},
+		{rules.Fact{"tenant": "globex", "region": "us", "temperature": 35, "humidity": 90}, []string{}},
+	}
+	for _, tt := range tests {
+		events, err := engine.Evaluate(tt.fact)
+		if err != nil {
+			t.Fatalf("Error evaluating fact: %v", err)
+		}
+		eventTypes := make([]string, 0, len(events))
+		for _, event := range events {
+			eventTypes = append(eventTypes, event.EventType)
+		}
+		if !reflect.DeepEqual(eventTypes, tt.expected) {
+			t.Errorf("For fact %v, expected events %v, got %v", tt.fact, tt.expected, eventTypes)
+		}
+	}
+
+	// The rules are indexed under the facts of the fragment too
+	if n := len(engine.RuleIndex["tenant"]); n != 2 {
+		t.Errorf("Expected both rules to be indexed under tenant, got %d", n)
+	}
+
+	err := engine.AddRule(rules.Rule{
+		Name:          "Unknown",
+		ConditionRefs: []string{"missing"},
+		Conditions:    rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:         rules.Event{EventType: "hot"},
+	})
+	if len(rules.ValidationErrors(err)) != 1 {
+		t.Errorf("Expected a validation error for the unknown fragment, got %v", err)
+	}
+}
+
+func TestRuleStats(t *testing.T) {
+	engine := NewEngine()
+	for _, rule := range []rules.Rule{
+		{
+			Name:       "HotRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+			Event:      rules.Event{EventType: "hot"},
+		},
+		{
+			Name:       "WarmRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 20}}},
+			Event:      rules.Event{EventType: "warm"},
+		},
+		{
+			Name:       "DeadRule",
+			Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 100}}},
+			Event:      rules.Event{EventType: "boiling"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	for _, temperature := range []int{35, 25, 10, 40} {
+		if _, err := engine.Evaluate(rules.Fact{"temperature": temperature}); err != nil {
+			t.Fatalf("Error evaluating fact: %v", err)
+		}
+	}
+	if _, err := engine.MatchedRuleNames(rules.Fact{"temperature": 50}); err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+
+	expected := map[string]uint64{"HotRule": 3, "WarmRule": 4, "DeadRule": 0}
+	if stats := engine.RuleStats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %v, got %v", expected, stats)
+	}
+
+	// Removing a rule discards its count, so a new rule with the same name starts from zero
+	if err := engine.RemoveRule("HotRule"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if stats := engine.RuleStats(); !reflect.DeepEqual(stats, map[string]uint64{"WarmRule": 4, "DeadRule": 0}) {
+		t.Errorf("Expected the removed rule to be left out, got %v", stats)
+	}
+	if err := engine.AddRule(rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if count := engine.RuleStats()["HotRule"]; count != 0 {
+		t.Errorf("Expected the re-added rule to start from 0, got %d", count)
+	}
+}
+
+func TestMutationsPublishSnapshot(t *testing.T) {
+	engine := NewEngine()
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "hot"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if s := engine.snapshot.Load(); s == nil || len(s.ruleIndex["temperature"]) != 1 {
+		t.Fatalf("Expected AddRule to publish a snapshot indexing the rule, got %v", s)
+	}
+
+	// Evaluations read the published snapshot, so they do not wait for a writer holding the lock
+	engine.mu.Lock()
+	done := make(chan []rules.Event)
+	go func() {
+		events, _ := engine.Evaluate(rules.Fact{"temperature": 35})
+		done <- events
+	}()
+	select {
+	case events := <-done:
+		if len(events) != 1 {
+			t.Errorf("Expected 1 event, got %v", events)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the evaluation not to wait for the engine lock")
+	}
+	engine.mu.Unlock()
+
+	if err := engine.RemoveRule("HotRule"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if s := engine.snapshot.Load(); len(s.ruleIndex["temperature"]) != 0 {
+		t.Errorf("Expected RemoveRule to publish a snapshot without the rule, got %v", s.ruleIndex)
+	}
+}
@@ -1,5 +1,28 @@
 package engine
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sentinel errors for the categories of the typed errors below, which match them with errors.Is
+// whatever the rule they name, as in `errors.Is(err, engine.ErrRuleDoesNotExist)`. The typed
+// errors carry the details, such as the rule name, and can be extracted with errors.As.
+var (
+	ErrRuleAlreadyExists   = errors.New("rule already exists")
+	ErrRuleDoesNotExist    = errors.New("rule does not exist")
+	ErrInvalidRule         = errors.New("invalid rule")
+	ErrEmptyRuleName       = errors.New("rule name cannot be empty")
+	ErrNilRuleConditions   = errors.New("rule conditions cannot be nil")
+	ErrTooManyRules        = errors.New("too many rules")
+	ErrDerivedFactFailed   = errors.New("failed to derive fact")
+	ErrEngineAlreadyExists = errors.New("engine already exists")
+	ErrUnexpectedFacts     = errors.New("unexpected facts")
+	ErrRulePanicked        = errors.New("rule panicked")
+)
+
 // The below code defines custom error types for different rule-related scenarios in Go.
 // @property {string} RuleName - The RuleName property is a string that represents the name of a rule.
 // It is used in the error messages to provide more information about the specific rule that caused the
@@ -12,6 +35,11 @@ func (e *RuleAlreadyExistsError) Error() string {
 	return "Rule already exists: " + e.RuleName
 }
 
+// Is reports whether target is ErrRuleAlreadyExists.
+func (e *RuleAlreadyExistsError) Is(target error) bool {
+	return target == ErrRuleAlreadyExists
+}
+
 type RuleDoesNotExistError struct {
 	RuleName string
 }
@@ -20,6 +48,11 @@ func (e *RuleDoesNotExistError) Error() string {
 	return "Rule does not exist: " + e.RuleName
 }
 
+// Is reports whether target is ErrRuleDoesNotExist.
+func (e *RuleDoesNotExistError) Is(target error) bool {
+	return target == ErrRuleDoesNotExist
+}
+
 type InvalidRuleError struct {
 	RuleName string
 }
@@ -28,12 +61,22 @@ func (e *InvalidRuleError) Error() string {
 	return "Invalid rule: " + e.RuleName
 }
 
+// Is reports whether target is ErrInvalidRule.
+func (e *InvalidRuleError) Is(target error) bool {
+	return target == ErrInvalidRule
+}
+
 type EmptyRuleNameError struct{}
 
 func (e *EmptyRuleNameError) Error() string {
 	return "rule name cannot be empty"
 }
 
+// Is reports whether target is ErrEmptyRuleName.
+func (e *EmptyRuleNameError) Is(target error) bool {
+	return target == ErrEmptyRuleName
+}
+
 type NilRuleConditionsError struct {
 	RuleName string
 }
@@ -41,3 +84,90 @@ type NilRuleConditionsError struct {
 func (e *NilRuleConditionsError) Error() string {
 	return "rule conditions cannot be nil for rule: " + e.RuleName
 }
+
+// Is reports whether target is ErrNilRuleConditions.
+func (e *NilRuleConditionsError) Is(target error) bool {
+	return target == ErrNilRuleConditions
+}
+
+// TooManyRulesError is returned when adding a rule to an engine that already holds MaxRules rules.
+type TooManyRulesError struct {
+	RuleName string
+	MaxRules int
+}
+
+func (e *TooManyRulesError) Error() string {
+	return "cannot add rule " + e.RuleName + ": the engine already holds the maximum of " + strconv.Itoa(e.MaxRules) + " rules"
+}
+
+// Is reports whether target is ErrTooManyRules.
+func (e *TooManyRulesError) Is(target error) bool {
+	return target == ErrTooManyRules
+}
+
+// DerivedFactError is returned when a function registered with AddDerivedFact fails to compute
+// its fact.
+type DerivedFactError struct {
+	Fact string
+	Err  error
+}
+
+func (e *DerivedFactError) Error() string {
+	return "failed to derive fact " + e.Fact + ": " + e.Err.Error()
+}
+
+// Is reports whether target is ErrDerivedFactFailed.
+func (e *DerivedFactError) Is(target error) bool {
+	return target == ErrDerivedFactFailed
+}
+
+func (e *DerivedFactError) Unwrap() error {
+	return e.Err
+}
+
+// EngineAlreadyExistsError is returned when adding an engine to a MultiEngine under a name that
+// is already taken.
+type EngineAlreadyExistsError struct {
+	EngineName string
+}
+
+func (e *EngineAlreadyExistsError) Error() string {
+	return "Engine already exists: " + e.EngineName
+}
+
+// Is reports whether target is ErrEngineAlreadyExists.
+func (e *EngineAlreadyExistsError) Is(target error) bool {
+	return target == ErrEngineAlreadyExists
+}
+
+// UnexpectedFactsError is returned when StrictFacts is set and an evaluated fact has keys that no
+// rule in the engine references.
+type UnexpectedFactsError struct {
+	Keys []string
+}
+
+func (e *UnexpectedFactsError) Error() string {
+	return "unexpected facts not referenced by any rule: " + strings.Join(e.Keys, ", ")
+}
+
+// Is reports whether target is ErrUnexpectedFacts.
+func (e *UnexpectedFactsError) Is(target error) bool {
+	return target == ErrUnexpectedFacts
+}
+
+// RulePanicError is returned when evaluating a rule panics. The panic is recovered, and the rule
+// is reported as not matching. Stack holds the stack trace of the panic, for debugging.
+type RulePanicError struct {
+	RuleName string
+	Value    interface{}
+	Stack    []byte
+}
+
+func (e *RulePanicError) Error() string {
+	return fmt.Sprintf("rule %s panicked: %v", e.RuleName, e.Value)
+}
+
+// Is reports whether target is ErrRulePanicked.
+func (e *RulePanicError) Is(target error) bool {
+	return target == ErrRulePanicked
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func TestErrorsMatchTheirSentinels(t *testing.T) {
+	engine := NewEngine()
+	rule := rules.Rule{
+		Name:       "HotRule",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:      rules.Event{EventType: "alert"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	err := engine.AddRule(rule)
+	if !errors.Is(err, ErrRuleAlreadyExists) || errors.Is(err, ErrRuleDoesNotExist) {
+		t.Errorf("Expected only ErrRuleAlreadyExists to match %v", err)
+	}
+	var existsErr *RuleAlreadyExistsError
+	if !errors.As(err, &existsErr) || existsErr.RuleName != "HotRule" {
+		t.Errorf("Expected a RuleAlreadyExistsError naming HotRule, got %v", err)
+	}
+
+	// The category matches whatever the rule, also through wrapping
+	err = fmt.Errorf("failed to remove rule: %w", engine.RemoveRule("ColdRule"))
+	if !errors.Is(err, ErrRuleDoesNotExist) {
+		t.Errorf("Expected ErrRuleDoesNotExist to match %v", err)
+	}
+	var notExistErr *RuleDoesNotExistError
+	if !errors.As(err, &notExistErr) || notExistErr.RuleName != "ColdRule" {
+		t.Errorf("Expected a RuleDoesNotExistError naming ColdRule, got %v", err)
+	}
+
+	engine.MaxRules = 1
+	other := rule
+	other.Name = "OtherRule"
+	if err := engine.AddRule(other); !errors.Is(err, ErrTooManyRules) {
+		t.Errorf("Expected ErrTooManyRules to match %v", err)
+	}
+
+	tests := []struct {
+		err      error
+		sentinel error
+	}{
+		{&InvalidRuleError{RuleName: "r"}, ErrInvalidRule},
+		{&EmptyRuleNameError{}, ErrEmptyRuleName},
+		{&NilRuleConditionsError{RuleName: "r"}, ErrNilRuleConditions},
+		{&DerivedFactError{Fact: "bmi", Err: errors.New("height is zero")}, ErrDerivedFactFailed},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.sentinel) {
+			t.Errorf("Expected %v to match %v", tt.err, tt.sentinel)
+		}
+	}
+}
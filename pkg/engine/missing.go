@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// EvaluateWithMissingFacts evaluates the input fact like Evaluate, and also returns, for each
+// rule evaluated, the sorted fact references its conditions read that the fact it was evaluated
+// against lacked, such as to explain why a rule did not fire when UnmatchedFactBehavior is
+// Ignore. Default, derived and resolved facts count as present. Rules that reference no missing
+// fact are left out, as are the rules that were not evaluated: disabled and expired rules, and
+// those indexed under none of the facts. Glob patterns are never reported.
+func (e *Engine) EvaluateWithMissingFacts(inputFact rules.Fact) ([]rules.Event, map[string][]string, error) {
+	missing := make(map[string][]string)
+	matchedRules, err := e.evaluateRules(inputFact, nil, nil, missing)
+	return e.sampleEvents(e.buildEvents(matchedRules)), missing, err
+}
+
+// missingFactReferences returns the sorted fact references read by the conditions of the rule
+// that the fact lacks.
+func missingFactReferences(rule *rules.Rule, fact rules.Fact) []string {
+	references := make(map[string]bool)
+	collectFactReferences(rule.Conditions.All, references)
+	collectFactReferences(rule.Conditions.Any, references)
+
+	var missing []string
+	for reference := range references {
+		if _, ok := fact.Lookup(reference); !ok {
+			missing = append(missing, reference)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// collectFactReferences adds the fact references read by the conditions, including nested ones,
+// to the references set: the facts named by Fact, Facts and ValueFact, as written, and the facts
+// read by Expr. The pattern of a glob condition names no fact, so it is left out.
+func collectFactReferences(conditions []rules.Condition, references map[string]bool) {
+	for _, condition := range conditions {
+		if condition.Fact != "" && condition.Glob == "" {
+			references[condition.Fact] = true
+		}
+		if condition.ValueFact != "" {
+			references[condition.ValueFact] = true
+		}
+		for _, factName := range condition.Facts {
+			references[factName] = true
+		}
+		for _, factName := range condition.ExprFacts() {
+			references[factName] = true
+		}
+		collectFactReferences(condition.All, references)
+		collectFactReferences(condition.Any, references)
+	}
+}
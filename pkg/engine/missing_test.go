@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func TestEvaluateWithMissingFacts(t *testing.T) {
+	engine := NewEngine()
+	engine.UnmatchedFactBehavior = "Ignore"
+
+	resolverCalls := make(map[string]int)
+	engine.FactResolver = func(key string) (interface{}, bool) {
+		resolverCalls[key]++
+		if key == "region" {
+			return "north", true
+		}
+		return nil, false
+	}
+
+	disabled := false
+	expired := time.Now().Add(-time.Hour)
+	for _, rule := range []rules.Rule{
+		{
+			Name: "HumidHeat",
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "humidity", Operator: "greaterThan", Value: 80},
+				{Fact: "region", Operator: "equal", Value: "north"},
+			}},
+			Event: rules.Event{EventType: "muggy"},
+		},
+		{
+			Name: "Heat",
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			}},
+			Event: rules.Event{EventType: "hot"},
+		},
+		{
+			Name:    "DisabledStorm",
+			Enabled: &disabled,
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "pressure", Operator: "lessThan", Value: 980},
+			}},
+			Event: rules.Event{EventType: "storm"},
+		},
+		{
+			Name:      "ExpiredFrost",
+			ExpiresAt: &expired,
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "temperature", Operator: "lessThan", Value: 0},
+				{Fact: "dewPoint", Operator: "lessThan", Value: 0},
+			}},
+			Event: rules.Event{EventType: "frost"},
+		},
+		{
+			Name: "Wind",
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "windSpeed", Operator: "greaterThan", Value: 50},
+			}},
+			Event: rules.Event{EventType: "windy"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule %s: %v", rule.Name, err)
+		}
+	}
+
+	events, missing, err := engine.EvaluateWithMissingFacts(rules.Fact{"temperature": 35})
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "hot" {
+		t.Errorf("expected only the hot event, got %v", events)
+	}
+
+	// Only the evaluated rules are reported, and the resolved region counts as present
+	expected := map[string][]string{"HumidHeat": {"humidity"}}
+	if !reflect.DeepEqual(missing, expected) {
+		t.Errorf("expected missing facts %v, got %v", expected, missing)
+	}
+	for key, calls := range resolverCalls {
+		if calls != 1 {
+			t.Errorf("expected %s to be resolved once, got %d calls", key, calls)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// MultiEngine evaluates facts across several independent engines, such as one per ruleset, and
+// merges their events. Each engine keeps its own rules, options and state, so rulesets with the
+// same rule names do not collide.
+type MultiEngine struct {
+	mu      sync.RWMutex
+	names   []string // engine names, in the order the engines were added
+	engines map[string]*Engine
+}
+
+// SourcedEvent is an event together with the name of the engine whose rule emitted it. In JSON,
+// the engine name is an `engine` field alongside the fields of the event.
+type SourcedEvent struct {
+	Engine string `json:"engine"`
+	rules.Event
+}
+
+// NewMultiEngine returns a MultiEngine without any engines.
+func NewMultiEngine() *MultiEngine {
+	return &MultiEngine{engines: make(map[string]*Engine)}
+}
+
+// AddEngine adds an engine under a name, which the events it emits are tagged with. It fails with
+// an EngineAlreadyExistsError if the name is taken.
+func (m *MultiEngine) AddEngine(name string, e *Engine) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.engines[name]; exists {
+		return &EngineAlreadyExistsError{EngineName: name}
+	}
+	m.engines[name] = e
+	m.names = append(m.names, name)
+	return nil
+}
+
+// RemoveEngine removes the named engine, and reports whether there was one.
+func (m *MultiEngine) RemoveEngine(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.engines[name]; !exists {
+		return false
+	}
+	delete(m.engines, name)
+	for i, existing := range m.names {
+		if existing == name {
+			m.names = append(m.names[:i:i], m.names[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Engine returns the named engine, or nil if there is none, for example to add rules to it.
+func (m *MultiEngine) Engine(name string) *Engine {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.engines[name]
+}
+
+// Names returns the names of the engines, in the order they were added.
+func (m *MultiEngine) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.names...)
+}
+
+// Evaluate evaluates the input fact with every engine, in the order they were added, and returns
+// their events tagged with the engine names. The events of each engine are ordered as by
+// Engine.Evaluate. An engine that fails does not stop the others: its errors are collected into
+// a multierror, prefixed with the engine name, and whatever events it returned are kept.
+func (m *MultiEngine) Evaluate(inputFact rules.Fact) ([]SourcedEvent, error) {
+	m.mu.RLock()
+	names := append([]string(nil), m.names...)
+	engines := make([]*Engine, len(names))
+	for i, name := range names {
+		engines[i] = m.engines[name]
+	}
+	m.mu.RUnlock()
+
+	events := make([]SourcedEvent, 0)
+	var errs *multierror.Error
+	for i, e := range engines {
+		engineEvents, err := e.Evaluate(inputFact)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("engine %s: %w", names[i], err))
+		}
+		for _, event := range engineEvents {
+			events = append(events, SourcedEvent{Engine: names[i], Event: event})
+		}
+	}
+	return events, errs.ErrorOrNil()
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func TestMultiEngineEvaluate(t *testing.T) {
+	fraud := NewEngine()
+	fraud.ReportRuleName = true
+	marketing := NewEngine()
+	marketing.ReportRuleName = true
+
+	// Both rulesets use the same rule name without colliding
+	if err := fraud.AddRule(rules.Rule{
+		Name:       "LargeOrder",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "amount", Operator: "greaterThan", Value: 1000}}},
+		Event:      rules.Event{EventType: "review"},
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := marketing.AddRule(rules.Rule{
+		Name:       "LargeOrder",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "amount", Operator: "greaterThan", Value: 500}}},
+		Event:      rules.Event{EventType: "coupon"},
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	multi := NewMultiEngine()
+	if err := multi.AddEngine("fraud", fraud); err != nil {
+		t.Fatalf("Failed to add engine: %v", err)
+	}
+	if err := multi.AddEngine("marketing", marketing); err != nil {
+		t.Fatalf("Failed to add engine: %v", err)
+	}
+	if err := multi.AddEngine("fraud", NewEngine()); !errors.Is(err, ErrEngineAlreadyExists) {
+		t.Errorf("Expected ErrEngineAlreadyExists for a taken name, got %v", err)
+	}
+
+	events, err := multi.Evaluate(rules.Fact{"amount": 1500})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []SourcedEvent{
+		{Engine: "fraud", Event: rules.Event{EventType: "review", RuleName: "LargeOrder"}},
+		{Engine: "marketing", Event: rules.Event{EventType: "coupon", RuleName: "LargeOrder"}},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected %v, got %v", expected, events)
+	}
+
+	data, err := json.Marshal(events[0])
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+	if !strings.Contains(string(data), `"engine":"fraud"`) || !strings.Contains(string(data), `"eventType":"review"`) {
+		t.Errorf("Expected the engine name alongside the event fields, got %s", data)
+	}
+
+	if !multi.RemoveEngine("fraud") || multi.RemoveEngine("fraud") {
+		t.Errorf("Expected the fraud engine to be removed once")
+	}
+	if names := multi.Names(); !reflect.DeepEqual(names, []string{"marketing"}) {
+		t.Errorf("Expected only the marketing engine to remain, got %v", names)
+	}
+}
+
+func TestMultiEngineEvaluateCollectsErrors(t *testing.T) {
+	failing := NewEngine()
+	failing.UnmatchedFactBehavior = "Error"
+	if err := failing.AddRule(rules.Rule{
+		Name: "NeedsCountry",
+		Conditions: rules.Conditions{All: []rules.Condition{
+			{Fact: "amount", Operator: "greaterThan", Value: 0},
+			{Fact: "country", Operator: "equal", Value: "NZ"},
+		}},
+		Event: rules.Event{EventType: "local"},
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	working := NewEngine()
+	if err := working.AddRule(rules.Rule{
+		Name:       "AnyOrder",
+		Conditions: rules.Conditions{All: []rules.Condition{{Fact: "amount", Operator: "greaterThan", Value: 0}}},
+		Event:      rules.Event{EventType: "order"},
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	multi := NewMultiEngine()
+	multi.AddEngine("failing", failing)
+	multi.AddEngine("working", working)
+
+	events, err := multi.Evaluate(rules.Fact{"amount": 10})
+	if err == nil || !strings.Contains(err.Error(), "engine failing") {
+		t.Errorf("Expected an error naming the failing engine, got %v", err)
+	}
+	if len(events) != 1 || events[0].Engine != "working" {
+		t.Errorf("Expected the event of the working engine, got %v", events)
+	}
+}
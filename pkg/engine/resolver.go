@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// factResolution supplies the facts that rules reference but an evaluated fact lacks, by calling
+// the engine's FactResolver. Each key is resolved at most once per evaluation, and the resolved
+// facts are added to a copy of the evaluated fact that is shared by the rules evaluated after.
+type factResolution struct {
+	resolver func(key string) (interface{}, bool)
+	fact     rules.Fact
+	copied   bool            // whether fact is a copy that resolved facts can be added to
+	tried    map[string]bool // keys already passed to the resolver
+	// missing, if not nil, collects the fact references of each rule that are still missing
+	// from the fact it is evaluated against, keyed by rule name.
+	missing map[string][]string
+}
+
+// newFactResolution returns a factResolution for the fact, using the engine's FactResolver.
+func (e *Engine) newFactResolution(fact rules.Fact) *factResolution {
+	return &factResolution{resolver: e.FactResolver, fact: fact}
+}
+
+// factFor returns the fact to evaluate the rule against: the evaluated fact, with the facts the
+// rule references but the fact lacks added if the resolver supplies them. Facts the resolver
+// does not supply stay missing and are handled by the engine's UnmatchedFactBehavior; they are
+// recorded for the rule if missing is set.
+func (r *factResolution) factFor(rule *rules.Rule) rules.Fact {
+	if r.resolver != nil {
+		r.resolve(rule)
+	}
+	if r.missing != nil {
+		if references := missingFactReferences(rule, r.fact); len(references) > 0 {
+			r.missing[rule.Name] = references
+		}
+	}
+	return r.fact
+}
+
+// resolve adds the facts the rule references but the fact lacks to the fact, for those the
+// resolver supplies.
+func (r *factResolution) resolve(rule *rules.Rule) {
+	factNames := make(map[string]bool)
+	collectResolvableFacts(rule.Conditions.All, factNames)
+	collectResolvableFacts(rule.Conditions.Any, factNames)
+	for factName := range factNames {
+		if _, ok := r.fact[factName]; ok || r.tried[factName] {
+			continue
+		}
+		if r.tried == nil {
+			r.tried = make(map[string]bool)
+		}
+		r.tried[factName] = true
+
+		value, ok := r.resolver(factName)
+		if !ok {
+			continue
+		}
+		if !r.copied {
+			r.fact = rules.MergeFacts(r.fact)
+			r.copied = true
+		}
+		r.fact[factName] = value
+	}
+}
+
+// collectResolvableFacts adds the names of the facts referenced by the conditions, including
+// nested ones, the facts listed by Facts or read by Expr and the facts named by ValueFact, to the
+// factNames set. A JSON Pointer reference adds the top-level fact it reads, which is the one
+// resolved. The pattern of a glob condition names no fact, so it is left out.
+func collectResolvableFacts(conditions []rules.Condition, factNames map[string]bool) {
+	for _, condition := range conditions {
+		if condition.Fact != "" && condition.Glob == "" {
+			factNames[rules.FactRoot(condition.Fact)] = true
+		}
+		if condition.ValueFact != "" {
+			factNames[rules.FactRoot(condition.ValueFact)] = true
+		}
+		for _, factName := range condition.Facts {
+			factNames[rules.FactRoot(factName)] = true
+		}
+		for _, factName := range condition.ExprFacts() {
+			factNames[factName] = true
+		}
+		collectResolvableFacts(condition.All, factNames)
+		collectResolvableFacts(condition.Any, factNames)
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func TestFactResolverSuppliesMissingFacts(t *testing.T) {
+	engine := NewEngine()
+	engine.ReportFacts = true
+	engine.UnmatchedFactBehavior = "Error"
+
+	var resolved []string
+	engine.FactResolver = func(key string) (interface{}, bool) {
+		resolved = append(resolved, key)
+		if key == "accountTier" {
+			return "gold", true
+		}
+		return nil, false
+	}
+
+	for _, rule := range []rules.Rule{
+		{
+			Name: "GoldLargeOrder",
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "orderTotal", Operator: "greaterThan", Value: 100},
+				{Fact: "accountTier", Operator: "equal", Value: "gold"},
+			}},
+			Event: rules.Event{EventType: "priorityShipping"},
+		},
+		{
+			Name: "GoldSmallOrder",
+			Conditions: rules.Conditions{All: []rules.Condition{
+				{Fact: "orderTotal", Operator: "lessThanOrEqual", Value: 100},
+				{Fact: "accountTier", Operator: "equal", Value: "gold"},
+			}},
+			Event: rules.Event{EventType: "freeGift"},
+		},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	fact := rules.Fact{"orderTotal": 150}
+	events, err := engine.Evaluate(fact)
+	if err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "priorityShipping" {
+		t.Fatalf("Expected the priorityShipping event, got %v", events)
+	}
+	if !reflect.DeepEqual(events[0].Values, []interface{}{150, "gold"}) {
+		t.Errorf("Expected the resolved fact to be reported, got %v", events[0].Values)
+	}
+	// Both rules reference the missing fact, but it is only resolved once
+	if !reflect.DeepEqual(resolved, []string{"accountTier"}) {
+		t.Errorf("Expected accountTier to be resolved once, got %v", resolved)
+	}
+	if _, ok := fact["accountTier"]; ok {
+		t.Errorf("Expected the evaluated fact to be unchanged, got %v", fact)
+	}
+
+	// Facts that are present are not resolved
+	resolved = nil
+	if _, err := engine.Evaluate(rules.Fact{"orderTotal": 150, "accountTier": "silver"}); err != nil {
+		t.Fatalf("Error evaluating fact: %v", err)
+	}
+	if resolved != nil {
+		t.Errorf("Expected no facts to be resolved, got %v", resolved)
+	}
+}
+
+func TestFactResolverFallsBackToUnmatchedFactBehavior(t *testing.T) {
+	engine := NewEngine()
+	engine.UnmatchedFactBehavior = "Error"
+	engine.FactResolver = func(key string) (interface{}, bool) { return nil, false }
+
+	rule := rules.Rule{
+		Name: "GoldLargeOrder",
+		Conditions: rules.Conditions{All: []rules.Condition{
+			{Fact: "orderTotal", Operator: "greaterThan", Value: 100},
+			{Fact: "accountTier", Operator: "equal", Value: "gold"},
+		}},
+		Event: rules.Event{EventType: "priorityShipping"},
+	}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	if _, err := engine.Evaluate(rules.Fact{"orderTotal": 150}); err == nil {
+		t.Errorf("Expected an error for the fact the resolver could not supply")
+	}
+}
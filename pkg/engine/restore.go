@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// engineState is the serialized state of an engine, as produced by Snapshot.
+type engineState struct {
+	Rules        []rules.Rule                        `json:"rules"`
+	RuleStates   map[string]savedRuleState           `json:"ruleStates,omitempty"`
+	TrendHistory map[string]map[string][]interface{} `json:"trendHistory,omitempty"`
+}
+
+// savedRuleState is the serialized form of a ruleState.
+type savedRuleState struct {
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+}
+
+// Snapshot serializes the state of the engine: its rules, including whether they are enabled,
+// the consecutive matches counted for stateful rules, and the recent values kept for trend
+// conditions. Restore rebuilds an engine from it. The engine's settings, such as ReportFacts or
+// Store, are configuration and are not included.
+//
+// The state is serialized as JSON, so, as with rules read from a BoltStore, numbers in condition
+// values and trend histories are restored as float64, except for integers of 2^53 or more, which
+// are kept exact as int64 as described for rules.ConvertNumbers.
+func (e *Engine) Snapshot() ([]byte, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	state := engineState{Rules: make([]rules.Rule, 0, len(e.Rules))}
+	for _, rule := range e.Rules {
+		state.Rules = append(state.Rules, *rule)
+	}
+	sort.Slice(state.Rules, func(i, j int) bool {
+		return state.Rules[i].Name < state.Rules[j].Name
+	})
+
+	if len(e.ruleStates) > 0 {
+		state.RuleStates = make(map[string]savedRuleState, len(e.ruleStates))
+		for name, ruleState := range e.ruleStates {
+			state.RuleStates[name] = savedRuleState{Count: ruleState.count, First: ruleState.first}
+		}
+	}
+	if len(e.trendHistory) > 0 {
+		state.TrendHistory = e.trendHistory
+	}
+
+	return json.Marshal(state)
+}
+
+// Restore replaces the rules and rule state of the engine with those serialized by Snapshot, and
+// rebuilds the rule index. The match counts reported by RuleStats start again from zero. The rules
+// are validated first, and checked for duplicate names and against MaxRules as AddRules does, and
+// the engine is left unchanged if the snapshot cannot be decoded or any check fails. The engine's
+// Store is not written to.
+func (e *Engine) Restore(data []byte) error {
+	var state engineState
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&state); err != nil {
+		return fmt.Errorf("failed to decode engine snapshot: %w", err)
+	}
+	for i := range state.Rules {
+		state.Rules[i].ConvertNumbers()
+	}
+	for _, windows := range state.TrendHistory {
+		for _, values := range windows {
+			rules.ConvertNumbers(values)
+		}
+	}
+
+	var result *multierror.Error
+	restored := make(map[string]bool, len(state.Rules))
+	for _, rule := range state.Rules {
+		if err := e.validateRule(rule); err != nil {
+			result = multierror.Append(result, err)
+		}
+		name := e.normalizeRuleName(rule.Name)
+		if restored[name] {
+			result = multierror.Append(result, &RuleAlreadyExistsError{RuleName: rule.Name})
+		}
+		restored[name] = true
+	}
+	if e.MaxRules > 0 && len(state.Rules) > e.MaxRules {
+		result = multierror.Append(result, &TooManyRulesError{RuleName: state.Rules[e.MaxRules].Name, MaxRules: e.MaxRules})
+	}
+	if err := result.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.unlock()
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	e.Rules = make(map[string]*rules.Rule, len(state.Rules))
+	e.RuleIndex = make(map[string][]*rules.Rule)
+	e.insertRules(state.Rules)
+
+	e.ruleStates = make(map[string]*ruleState, len(state.RuleStates))
+	for name, saved := range state.RuleStates {
+		e.ruleStates[name] = &ruleState{count: saved.Count, first: saved.First}
+	}
+	e.trendHistory = state.TrendHistory
+	if e.trendHistory == nil {
+		e.trendHistory = make(map[string]map[string][]interface{})
+	}
+	e.matchCounts = make(map[string]uint64)
+
+	return nil
+}
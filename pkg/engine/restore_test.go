@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+const restoreRulesJSON = `[
+	{
+		"name": "HotRule",
+		"priority": 1,
+		"conditions": {"all": [{"fact": "temperature", "operator": "greaterThan", "value": 30}]},
+		"event": {"eventType": "hot"}
+	},
+	{
+		"name": "SustainedHeatRule",
+		"conditions": {"all": [{"fact": "temperature", "operator": "greaterThan", "value": 30}]},
+		"event": {"eventType": "sustainedHeat"},
+		"consecutiveCount": 3
+	},
+	{
+		"name": "RisingRule",
+		"conditions": {"all": [{"fact": "temperature", "trend": "increasing", "window": 3}]},
+		"event": {"eventType": "rising"}
+	},
+	{
+		"name": "DoorRule",
+		"conditions": {"all": [{"fact": "doorOpen", "operator": "equal", "value": true}]},
+		"event": {"eventType": "door"},
+		"enabled": false
+	}
+]`
+
+// newRestoreTestEngine returns an engine with the rules of restoreRulesJSON.
+func newRestoreTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	var ruleList []rules.Rule
+	if err := json.Unmarshal([]byte(restoreRulesJSON), &ruleList); err != nil {
+		t.Fatalf("Failed to decode rules: %v", err)
+	}
+	engine := NewEngine()
+	for _, rule := range ruleList {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	return engine
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	original := newRestoreTestEngine(t)
+
+	// Build up consecutive match counts and trend history
+	for _, temperature := range []float64{31, 32} {
+		if _, err := original.Evaluate(rules.Fact{"temperature": temperature}); err != nil {
+			t.Fatalf("Failed to evaluate fact: %v", err)
+		}
+	}
+
+	data, err := original.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot engine: %v", err)
+	}
+	restored := NewEngine()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Failed to restore engine: %v", err)
+	}
+
+	if !reflect.DeepEqual(restored.ListRules(), original.ListRules()) {
+		t.Errorf("Expected the restored rules to equal the original rules")
+	}
+
+	// Both engines fire the stateful and trend rules on the next evaluation
+	for _, fact := range []rules.Fact{
+		{"temperature": 33.0},
+		{"temperature": 20.0},
+		{"doorOpen": true},
+	} {
+		originalEvents, err := original.Evaluate(fact)
+		if err != nil {
+			t.Fatalf("Failed to evaluate fact: %v", err)
+		}
+		restoredEvents, err := restored.Evaluate(fact)
+		if err != nil {
+			t.Fatalf("Failed to evaluate fact: %v", err)
+		}
+		if !reflect.DeepEqual(restoredEvents, originalEvents) {
+			t.Errorf("Expected the same events for %v, got %v and %v", fact, restoredEvents, originalEvents)
+		}
+		if fact["temperature"] == 33.0 && len(restoredEvents) != 3 {
+			t.Errorf("Expected the hot, sustained heat and rising rules to fire, got %v", restoredEvents)
+		}
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	engine := newRestoreTestEngine(t)
+
+	for _, data := range []string{
+		`not json`,
+		`{"rules": [{"name": "BadRule", "conditions": {"all": [{"fact": "a", "operator": "hotterThan", "value": 1}]}, "event": {"eventType": "bad"}}]}`,
+	} {
+		if err := engine.Restore([]byte(data)); err == nil {
+			t.Errorf("Expected an error restoring %s", data)
+		}
+	}
+
+	if len(engine.ListRules()) != 4 {
+		t.Errorf("Expected the engine to be unchanged, got %v", engine.ListRules())
+	}
+}
+
+func TestRestoreChecksRuleNamesAndMaxRules(t *testing.T) {
+	engine := newRestoreTestEngine(t)
+	engine.NormalizeRuleNames = true
+
+	duplicate := `{"rules": [
+		{"name": "HotRule", "conditions": {"all": [{"fact": "a", "operator": "equal", "value": 1}]}, "event": {"eventType": "a"}},
+		{"name": "HotRule ", "conditions": {"all": [{"fact": "b", "operator": "equal", "value": 1}]}, "event": {"eventType": "b"}}
+	]}`
+	var existsErr *RuleAlreadyExistsError
+	if err := engine.Restore([]byte(duplicate)); !errors.As(err, &existsErr) || existsErr.RuleName != "HotRule " {
+		t.Errorf("Expected a RuleAlreadyExistsError for HotRule, got %v", err)
+	}
+
+	data, err := engine.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot engine: %v", err)
+	}
+	limited := NewEngine()
+	limited.MaxRules = 3
+	var tooManyErr *TooManyRulesError
+	if err := limited.Restore(data); !errors.As(err, &tooManyErr) {
+		t.Errorf("Expected a TooManyRulesError, got %v", err)
+	}
+	if len(limited.ListRules()) != 0 || len(engine.ListRules()) != 4 {
+		t.Errorf("Expected the engines to be unchanged, got %v and %v", limited.ListRules(), engine.ListRules())
+	}
+}
+
+func TestRestoreResetsMatchCounts(t *testing.T) {
+	engine := newRestoreTestEngine(t)
+	data, err := engine.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot engine: %v", err)
+	}
+
+	if _, err := engine.Evaluate(rules.Fact{"temperature": 35.0}); err != nil {
+		t.Fatalf("Failed to evaluate fact: %v", err)
+	}
+	if stats := engine.RuleStats(); stats["HotRule"] != 1 {
+		t.Fatalf("Expected HotRule to have matched once, got %v", stats)
+	}
+
+	if err := engine.Restore(data); err != nil {
+		t.Fatalf("Failed to restore engine: %v", err)
+	}
+	for name, count := range engine.RuleStats() {
+		if count != 0 {
+			t.Errorf("Expected the match count of %s to be reset, got %d", name, count)
+		}
+	}
+}
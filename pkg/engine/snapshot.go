@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// snapshot is an immutable copy of the rule index used by evaluations. It is never modified
+// once it has been published, so it can be read without holding the engine lock.
+type snapshot struct {
+	ruleIndex map[string][]*rules.Rule
+	// globs lists the patterns of the glob conditions, which the rules holding them are indexed
+	// under, in order.
+	globs []string
+	// factKeys holds the fact keys that StrictFacts accepts: the top-level facts read by the
+	// conditions of every rule, disabled ones included, and the facts their events include.
+	factKeys map[string]bool
+	// keyGlobs lists, in order, the patterns of the glob conditions of every rule, disabled ones
+	// included, whose matching keys StrictFacts accepts as well.
+	keyGlobs []string
+}
+
+// newSnapshot copies the rule index into a new snapshot, along with the fact keys accepted for
+// the rules in ruleSet. The slices are copied as well, since the index updates them in place.
+func newSnapshot(ruleIndex map[string][]*rules.Rule, ruleSet map[string]*rules.Rule) *snapshot {
+	index := make(map[string][]*rules.Rule, len(ruleIndex))
+	globs := make(map[string]bool)
+	for factName, matchingRules := range ruleIndex {
+		index[factName] = append([]*rules.Rule(nil), matchingRules...)
+		for _, rule := range matchingRules {
+			collectGlobs(rule.Conditions.All, globs)
+			collectGlobs(rule.Conditions.Any, globs)
+		}
+	}
+
+	s := &snapshot{ruleIndex: index}
+	for pattern := range globs {
+		s.globs = append(s.globs, pattern)
+	}
+	sort.Strings(s.globs)
+	s.factKeys, s.keyGlobs = strictFactKeys(ruleSet)
+	return s
+}
+
+// strictFactKeys returns the fact keys read by the rules, and the sorted patterns of their glob
+// conditions, for StrictFacts. The keys are the facts a FactResolver would be asked for, and the
+// facts listed by the IncludeFacts of their events.
+func strictFactKeys(ruleSet map[string]*rules.Rule) (map[string]bool, []string) {
+	factKeys := make(map[string]bool)
+	globs := make(map[string]bool)
+	for _, rule := range ruleSet {
+		collectResolvableFacts(rule.Conditions.All, factKeys)
+		collectResolvableFacts(rule.Conditions.Any, factKeys)
+		collectGlobs(rule.Conditions.All, globs)
+		collectGlobs(rule.Conditions.Any, globs)
+		for _, event := range rule.AllEvents() {
+			for _, factName := range event.IncludeFacts {
+				factKeys[rules.FactRoot(factName)] = true
+			}
+		}
+	}
+
+	keyGlobs := make([]string, 0, len(globs))
+	for pattern := range globs {
+		keyGlobs = append(keyGlobs, pattern)
+	}
+	sort.Strings(keyGlobs)
+	return factKeys, keyGlobs
+}
+
+// collectGlobs adds the patterns of the glob conditions, including nested ones, to the globs set.
+func collectGlobs(conditions []rules.Condition, globs map[string]bool) {
+	for _, condition := range conditions {
+		if condition.Glob != "" {
+			globs[condition.Fact] = true
+		}
+		collectGlobs(condition.All, globs)
+		collectGlobs(condition.Any, globs)
+	}
+}
+
+// withGlobs returns the fact names followed by the glob patterns that match any of them, so that
+// the rules indexed under those patterns are evaluated as well. The fact names are returned
+// unchanged when no pattern matches.
+func (s *snapshot) withGlobs(factNames []string) []string {
+	var matched []string
+	for _, pattern := range s.globs {
+		for _, factName := range factNames {
+			if rules.MatchesGlob(pattern, factName) {
+				matched = append(matched, pattern)
+				break
+			}
+		}
+	}
+	if matched == nil {
+		return factNames
+	}
+	return append(append(make([]string, 0, len(factNames)+len(matched)), factNames...), matched...)
+}
+
+// loadSnapshot returns the current snapshot of the rule index. Mutations publish a new snapshot
+// before they release the engine lock, so loading it takes no lock at all. Only an engine whose
+// index has never been published, such as one that no rule has been added to, builds a snapshot
+// here, under the engine lock.
+func (e *Engine) loadSnapshot() *snapshot {
+	if s := e.snapshot.Load(); s != nil {
+		return s
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Another evaluation may have built the snapshot while this one waited for the lock
+	if s := e.snapshot.Load(); s != nil {
+		return s
+	}
+	s := newSnapshot(e.RuleIndex, e.Rules)
+	e.snapshot.Store(s)
+	return s
+}
+
+// markIndexChanged records that the rule index has changed, so that a new snapshot is published
+// when the engine lock is released by unlock. The caller must hold the engine lock.
+func (e *Engine) markIndexChanged() {
+	e.indexChanged = true
+}
+
+// unlock publishes a new snapshot of the rule index if it changed while the engine lock was held,
+// and then releases the lock. Building the snapshot in the mutating call, rather than in the next
+// evaluation, keeps evaluations from ever waiting for it. Every mutation releases the engine lock
+// through unlock, so that evaluations see its changes as a whole once it returns.
+func (e *Engine) unlock() {
+	if e.indexChanged {
+		e.snapshot.Store(newSnapshot(e.RuleIndex, e.Rules))
+		e.indexChanged = false
+	}
+	e.mu.Unlock()
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// newSnapshotBenchmarkEngine returns an engine with the given number of rules on the
+// temperature fact.
+func newSnapshotBenchmarkEngine(b *testing.B, numRules int) *Engine {
+	e := NewEngine()
+	for i := 0; i < numRules; i++ {
+		rule := rules.Rule{
+			Name:     fmt.Sprintf("Rule%d", i),
+			Priority: i,
+			Conditions: rules.Conditions{
+				All: []rules.Condition{
+					{
+						Fact:     "temperature",
+						Operator: "greaterThan",
+						Value:    i,
+					},
+				},
+			},
+			Event: rules.Event{EventType: "alert"},
+		}
+		if err := e.AddRule(rule); err != nil {
+			b.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	return e
+}
+
+// evaluateWithLocking looks up the rules for a fact using the previous strategy, which takes
+// the engine read lock for every fact in the input, and evaluates them.
+func evaluateWithLocking(e *Engine, inputFact rules.Fact) []rules.Event {
+	var matchingRules []*rules.Rule
+	for factName := range inputFact {
+		e.mu.RLock()
+		if rules, ok := e.RuleIndex[factName]; ok {
+			matchingRules = append(matchingRules, rules...)
+		}
+		e.mu.RUnlock()
+	}
+	return evaluateMatchingRules(matchingRules, inputFact)
+}
+
+// evaluateWithSnapshot looks up the rules for a fact in the current snapshot and evaluates them.
+func evaluateWithSnapshot(e *Engine, inputFact rules.Fact) []rules.Event {
+	var matchingRules []*rules.Rule
+	snapshot := e.loadSnapshot()
+	for factName := range inputFact {
+		if rules, ok := snapshot.ruleIndex[factName]; ok {
+			matchingRules = append(matchingRules, rules...)
+		}
+	}
+	return evaluateMatchingRules(matchingRules, inputFact)
+}
+
+// evaluateMatchingRules evaluates the rules found by a lookup strategy against the fact.
+func evaluateMatchingRules(matchingRules []*rules.Rule, inputFact rules.Fact) []rules.Event {
+	events := make([]rules.Event, 0)
+	for _, rule := range matchingRules {
+		ruleCopy := *rule
+		if satisfied, _ := ruleCopy.Evaluate(inputFact, false, "Ignore"); satisfied {
+			events = append(events, ruleCopy.Event)
+		}
+	}
+	return events
+}
+
+// runWithConcurrentWrites runs evaluate in parallel while another goroutine keeps disabling and
+// enabling a rule, and reports the read throughput.
+func runWithConcurrentWrites(b *testing.B, evaluate func(e *Engine, fact rules.Fact)) {
+	e := newSnapshotBenchmarkEngine(b, 100)
+	fact := rules.Fact{"temperature": 50, "humidity": 40, "pressure": 1013}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.DisableRule("Rule0")
+				e.EnableRule("Rule0")
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			evaluate(e, fact)
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
+
+// BenchmarkEvaluateConcurrentWrites compares the read throughput of the snapshot-based
+// evaluation with the per-fact locking lookup while rules are being modified concurrently.
+// Run it with -race to also check the read path for data races.
+func BenchmarkEvaluateConcurrentWrites(b *testing.B) {
+	b.Run("Snapshot", func(b *testing.B) {
+		runWithConcurrentWrites(b, func(e *Engine, fact rules.Fact) {
+			evaluateWithSnapshot(e, fact)
+		})
+	})
+	b.Run("Locking", func(b *testing.B) {
+		runWithConcurrentWrites(b, func(e *Engine, fact rules.Fact) {
+			evaluateWithLocking(e, fact)
+		})
+	})
+}
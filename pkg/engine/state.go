@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// ruleState holds the state kept across evaluations for a stateful rule.
+type ruleState struct {
+	count int       // number of consecutive evaluations in which the rule matched
+	first time.Time // time of the first match in the current run of consecutive matches
+}
+
+// updateRuleState records the result of evaluating a stateful rule and reports whether the rule
+// should fire. A rule fires once it has matched in `ConsecutiveCount` consecutive evaluations
+// (within `WithinDuration`, if set), and keeps firing for as long as the run of matches continues.
+// A non-matching evaluation resets the count. Evaluations in which the rule is not considered,
+// because none of the facts it references are present, leave the count unchanged.
+//
+// The state is guarded by its own mutex, so it is safe to call from concurrent Evaluate calls.
+// Concurrent evaluations are each counted, in the order in which they acquire the mutex.
+func (e *Engine) updateRuleState(rule *rules.Rule, satisfied bool) bool {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	if !satisfied {
+		delete(e.ruleStates, rule.Name)
+		return false
+	}
+
+	now := e.now()
+	state, ok := e.ruleStates[rule.Name]
+	if !ok {
+		state = &ruleState{}
+		e.ruleStates[rule.Name] = state
+	}
+	if state.count == 0 || (rule.WithinDuration > 0 && now.Sub(state.first) > rule.WithinDuration) {
+		state.count = 0
+		state.first = now
+	}
+	state.count++
+
+	return state.count >= rule.ConsecutiveCount
+}
+
+// trendSeries returns a copy of the history kept for the rule followed by the values of the
+// trend facts present in the fact, keeping at most the window of each fact. With record set, the
+// series is stored as the rule's new history; evaluations that must not change the state of the
+// rules only read it. A rule's history takes one value per trend fact per window slot, and is
+// only discarded when the rule is removed, updated or reset.
+func (e *Engine) trendSeries(ruleName string, windows map[string]int, fact rules.Fact, record bool) map[string][]interface{} {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	history, ok := e.trendHistory[ruleName]
+	if !ok && record {
+		history = make(map[string][]interface{}, len(windows))
+		e.trendHistory[ruleName] = history
+	}
+
+	series := make(map[string][]interface{}, len(windows))
+	for factName, window := range windows {
+		values := append([]interface{}(nil), history[factName]...)
+		if value, ok := fact.Lookup(factName); ok {
+			values = append(values, value)
+			if len(values) > window {
+				values = values[len(values)-window:]
+			}
+			if record {
+				history[factName] = append([]interface{}(nil), values...)
+			}
+		}
+		series[factName] = values
+	}
+	return series
+}
+
+// ResetRuleState discards the state kept for a rule: the consecutive matches counted for a
+// stateful rule, and the recent values kept for the trend conditions of a rule.
+func (e *Engine) ResetRuleState(ruleName string) {
+	e.resetRuleState(ruleName)
+}
+
+// resetRuleState discards the state kept for a rule.
+func (e *Engine) resetRuleState(ruleName string) {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	delete(e.ruleStates, ruleName)
+	delete(e.trendHistory, ruleName)
+}
+
+// countMatches adds one to the match count of each of the matched rules.
+func (e *Engine) countMatches(matchedRules []rules.Rule) {
+	if len(matchedRules) == 0 {
+		return
+	}
+
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	if e.matchCounts == nil {
+		e.matchCounts = make(map[string]uint64)
+	}
+	for _, rule := range matchedRules {
+		e.matchCounts[rule.Name]++
+	}
+}
+
+// forgetMatchCount discards the match count of a rule that has been removed.
+func (e *Engine) forgetMatchCount(ruleName string) {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	delete(e.matchCounts, ruleName)
+}
+
+// RuleStats returns the number of times each rule in the engine has matched in Evaluate,
+// EvaluateDelta and MatchedRuleNames, keyed by rule name. Rules that have never matched are
+// included with a count of zero, which makes dead rules easy to find. The counts of a rule are
+// discarded when it is removed, but kept when it is updated, enabled or disabled.
+func (e *Engine) RuleStats() map[string]uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	stats := make(map[string]uint64, len(e.Rules))
+	for name := range e.Rules {
+		stats[name] = e.matchCounts[name]
+	}
+	return stats
+}
@@ -0,0 +1,80 @@
+package facts
+
+import (
+	"context"
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// Source is implemented by anything that can supply facts to be evaluated, such as a sensor,
+// a message queue or an HTTP endpoint.
+type Source interface {
+	FetchFacts() (rules.Fact, error)
+}
+
+// Poller fetches facts from a `Source` on a fixed interval, evaluates them with a `FactHandler`
+// and dispatches the resulting events to a callback.
+type Poller struct {
+	source      Source
+	factHandler *FactHandler
+	interval    time.Duration
+	onEvents    func([]rules.Event)
+
+	// OnError, if set, is called with any error returned while fetching or evaluating facts.
+	// Polling continues after an error.
+	OnError func(error)
+}
+
+// NewPoller returns a new Poller that fetches facts from the source every interval, evaluates
+// them with the fact handler and passes any events triggered to onEvents.
+func NewPoller(source Source, factHandler *FactHandler, interval time.Duration, onEvents func([]rules.Event)) *Poller {
+	return &Poller{
+		source:      source,
+		factHandler: factHandler,
+		interval:    interval,
+		onEvents:    onEvents,
+	}
+}
+
+// Run polls the source until the context is cancelled, and then returns the context's error.
+// The first poll happens after one interval has elapsed.
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+// poll fetches and evaluates a single batch of facts.
+func (p *Poller) poll() {
+	fact, err := p.source.FetchFacts()
+	if err != nil {
+		p.reportError(err)
+		return
+	}
+
+	events, err := p.factHandler.HandleFact(fact)
+	if err != nil {
+		p.reportError(err)
+		return
+	}
+
+	if len(events) > 0 && p.onEvents != nil {
+		p.onEvents(events)
+	}
+}
+
+// reportError passes the error to the OnError callback, if one is set.
+func (p *Poller) reportError(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+	}
+}
@@ -0,0 +1,104 @@
+package facts
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// mockSource returns the facts it was created with, one per call, and an error once they
+// run out.
+type mockSource struct {
+	mu    sync.Mutex
+	facts []rules.Fact
+	calls int
+}
+
+func (m *mockSource) FetchFacts() (rules.Fact, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls++
+	if len(m.facts) == 0 {
+		return nil, errors.New("no more facts")
+	}
+	fact := m.facts[0]
+	m.facts = m.facts[1:]
+	return fact, nil
+}
+
+func TestPoller(t *testing.T) {
+	e := engine.NewEngine()
+	fh := NewFactHandler(e)
+
+	rule := rules.Rule{
+		Name:     "TestRule",
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			},
+		},
+		Event: rules.Event{EventType: "alert"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	source := &mockSource{facts: []rules.Fact{
+		{"temperature": 35},
+		{"temperature": 25},
+		{"temperature": 40},
+	}}
+
+	events := make(chan rules.Event, 10)
+	errs := make(chan error, 10)
+	poller := NewPoller(source, fh, time.Millisecond, func(triggered []rules.Event) {
+		for _, event := range triggered {
+			events <- event
+		}
+	})
+	poller.OnError = func(err error) {
+		errs <- err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- poller.Run(ctx)
+	}()
+
+	// Two of the three facts trigger the rule, and the poller reports an error once the
+	// source runs out of facts.
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-events:
+			if event.EventType != "alert" {
+				t.Errorf("Expected an alert event, got %s", event.EventType)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d", i+1)
+		}
+	}
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the source error")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Run to return context.Canceled, got %v", err)
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("Expected only two events, got an extra %v", event)
+	default:
+	}
+}
@@ -0,0 +1,90 @@
+package facts
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// OverflowPolicy decides what a Queue does with a fact when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// Block makes Enqueue wait until there is room in the buffer.
+	Block OverflowPolicy = iota
+	// Drop makes Enqueue discard the fact and count it as dropped.
+	Drop
+)
+
+// Queue is a bounded buffer between a goroutine reading facts, for example from a stream, and
+// the goroutine evaluating them. It keeps a slow evaluator or event consumer from causing
+// unbounded memory growth: once the buffer is full, new facts are either dropped or block the
+// reader, depending on the overflow policy.
+type Queue struct {
+	factHandler *FactHandler
+	facts       chan rules.Fact
+	policy      OverflowPolicy
+	onEvents    func([]rules.Event)
+	dropped     atomic.Uint64
+
+	// OnError, if set, is called with any error returned while evaluating a fact. Evaluation
+	// continues after an error.
+	OnError func(error)
+}
+
+// NewQueue returns a new Queue that buffers up to size facts, evaluates them with the fact
+// handler and passes any events triggered to onEvents.
+func NewQueue(factHandler *FactHandler, size int, policy OverflowPolicy, onEvents func([]rules.Event)) *Queue {
+	return &Queue{
+		factHandler: factHandler,
+		facts:       make(chan rules.Fact, size),
+		policy:      policy,
+		onEvents:    onEvents,
+	}
+}
+
+// Enqueue adds a fact to the queue. With the Drop policy it returns false if the buffer is full
+// and the fact was dropped. With the Block policy it waits for room in the buffer and always
+// returns true.
+func (q *Queue) Enqueue(fact rules.Fact) bool {
+	if q.policy == Block {
+		q.facts <- fact
+		return true
+	}
+
+	select {
+	case q.facts <- fact:
+		return true
+	default:
+		q.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped returns the number of facts dropped because the buffer was full.
+func (q *Queue) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Run evaluates the queued facts until the context is cancelled, and then returns the context's
+// error. It must only be called once at a time.
+func (q *Queue) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case fact := <-q.facts:
+			events, err := q.factHandler.HandleFact(fact)
+			if err != nil {
+				if q.OnError != nil {
+					q.OnError(err)
+				}
+				continue
+			}
+			if len(events) > 0 && q.onEvents != nil {
+				q.onEvents(events)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package facts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func newQueueTestHandler(t *testing.T) *FactHandler {
+	e := engine.NewEngine()
+	rule := rules.Rule{
+		Name: "TestRule",
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			},
+		},
+		Event: rules.Event{EventType: "alert"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	return NewFactHandler(e)
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	events := make(chan rules.Event, 10)
+	queue := NewQueue(newQueueTestHandler(t), 2, Drop, func(triggered []rules.Event) {
+		for _, event := range triggered {
+			events <- event
+		}
+	})
+
+	// Nothing is consuming the queue yet, so only the first two facts fit in the buffer
+	for i := 0; i < 5; i++ {
+		accepted := queue.Enqueue(rules.Fact{"temperature": 35})
+		if accepted != (i < 2) {
+			t.Errorf("Expected fact %d accepted to be %v, got %v", i, i < 2, accepted)
+		}
+	}
+	if dropped := queue.Dropped(); dropped != 3 {
+		t.Errorf("Expected 3 dropped facts, got %d", dropped)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d", i+1)
+		}
+	}
+}
+
+func TestQueueBlocksWhenFull(t *testing.T) {
+	events := make(chan rules.Event, 10)
+	queue := NewQueue(newQueueTestHandler(t), 1, Block, func(triggered []rules.Event) {
+		for _, event := range triggered {
+			events <- event
+		}
+	})
+
+	queue.Enqueue(rules.Fact{"temperature": 35})
+
+	enqueued := make(chan bool)
+	go func() {
+		enqueued <- queue.Enqueue(rules.Fact{"temperature": 40})
+	}()
+
+	select {
+	case <-enqueued:
+		t.Fatalf("Expected Enqueue to block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	select {
+	case accepted := <-enqueued:
+		if !accepted {
+			t.Errorf("Expected the blocked fact to be accepted")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for Enqueue to unblock")
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d", i+1)
+		}
+	}
+	if dropped := queue.Dropped(); dropped != 0 {
+		t.Errorf("Expected no dropped facts, got %d", dropped)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build proto
+
+package facts
+
+import (
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// FromStruct converts a protobuf Struct into a fact, so that facts received over gRPC can be
+// evaluated without a round trip through JSON. Nested structs become maps and lists become
+// slices, and numbers become float64 values, as they are when facts are decoded from JSON. A nil
+// Struct converts into an empty fact.
+//
+// FromStruct is only built with the `proto` build tag, so that programs that do not use protobuf
+// do not depend on it.
+func FromStruct(s *structpb.Struct) rules.Fact {
+	if s == nil {
+		return rules.Fact{}
+	}
+	return rules.Fact(s.AsMap())
+}
@@ -0,0 +1,65 @@
+//go:build proto
+
+package facts
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/engine"
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFromStruct(t *testing.T) {
+	s, err := structpb.NewStruct(map[string]interface{}{
+		"temperature": 35,
+		"device": map[string]interface{}{
+			"id":      "sensor-1",
+			"enabled": true,
+			"zones":   []interface{}{"north", 2},
+		},
+		"note": nil,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build struct: %v", err)
+	}
+
+	fact := FromStruct(s)
+	expected := rules.Fact{
+		"temperature": 35.0,
+		"device": map[string]interface{}{
+			"id":      "sensor-1",
+			"enabled": true,
+			"zones":   []interface{}{"north", 2.0},
+		},
+		"note": nil,
+	}
+	if !reflect.DeepEqual(fact, expected) {
+		t.Errorf("Expected %v, got %v", expected, fact)
+	}
+
+	e := engine.NewEngine()
+	rule := rules.Rule{
+		Name: "HotNorthSensor",
+		Conditions: rules.Conditions{All: []rules.Condition{
+			{Fact: "temperature", Operator: "greaterThan", Value: 30},
+			{Fact: "/device/zones/0", Operator: "equal", Value: "north"},
+		}},
+		Event: rules.Event{EventType: "alert"},
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	events, err := NewFactHandler(e).HandleFact(fact)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "alert" {
+		t.Errorf("Expected the alert event, got %v", events)
+	}
+
+	if fact := FromStruct(nil); fact == nil || len(fact) != 0 {
+		t.Errorf("Expected an empty fact for a nil struct, got %v", fact)
+	}
+}
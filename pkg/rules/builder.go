@@ -0,0 +1,43 @@
+package rules
+
+// Cond returns a simple condition comparing a fact with a value using an operator. Together with
+// All and Any, it builds condition trees in Go code without spelling out the nested structs:
+//
+//	rule.Conditions = rules.All(
+//		rules.Cond("temperature", "greaterThan", 30),
+//		rules.Any(
+//			rules.Cond("humidity", "greaterThan", 80),
+//			rules.Cond("windSpeed", "lessThan", 5),
+//		),
+//	).Conditions()
+func Cond(fact, operator string, value interface{}) Condition {
+	return Condition{Fact: fact, Operator: operator, Value: value}
+}
+
+// All returns a nested condition that holds when every one of the conditions holds.
+func All(conditions ...Condition) Condition {
+	return Condition{All: conditions}
+}
+
+// Any returns a nested condition that holds when at least one of the conditions holds.
+func Any(conditions ...Condition) Condition {
+	return Condition{Any: conditions}
+}
+
+// Conditions returns the condition as the top-level conditions of a rule. A condition built with
+// All or Any becomes the rule's `all` or `any` list, and any other condition becomes the only
+// condition in `all`.
+func (condition Condition) Conditions() Conditions {
+	if condition.isGroup() {
+		return Conditions{All: condition.All, Any: condition.Any}
+	}
+	return Conditions{All: []Condition{condition}}
+}
+
+// isGroup reports whether the condition only groups other conditions, as those built by All and
+// Any do, with no fact and no label, weight or optional flag that the top-level conditions of a
+// rule could not carry.
+func (condition Condition) isGroup() bool {
+	return condition.Fact == "" && condition.Label == "" && condition.Weight == 0 && !condition.Optional &&
+		(len(condition.All) > 0 || len(condition.Any) > 0)
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilderMatchesLiteralConditions(t *testing.T) {
+	built := Rule{
+		Name: "Uncomfortable",
+		Conditions: All(
+			Cond("temperature", "greaterThan", 30),
+			Any(
+				Cond("humidity", "greaterThan", 80),
+				All(
+					Cond("windSpeed", "lessThan", 5),
+					Cond("sky", "equal", "clear"),
+				),
+			),
+		).Conditions(),
+		Event: Event{EventType: "uncomfortable"},
+	}
+
+	literal := Rule{
+		Name: "Uncomfortable",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{
+					Any: []Condition{
+						{Fact: "humidity", Operator: "greaterThan", Value: 80},
+						{
+							All: []Condition{
+								{Fact: "windSpeed", Operator: "lessThan", Value: 5},
+								{Fact: "sky", Operator: "equal", Value: "clear"},
+							},
+						},
+					},
+				},
+			},
+		},
+		Event: Event{EventType: "uncomfortable"},
+	}
+
+	if !reflect.DeepEqual(built, literal) {
+		t.Errorf("Expected the built rule to equal the literal rule:\nbuilt:   %+v\nliteral: %+v", built, literal)
+	}
+	if err := built.Validate(); err != nil {
+		t.Errorf("Expected the built rule to be valid, got %v", err)
+	}
+
+	satisfied, err := built.Evaluate(Fact{"temperature": 35, "humidity": 50, "windSpeed": 2, "sky": "clear"}, false, "Ignore")
+	if err != nil {
+		t.Fatalf("Error evaluating rule: %v", err)
+	}
+	if !satisfied {
+		t.Errorf("Expected the built rule to be satisfied")
+	}
+}
+
+func TestBuilderConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  Conditions
+	}{
+		{
+			"Single condition",
+			Cond("temperature", "greaterThan", 30),
+			Conditions{All: []Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		},
+		{
+			"Any group",
+			Any(Cond("temperature", "greaterThan", 30), Cond("humidity", "greaterThan", 80)),
+			Conditions{Any: []Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "humidity", Operator: "greaterThan", Value: 80},
+			}},
+		},
+		{
+			"Labeled group stays nested",
+			Condition{Label: "hot", All: []Condition{Cond("temperature", "greaterThan", 30)}},
+			Conditions{All: []Condition{{Label: "hot", All: []Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if conditions := tt.condition.Conditions(); !reflect.DeepEqual(conditions, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, conditions)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package rules
+
+// Clone returns a deep copy of the rule. The conditions, events and any slice or map values they
+// hold are copied, so the clone can be changed without affecting the original rule.
+func (r Rule) Clone() Rule {
+	clone := r
+	clone.Conditions = Conditions{
+		All: cloneConditions(r.Conditions.All),
+		Any: cloneConditions(r.Conditions.Any),
+	}
+	clone.Event = r.Event.clone()
+	if r.Events != nil {
+		clone.Events = make([]Event, len(r.Events))
+		for i, event := range r.Events {
+			clone.Events[i] = event.clone()
+		}
+	}
+	if r.Enabled != nil {
+		enabled := *r.Enabled
+		clone.Enabled = &enabled
+	}
+	if r.ExpiresAt != nil {
+		expiresAt := *r.ExpiresAt
+		clone.ExpiresAt = &expiresAt
+	}
+	if r.ConditionRefs != nil {
+		clone.ConditionRefs = append([]string(nil), r.ConditionRefs...)
+	}
+	return clone
+}
+
+// WithName returns a copy of the rule with the given name.
+func (r Rule) WithName(name string) Rule {
+	clone := r.Clone()
+	clone.Name = name
+	return clone
+}
+
+// WithThreshold returns a copy of the rule in which every condition on the given fact, including
+// nested conditions, compares against the given value.
+func (r Rule) WithThreshold(fact string, value interface{}) Rule {
+	clone := r.Clone()
+	setThreshold(clone.Conditions.All, fact, value)
+	setThreshold(clone.Conditions.Any, fact, value)
+	return clone
+}
+
+// setThreshold sets the value of every condition on the given fact in the list of conditions.
+func setThreshold(conditions []Condition, fact string, value interface{}) {
+	for i := range conditions {
+		if conditions[i].Fact == fact || contains(conditions[i].Facts, fact) {
+			conditions[i].Value = cloneValue(value)
+		}
+		setThreshold(conditions[i].All, fact, value)
+		setThreshold(conditions[i].Any, fact, value)
+	}
+}
+
+// cloneConditions returns a deep copy of a list of conditions.
+func cloneConditions(conditions []Condition) []Condition {
+	if conditions == nil {
+		return nil
+	}
+	clone := make([]Condition, len(conditions))
+	for i, condition := range conditions {
+		clone[i] = condition
+		clone[i].Value = cloneValue(condition.Value)
+		if condition.Facts != nil {
+			clone[i].Facts = append([]string(nil), condition.Facts...)
+		}
+		clone[i].All = cloneConditions(condition.All)
+		clone[i].Any = cloneConditions(condition.Any)
+		if condition.Inner != nil {
+			inner := cloneConditions([]Condition{*condition.Inner})[0]
+			clone[i].Inner = &inner
+		}
+		if condition.Min != nil {
+			low := *condition.Min
+			clone[i].Min = &low
+		}
+		if condition.Max != nil {
+			high := *condition.Max
+			clone[i].Max = &high
+		}
+	}
+	return clone
+}
+
+// clone returns a deep copy of the event.
+func (e Event) clone() Event {
+	clone := e
+	clone.CustomProperty = cloneValue(e.CustomProperty)
+	if e.Facts != nil {
+		clone.Facts = append([]string(nil), e.Facts...)
+	}
+	if e.Paths != nil {
+		clone.Paths = append([]string(nil), e.Paths...)
+	}
+	if e.Labels != nil {
+		clone.Labels = append([]string(nil), e.Labels...)
+	}
+	if e.IncludeFacts != nil {
+		clone.IncludeFacts = append([]string(nil), e.IncludeFacts...)
+	}
+	if e.Values != nil {
+		clone.Values = make([]interface{}, len(e.Values))
+		for i, value := range e.Values {
+			clone.Values[i] = cloneValue(value)
+		}
+	}
+	return clone
+}
+
+// cloneValue returns a deep copy of the slices and maps produced by decoding JSON. Other values
+// are returned as they are.
+func cloneValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []interface{}:
+		clone := make([]interface{}, len(value))
+		for i, v := range value {
+			clone[i] = cloneValue(v)
+		}
+		return clone
+	case []string:
+		return append([]string(nil), value...)
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			clone[k] = cloneValue(v)
+		}
+		return clone
+	}
+	return value
+}
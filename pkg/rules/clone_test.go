@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRuleCloneIsIndependent(t *testing.T) {
+	enabled := true
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := Rule{
+		Name:     "TemperatureRule",
+		Priority: 1,
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{
+					Any: []Condition{
+						{Fact: "status", Operator: "setContainsAny", Value: []interface{}{"on", "idle"}},
+					},
+				},
+			},
+		},
+		Event: Event{
+			EventType:      "alert",
+			CustomProperty: map[string]interface{}{"channel": "email"},
+			Facts:          []string{"temperature"},
+		},
+		Events:    []Event{{EventType: "notify"}},
+		Enabled:   &enabled,
+		ExpiresAt: &expiresAt,
+	}
+	snapshot := original.Clone()
+
+	clone := original.Clone()
+	clone.Conditions.All[0].Value = 40
+	clone.Conditions.All[1].Any[0].Value.([]interface{})[0] = "off"
+	clone.Event.CustomProperty.(map[string]interface{})["channel"] = "sms"
+	clone.Event.Facts[0] = "humidity"
+	clone.Events[0].EventType = "page"
+	*clone.Enabled = false
+	*clone.ExpiresAt = clone.ExpiresAt.Add(time.Hour)
+
+	if !reflect.DeepEqual(original, snapshot) {
+		t.Errorf("Expected the original rule to be unchanged, got %+v", original)
+	}
+}
+
+func TestRuleWithNameAndThreshold(t *testing.T) {
+	base := Rule{
+		Name: "Temperature30",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Any: []Condition{{Fact: "temperature", Operator: "lessThan", Value: 30}}},
+				{Fact: "humidity", Operator: "greaterThan", Value: 30},
+			},
+		},
+		Event: Event{EventType: "alert"},
+	}
+
+	rule := base.WithName("Temperature40").WithThreshold("temperature", 40)
+
+	if rule.Name != "Temperature40" {
+		t.Errorf("Expected name Temperature40, got %s", rule.Name)
+	}
+	if rule.Conditions.All[0].Value != 40 || rule.Conditions.All[1].Any[0].Value != 40 {
+		t.Errorf("Expected every temperature condition to use the new threshold, got %+v", rule.Conditions)
+	}
+	if rule.Conditions.All[2].Value != 30 {
+		t.Errorf("Expected the humidity condition to be unchanged, got %v", rule.Conditions.All[2].Value)
+	}
+	if base.Name != "Temperature30" || base.Conditions.All[0].Value != 30 || base.Conditions.All[1].Any[0].Value != 30 {
+		t.Errorf("Expected the base rule to be unchanged, got %+v", base)
+	}
+}
@@ -0,0 +1,29 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// StableID returns an identifier for the event emitted by the named rule, computed as a hash of
+// the rule name, the event type and the event's triggering facts and values. Identical matches
+// get identical IDs, across evaluations and processes, so that downstream systems can deduplicate
+// them. Values are hashed by their JSON encoding, so numbers compare by value.
+func (e Event) StableID(ruleName string) string {
+	identity := struct {
+		RuleName  string        `json:"ruleName"`
+		EventType string        `json:"eventType"`
+		Facts     []string      `json:"facts"`
+		Values    []interface{} `json:"values"`
+	}{ruleName, e.EventType, e.Facts, e.Values}
+
+	data, err := json.Marshal(identity)
+	if err != nil {
+		// Values that cannot be encoded as JSON are hashed by their default formatting instead
+		data = []byte(fmt.Sprintf("%q %q %q %v", ruleName, e.EventType, e.Facts, e.Values))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
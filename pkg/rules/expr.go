@@ -0,0 +1,517 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// maxExprLength is the longest expression, in bytes, that an expression condition can have.
+const maxExprLength = 1024
+
+// maxExprDepth bounds how deeply the operations and parentheses of an expression can nest, so
+// that parsing and evaluating an expression cannot exhaust the stack.
+const maxExprDepth = 32
+
+// maxCachedExprs bounds the number of parsed expressions kept in the cache, as maxCachedPatterns
+// does for patterns.
+const maxCachedExprs = 1024
+
+// parsedExprs caches parsed expressions by their source. Like compiled patterns, they are cached
+// here rather than on the condition, which is copied by value.
+var (
+	parsedExprs    sync.Map // map[string]*parsedExpr
+	parsedExprsLen atomic.Int64
+)
+
+// parsedExpr is a parsed expression and the facts it reads, in the order they first appear.
+type parsedExpr struct {
+	root  exprNode
+	facts []string
+}
+
+// exprType is the type of the value of an expression: a number or a boolean.
+type exprType int
+
+const (
+	numberExpr exprType = iota
+	boolExpr
+)
+
+// exprNode is a node of a parsed expression. Expressions are type checked when they are parsed,
+// so evaluating a node yields a float64 for a number and a bool for a boolean.
+type exprNode interface {
+	eval(values map[string]float64) (interface{}, error)
+}
+
+// exprNumber is a number literal.
+type exprNumber float64
+
+func (n exprNumber) eval(map[string]float64) (interface{}, error) {
+	return float64(n), nil
+}
+
+// exprFact is a reference to a numeric fact.
+type exprFact string
+
+func (f exprFact) eval(values map[string]float64) (interface{}, error) {
+	return values[string(f)], nil
+}
+
+// exprUnary is a negation, `-` of a number or `!` of a boolean.
+type exprUnary struct {
+	op      string
+	operand exprNode
+}
+
+func (u *exprUnary) eval(values map[string]float64) (interface{}, error) {
+	operand, err := u.operand.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	if u.op == "!" {
+		return !operand.(bool), nil
+	}
+	return -operand.(float64), nil
+}
+
+// exprBinary is an arithmetic, comparison or logical operation.
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+func (b *exprBinary) eval(values map[string]float64) (interface{}, error) {
+	left, err := b.left.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	// The logical operators only evaluate their right operand when it decides the result
+	switch b.op {
+	case "&&":
+		if !left.(bool) {
+			return false, nil
+		}
+		return b.right.eval(values)
+	case "||":
+		if left.(bool) {
+			return true, nil
+		}
+		return b.right.eval(values)
+	}
+
+	right, err := b.right.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := left.(bool); ok {
+		if b.op == "==" {
+			return l == right.(bool), nil
+		}
+		return l != right.(bool), nil
+	}
+
+	l, r := left.(float64), right.(float64)
+	switch b.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	case "==":
+		return almostEqual(l, r), nil
+	case "!=":
+		return !almostEqual(l, r), nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", b.op)
+}
+
+// parseExpr returns the parsed form of the expression, parsing it on first use.
+func parseExpr(source string) (*parsedExpr, error) {
+	if expr, ok := parsedExprs.Load(source); ok {
+		return expr.(*parsedExpr), nil
+	}
+
+	expr, err := newExprParser(source).parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	if parsedExprsLen.Load() < maxCachedExprs {
+		if _, loaded := parsedExprs.LoadOrStore(source, expr); !loaded {
+			parsedExprsLen.Add(1)
+		}
+	}
+	return expr, nil
+}
+
+// exprToken is a token of an expression: a number, a fact name or an operator or parenthesis.
+type exprToken struct {
+	kind   byte // 'n' for a number, 'f' for a fact name and 'o' for an operator or parenthesis
+	text   string
+	number float64
+	offset int
+}
+
+// exprOperators lists the operators and parentheses of expressions, longest first, so that the
+// two-character operators are matched before their one-character prefixes.
+var exprOperators = []string{"<=", ">=", "==", "!=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")"}
+
+// exprParser is a recursive descent parser of expressions. It supports numbers, fact names,
+// parentheses, the arithmetic operators `+ - * / %`, the comparison operators `< <= > >= == !=`
+// and the logical operators `&& || !`, with the usual precedence. There are no function calls,
+// assignments or loops, and the length and nesting of expressions are bounded.
+type exprParser struct {
+	source string
+	tokens []exprToken
+	pos    int
+	depth  int
+	facts  []string
+	seen   map[string]bool
+}
+
+func newExprParser(source string) *exprParser {
+	return &exprParser{source: source, seen: make(map[string]bool)}
+}
+
+// parse parses the whole expression, which must evaluate to a boolean.
+func (p *exprParser) parse() (*parsedExpr, error) {
+	if len(p.source) > maxExprLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExprLength)
+	}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("expression is empty")
+	}
+
+	root, typ, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		return nil, fmt.Errorf("unexpected %q at offset %d", token.text, token.offset)
+	}
+	if typ != boolExpr {
+		return nil, fmt.Errorf("expression must be a comparison or a logical expression, not a number")
+	}
+	return &parsedExpr{root: root, facts: p.facts}, nil
+}
+
+// tokenize splits the source into tokens.
+func (p *exprParser) tokenize() error {
+	source := p.source
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c) || c == '.' && i+1 < len(source) && isDigit(source[i+1]):
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				for i < len(source) && isDigit(source[i]) {
+					i++
+				}
+			}
+			number, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q at offset %d", source[start:i], start)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'n', text: source[start:i], number: number, offset: start})
+		case isFactNameStart(c):
+			start := i
+			for i < len(source) && (isFactNameStart(source[i]) || isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'f', text: source[start:i], offset: start})
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if len(source)-i >= len(op) && source[i:i+len(op)] == op {
+					p.tokens = append(p.tokens, exprToken{kind: 'o', text: op, offset: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isFactNameStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// accept consumes the next token if it is one of the operators, and returns it.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != 'o' {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// parseBinary parses a left-associative chain of the operators, whose operands are parsed by
+// next and must have the operand type.
+func (p *exprParser) parseBinary(next func() (exprNode, exprType, error), operand, result exprType, ops ...string) (exprNode, exprType, error) {
+	left, typ, err := next()
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, typ, nil
+		}
+		right, rightType, err := next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ != operand || rightType != operand {
+			return nil, 0, fmt.Errorf("operator %s requires %s operands", op, typeName(operand))
+		}
+		left, typ = &exprBinary{op: op, left: left, right: right}, result
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, exprType, error) {
+	return p.parseBinary(p.parseAnd, boolExpr, boolExpr, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, exprType, error) {
+	return p.parseBinary(p.parseComparison, boolExpr, boolExpr, "&&")
+}
+
+// parseComparison parses a single comparison. Comparisons do not chain, so `a < b < c` is an
+// error rather than comparing a boolean with c.
+func (p *exprParser) parseComparison() (exprNode, exprType, error) {
+	left, typ, err := p.parseSum()
+	if err != nil {
+		return nil, 0, err
+	}
+	op, ok := p.accept("<=", ">=", "==", "!=", "<", ">")
+	if !ok {
+		return left, typ, nil
+	}
+	right, rightType, err := p.parseSum()
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case op != "==" && op != "!=" && (typ != numberExpr || rightType != numberExpr):
+		return nil, 0, fmt.Errorf("operator %s requires number operands", op)
+	case typ != rightType:
+		return nil, 0, fmt.Errorf("operator %s requires operands of the same type", op)
+	}
+	return &exprBinary{op: op, left: left, right: right}, boolExpr, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, exprType, error) {
+	return p.parseBinary(p.parseProduct, numberExpr, numberExpr, "+", "-")
+}
+
+func (p *exprParser) parseProduct() (exprNode, exprType, error) {
+	return p.parseBinary(p.parseUnary, numberExpr, numberExpr, "*", "/", "%")
+}
+
+// parseUnary parses a negated operand or a primary expression, tracking the nesting depth.
+func (p *exprParser) parseUnary() (exprNode, exprType, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExprDepth {
+		return nil, 0, fmt.Errorf("expression is nested more than %d levels deep", maxExprDepth)
+	}
+
+	if op, ok := p.accept("-", "!"); ok {
+		operand, typ, err := p.parseUnary()
+		if err != nil {
+			return nil, 0, err
+		}
+		if op == "-" && typ != numberExpr || op == "!" && typ != boolExpr {
+			return nil, 0, fmt.Errorf("operator %s cannot be applied to a %s", op, typeName(typ))
+		}
+		return &exprUnary{op: op, operand: operand}, typ, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a number, a fact name or a parenthesized expression.
+func (p *exprParser) parsePrimary() (exprNode, exprType, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, 0, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch {
+	case token.kind == 'n':
+		return exprNumber(token.number), numberExpr, nil
+	case token.kind == 'f':
+		if p.pos < len(p.tokens) && p.tokens[p.pos].text == "(" {
+			return nil, 0, fmt.Errorf("function calls are not supported, got %s(", token.text)
+		}
+		if !p.seen[token.text] {
+			p.seen[token.text] = true
+			p.facts = append(p.facts, token.text)
+		}
+		return exprFact(token.text), numberExpr, nil
+	case token.text == "(":
+		node, typ, err := p.parseOr()
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, 0, fmt.Errorf("missing ) for ( at offset %d", token.offset)
+		}
+		return node, typ, nil
+	}
+	return nil, 0, fmt.Errorf("unexpected %q at offset %d", token.text, token.offset)
+}
+
+func typeName(typ exprType) string {
+	if typ == boolExpr {
+		return "boolean"
+	}
+	return "number"
+}
+
+// ExprFacts returns the names of the facts read by the expression of an expression condition, in
+// the order they first appear. It returns nil if the condition has no expression, or if the
+// expression is invalid, which Validate reports.
+func (condition *Condition) ExprFacts() []string {
+	if condition.Expr == "" {
+		return nil
+	}
+	expr, err := parseExpr(condition.Expr)
+	if err != nil {
+		return nil
+	}
+	return expr.facts
+}
+
+// RenameExprFacts returns the expression with each fact name in it replaced by rename of it,
+// leaving the rest of its text, such as numbers, operators and spacing, unchanged. An expression
+// that cannot be split into tokens is returned unchanged, for validation to report.
+func RenameExprFacts(expr string, rename func(string) string) string {
+	p := newExprParser(expr)
+	if err := p.tokenize(); err != nil {
+		return expr
+	}
+
+	var renamed strings.Builder
+	end := 0
+	for _, token := range p.tokens {
+		if token.kind != 'f' {
+			continue
+		}
+		renamed.WriteString(expr[end:token.offset])
+		renamed.WriteString(rename(token.text))
+		end = token.offset + len(token.text)
+	}
+	renamed.WriteString(expr[end:])
+	return renamed.String()
+}
+
+// validateExpr validates an expression condition, appending any problems found to result.
+func (condition *Condition) validateExpr(result *multierror.Error, path string) *multierror.Error {
+	// Parsing the expression here also caches it for evaluation
+	if _, err := parseExpr(condition.Expr); err != nil {
+		result = multierror.Append(result, &ValidationError{Path: path + ".expr", Message: err.Error()})
+	}
+
+	if condition.Fact != "" || len(condition.Facts) > 0 {
+		result = multierror.Append(result, &ValidationError{Path: path + ".fact", Message: "expression conditions read their facts from expr and do not take a fact"})
+	}
+	if condition.Operator != "" {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".operator",
+			Message: fmt.Sprintf("expression conditions do not take an operator, got %s", condition.Operator),
+		})
+	}
+	if condition.Value != nil {
+		result = multierror.Append(result, &ValidationError{Path: path + ".value", Message: "expression conditions do not take a value"})
+	}
+	if condition.Aggregate != "" || condition.Trend != "" {
+		result = multierror.Append(result, &ValidationError{Path: path + ".expr", Message: "expr is not supported by aggregate and trend conditions"})
+	}
+
+	return result
+}
+
+// evaluateExpr evaluates an expression condition. Every fact the expression reads must be
+// present and numeric; a missing fact is handled according to the unmatched fact behavior. When
+// the expression holds, the facts it read are reported with their values.
+func (condition *Condition) evaluateExpr(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	expr, err := parseExpr(condition.Expr)
+	if err != nil {
+		return false, nil, nil, err
+	}
+
+	numbers := make(map[string]float64, len(expr.facts))
+	factValues := make([]interface{}, len(expr.facts))
+	for i, factName := range expr.facts {
+		factValue, ok := fact.Lookup(factName)
+		if !ok {
+			return false, nil, nil, unmatchedFact(factName, unmatchedFactBehavior)
+		}
+		number, err := factToFloat64(factName, factValue)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		numbers[factName] = number
+		factValues[i] = factValue
+	}
+
+	satisfied, err := expr.root.eval(numbers)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("failed to evaluate expression %q: %w", condition.Expr, err)
+	}
+	if !satisfied.(bool) {
+		return false, nil, nil, nil
+	}
+	return true, append([]string(nil), expr.facts...), factValues, nil
+}
@@ -0,0 +1,136 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateExpr(t *testing.T) {
+	tests := []struct {
+		expr     string
+		fact     Fact
+		expected bool
+	}{
+		{"weight / (height * height) > 25", Fact{"weight": 90, "height": 1.8}, true},
+		{"weight / (height * height) > 25", Fact{"weight": 70, "height": 1.8}, false},
+		{"a + b * 2 == 7", Fact{"a": 1, "b": 3}, true},
+		{"(a + b) * 2 == 7", Fact{"a": 1, "b": 3}, false},
+		{"-a >= -1 && !(b < 3)", Fact{"a": 1, "b": 3}, true},
+		{"a % 2 == 1 || b > 100", Fact{"a": 4, "b": "150"}, true},
+		{"1.5e1 != 15", Fact{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			condition := Condition{Expr: tt.expr}
+			satisfied, facts, values, err := condition.Evaluate(tt.fact, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if satisfied != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, satisfied)
+			}
+			if satisfied && len(facts) != len(values) {
+				t.Errorf("expected a value for each of the facts %v, got %v", facts, values)
+			}
+		})
+	}
+}
+
+func TestEvaluateExprReportsFacts(t *testing.T) {
+	condition := Condition{Expr: "weight / (height * height) > 25"}
+	_, facts, values, err := condition.Evaluate(Fact{"weight": 90, "height": 1.8}, "Ignore")
+	if err != nil {
+		t.Fatalf("Error evaluating condition: %v", err)
+	}
+	if !reflect.DeepEqual(facts, []string{"weight", "height"}) || !reflect.DeepEqual(values, []interface{}{90, 1.8}) {
+		t.Errorf("expected the facts read by the expression, got %v and %v", facts, values)
+	}
+}
+
+func TestEvaluateExprErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		fact    Fact
+		message string
+	}{
+		{"missing fact", "a > 1", Fact{}, "unmatched fact: a"},
+		{"non-numeric fact", "a > 1", Fact{"a": true}, "unsupported type"},
+		{"division by zero", "a / b > 1", Fact{"a": 1, "b": 0}, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Expr: tt.expr}
+			satisfied, _, _, err := condition.Evaluate(tt.fact, "Error")
+			if satisfied || err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected an error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestValidateExpr(t *testing.T) {
+	tests := []struct {
+		expr    string
+		message string
+	}{
+		{"weight / (height * height >", "unexpected end of expression"},
+		{"weight / (height * height) > 25)", `unexpected ")"`},
+		{"sqrt(a) > 1", "function calls are not supported"},
+		{"a + 1", "not a number"},
+		{"a > 1 + (b < 2)", "operator + requires number operands"},
+		{"a < b < c", `unexpected "<"`},
+		{"a = 1", "unexpected character '='"},
+		{strings.Repeat("(", 40) + "a > 1" + strings.Repeat(")", 40), "nested more than 32 levels"},
+		{"a > " + strings.Repeat("1+", 600) + "1", "longer than 1024 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule := Rule{
+				Name:       "ExprRule",
+				Conditions: Conditions{All: []Condition{{Expr: tt.expr}}},
+				Event:      Event{EventType: "alert"},
+			}
+			validationErrors := ValidationErrors(rule.Validate())
+			if len(validationErrors) != 1 {
+				t.Fatalf("expected one validation error, got %v", validationErrors)
+			}
+			if validationErrors[0].Path != "conditions.all[0].expr" || !strings.Contains(validationErrors[0].Message, tt.message) {
+				t.Errorf("expected an expr error containing %q, got %v", tt.message, validationErrors[0])
+			}
+		})
+	}
+
+	rule := Rule{
+		Name:       "ExprRule",
+		Conditions: Conditions{All: []Condition{{Expr: "a > 1", Fact: "a", Operator: "greaterThan", Value: 1}}},
+		Event:      Event{EventType: "alert"},
+	}
+	if validationErrors := ValidationErrors(rule.Validate()); len(validationErrors) != 3 {
+		t.Errorf("expected errors for the fact, operator and value of an expression condition, got %v", validationErrors)
+	}
+}
+
+func TestExprFacts(t *testing.T) {
+	condition := Condition{Expr: "sensor.weight / (height * height) > 25 && height > 0"}
+	if facts := condition.ExprFacts(); !reflect.DeepEqual(facts, []string{"sensor.weight", "height"}) {
+		t.Errorf("expected the facts in order of first appearance, got %v", facts)
+	}
+	if facts := (&Condition{Expr: "a >"}).ExprFacts(); facts != nil {
+		t.Errorf("expected no facts for an invalid expression, got %v", facts)
+	}
+}
+
+func TestRenameExprFacts(t *testing.T) {
+	renamed := RenameExprFacts("Sensor.Weight/(Height*Height) > 2.5E1 && HEIGHT>0", strings.ToLower)
+	if expected := "sensor.weight/(height*height) > 2.5E1 && height>0"; renamed != expected {
+		t.Errorf("expected %q, got %q", expected, renamed)
+	}
+	if renamed := RenameExprFacts("A > $", strings.ToLower); renamed != "A > $" {
+		t.Errorf("expected an invalid expression to be left unchanged, got %q", renamed)
+	}
+}
@@ -0,0 +1,43 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ExpandConditionRefs returns a copy of the rule in which the conditions of each fragment named by
+// ConditionRefs, in order, come before the rule's own `all` conditions, and ConditionRefs is
+// cleared. A fragment is a list of conditions that must all hold, such as `tenant = acme` and
+// `region = us`, shared by many rules. The fragment conditions are copied, so the rule does not
+// share them with the fragments or with other rules. A reference to a fragment that does not
+// exist is reported as a *ValidationError.
+func (r Rule) ExpandConditionRefs(fragments map[string][]Condition) (Rule, error) {
+	if len(r.ConditionRefs) == 0 {
+		return r, nil
+	}
+
+	var result *multierror.Error
+	var all []Condition
+	for i, ref := range r.ConditionRefs {
+		fragment, ok := fragments[ref]
+		if !ok {
+			result = multierror.Append(result, &ValidationError{
+				Path:    fmt.Sprintf("conditionRefs[%d]", i),
+				Message: fmt.Sprintf("unknown condition fragment: %s", ref),
+			})
+			continue
+		}
+		all = append(all, cloneConditions(fragment)...)
+	}
+	if err := result.ErrorOrNil(); err != nil {
+		return r, err
+	}
+
+	r.Conditions = Conditions{
+		All: append(all, r.Conditions.All...),
+		Any: r.Conditions.Any,
+	}
+	r.ConditionRefs = nil
+	return r, nil
+}
@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandConditionRefs(t *testing.T) {
+	fragments := map[string][]Condition{
+		"acmeUS": {
+			{Fact: "tenant", Operator: "equal", Value: "acme"},
+			{Fact: "region", Operator: "equal", Value: "us"},
+		},
+		"business": {{Fact: "plan", Operator: "equal", Value: "business"}},
+	}
+	rule := Rule{
+		Name:          "AcmeUSHot",
+		ConditionRefs: []string{"acmeUS", "business"},
+		Conditions:    Conditions{All: []Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}}},
+		Event:         Event{EventType: "hot"},
+	}
+
+	expanded, err := rule.ExpandConditionRefs(fragments)
+	if err != nil {
+		t.Fatalf("Failed to expand condition refs: %v", err)
+	}
+	expected := []Condition{
+		{Fact: "tenant", Operator: "equal", Value: "acme"},
+		{Fact: "region", Operator: "equal", Value: "us"},
+		{Fact: "plan", Operator: "equal", Value: "business"},
+		{Fact: "temperature", Operator: "greaterThan", Value: 30},
+	}
+	if !reflect.DeepEqual(expanded.Conditions.All, expected) {
+		t.Errorf("Expected conditions %v, got %v", expected, expanded.Conditions.All)
+	}
+	if expanded.ConditionRefs != nil {
+		t.Errorf("Expected the condition refs to be cleared, got %v", expanded.ConditionRefs)
+	}
+	if len(rule.Conditions.All) != 1 || len(rule.ConditionRefs) != 2 {
+		t.Errorf("Expected the original rule to be unchanged, got %+v", rule)
+	}
+
+	// The expanded conditions do not share the fragment's conditions
+	expanded.Conditions.All[0].Value = "other"
+	if fragments["acmeUS"][0].Value != "acme" {
+		t.Errorf("Expected the fragment to be unchanged, got %v", fragments["acmeUS"][0].Value)
+	}
+
+	rule.ConditionRefs = []string{"acmeUS", "missing"}
+	_, err = rule.ExpandConditionRefs(fragments)
+	validationErrors := ValidationErrors(err)
+	if len(validationErrors) != 1 || validationErrors[0].Path != "conditionRefs[1]" {
+		t.Errorf("Expected a validation error for conditionRefs[1], got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzConditionEvaluate feeds arbitrary operators, fact values and condition values, decoded from
+// JSON, to the condition evaluator and checks that it never panics. The fact value is also tried
+// with the typed slices and maps that Go callers pass in, which JSON decoding never produces.
+func FuzzConditionEvaluate(f *testing.F) {
+	values := []string{`null`, `1`, `-2.5`, `"1e3"`, `"text"`, `true`, `[]`, `[1, "a", null]`, `{}`, `{"a": [1, {"b": 2}]}`, `[100, 10]`}
+	for operator := range validOperators {
+		for i, value := range values {
+			f.Add(operator, values[(i+3)%len(values)], value, false)
+		}
+	}
+	f.Add("countWhere", `[{"status": "error"}, 1, null]`, `2`, true)
+	f.Add("unknown", `1`, `1`, false)
+
+	f.Fuzz(func(t *testing.T, operator, factJSON, valueJSON string, aggregate bool) {
+		var factValue, value interface{}
+		if json.Unmarshal([]byte(factJSON), &factValue) != nil || json.Unmarshal([]byte(valueJSON), &value) != nil {
+			t.Skip()
+		}
+
+		condition := Condition{Fact: "fact", Operator: operator, Value: value}
+		if aggregate {
+			condition = Condition{
+				Fact:      "fact",
+				Aggregate: "countWhere",
+				Inner:     &Condition{Fact: "status", Operator: operator, Value: value},
+				Operator:  "greaterThan",
+				Value:     1,
+			}
+		}
+		fact := Fact{"fact": factValue}
+		for _, typed := range typedValues(factValue) {
+			condition.Evaluate(Fact{"fact": typed}, "Ignore")
+		}
+
+		for _, behavior := range []string{"Ignore", "Error"} {
+			condition.Evaluate(fact, behavior)
+			condition.Evaluate(Fact{}, behavior)
+		}
+
+		rule := Rule{Name: "FuzzRule", Conditions: Conditions{All: []Condition{condition}}, Event: Event{EventType: "fuzz"}}
+		rule.Validate()
+		rule.Evaluate(fact, true, "Ignore")
+		rule.MatchedPaths(fact, "Ignore")
+		rule.Clone()
+	})
+}
+
+// typedValues returns the conversions of a decoded JSON value into typed Go slices and maps
+// whose elements all have the matching type.
+func typedValues(value interface{}) []interface{} {
+	var typed []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		strs, floats := make([]string, 0, len(v)), make([]float64, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+			if f, ok := item.(float64); ok {
+				floats = append(floats, f)
+			}
+		}
+		if len(strs) == len(v) {
+			typed = append(typed, strs)
+		}
+		if len(floats) == len(v) {
+			ints := make([]int, len(floats))
+			for i, f := range floats {
+				ints[i] = int(f)
+			}
+			typed = append(typed, floats, ints)
+		}
+	case map[string]interface{}:
+		strs := make(map[string]string, len(v))
+		for key, item := range v {
+			if s, ok := item.(string); ok {
+				strs[key] = s
+			}
+		}
+		if len(strs) == len(v) {
+			typed = append(typed, strs)
+		}
+	}
+	return typed
+}
@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// globModes is the set of ways a glob condition can combine the results for its matching facts.
+var globModes = map[string]bool{
+	"any": true,
+	"all": true,
+}
+
+// MatchesGlob reports whether the fact key matches the glob pattern of a glob condition, in the
+// syntax of path.Match. A malformed pattern matches no key.
+func MatchesGlob(pattern, key string) bool {
+	matched, err := path.Match(pattern, key)
+	return err == nil && matched
+}
+
+// validateGlob validates the glob mode and pattern of a glob condition, appending any problems
+// found to result. The operator and value are validated as for any other condition.
+func (condition *Condition) validateGlob(result *multierror.Error, path string) *multierror.Error {
+	if !globModes[condition.Glob] {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".glob",
+			Message: fmt.Sprintf("invalid glob mode: %s, expected any or all", condition.Glob),
+		})
+	}
+	if len(condition.Facts) > 0 || condition.Aggregate != "" || condition.Trend != "" {
+		result = multierror.Append(result, &ValidationError{Path: path + ".glob", Message: "glob is not supported with facts, aggregate and trend"})
+	}
+	if err := checkGlobPattern(condition.Fact); err != nil {
+		result = multierror.Append(result, &ValidationError{Path: path + ".fact", Message: fmt.Sprintf("invalid glob pattern %q: %v", condition.Fact, err)})
+	}
+	return result
+}
+
+// checkGlobPattern checks the syntax of a glob pattern. path.Match reports a malformed pattern
+// even when the pattern does not match the string, here the empty one.
+func checkGlobPattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	return err
+}
+
+// evaluateGlob evaluates a glob condition. The operator is applied to every fact whose key
+// matches the pattern, in key order. In "any" mode the condition holds if the operator holds for
+// one of them, and reports only that fact; in "all" mode it must hold for every one of them, and
+// all of them are reported. The unmatched fact behavior applies when no key matches.
+func (condition *Condition) evaluateGlob(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	var keys []string
+	for key := range fact {
+		if MatchesGlob(condition.Fact, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return false, nil, nil, unmatchedFact(condition.Fact, unmatchedFactBehavior)
+	}
+	sort.Strings(keys)
+
+	var facts []string
+	var values []interface{}
+	for _, key := range keys {
+		single := *condition
+		single.Fact = key
+		single.Glob = ""
+		satisfied, keyFacts, keyValues, err := single.evaluateSimpleCondition(fact, unmatchedFactBehavior)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		switch {
+		case satisfied && condition.Glob == "any":
+			return true, keyFacts, keyValues, nil
+		case !satisfied && condition.Glob == "all":
+			return false, nil, nil, nil
+		}
+		facts = append(facts, keyFacts...)
+		values = append(values, keyValues...)
+	}
+	if condition.Glob == "all" {
+		return true, facts, values, nil
+	}
+	return false, nil, nil, nil
+}
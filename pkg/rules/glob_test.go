@@ -0,0 +1,71 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateGlob(t *testing.T) {
+	fact := Fact{"metric.cpu": 95, "metric.mem": 40, "uptime": 1000}
+	tests := []struct {
+		name           string
+		glob           string
+		value          interface{}
+		expected       bool
+		expectedFacts  []string
+		expectedValues []interface{}
+	}{
+		{"any exceeds", "any", 90, true, []string{"metric.cpu"}, []interface{}{95}},
+		{"none exceeds", "any", 99, false, nil, nil},
+		{"not all exceed", "all", 90, false, nil, nil},
+		{"all exceed", "all", 30, true, []string{"metric.cpu", "metric.mem"}, []interface{}{95, 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "metric.*", Glob: tt.glob, Operator: "greaterThan", Value: tt.value}
+			satisfied, facts, values, err := condition.Evaluate(fact, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if satisfied != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, satisfied)
+			}
+			if !reflect.DeepEqual(facts, tt.expectedFacts) || !reflect.DeepEqual(values, tt.expectedValues) {
+				t.Errorf("expected facts %v and values %v, got %v and %v", tt.expectedFacts, tt.expectedValues, facts, values)
+			}
+		})
+	}
+
+	// With no matching key, the unmatched fact behavior applies
+	condition := Condition{Fact: "disk.*", Glob: "any", Operator: "greaterThan", Value: 90}
+	if _, _, _, err := condition.Evaluate(fact, "Error"); err == nil || !strings.Contains(err.Error(), "disk.*") {
+		t.Errorf("expected an unmatched fact error naming the pattern, got %v", err)
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	tests := []struct {
+		condition Condition
+		path      string
+	}{
+		{Condition{Fact: "metric.*", Glob: "some", Operator: "greaterThan", Value: 90}, "conditions.all[0].glob"},
+		{Condition{Fact: "metric.[", Glob: "any", Operator: "greaterThan", Value: 90}, "conditions.all[0].fact"},
+		{Condition{Facts: []string{"a*", "b*"}, Glob: "any", Operator: "greaterThan", Value: 90}, "conditions.all[0].glob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rule := Rule{
+				Name:       "GlobRule",
+				Conditions: Conditions{All: []Condition{tt.condition}},
+				Event:      Event{EventType: "alert"},
+			}
+			validationErrors := ValidationErrors(rule.Validate())
+			if len(validationErrors) != 1 || validationErrors[0].Path != tt.path {
+				t.Errorf("expected one error at %s, got %v", tt.path, validationErrors)
+			}
+		})
+	}
+}
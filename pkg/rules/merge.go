@@ -0,0 +1,43 @@
+package rules
+
+// MergeFacts combines facts from several sources into a new fact. When a key is present in more
+// than one fact, the value from the later fact wins. The facts passed in are not modified.
+func MergeFacts(facts ...Fact) Fact {
+	merged := make(Fact)
+	for _, fact := range facts {
+		for key, value := range fact {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// DeepMergeFacts combines facts like MergeFacts, except that when both values for a key are
+// objects they are merged recursively instead of the later one replacing the earlier one. The
+// facts passed in, and the objects nested in them, are not modified.
+func DeepMergeFacts(facts ...Fact) Fact {
+	merged := make(map[string]interface{})
+	for _, fact := range facts {
+		deepMerge(merged, fact)
+	}
+	return merged
+}
+
+// deepMerge merges src into dst, copying nested objects so that dst never shares them with src.
+func deepMerge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, ok := toMap(value)
+		if !ok {
+			dst[key] = value
+			continue
+		}
+
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			// dst only holds maps that it owns, so anything else is replaced by a copy
+			dstMap = make(map[string]interface{}, len(srcMap))
+			dst[key] = dstMap
+		}
+		deepMerge(dstMap, srcMap)
+	}
+}
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeFactsOverridesEarlierKeys(t *testing.T) {
+	first := Fact{"temperature": 20, "location": map[string]interface{}{"building": "A"}}
+	second := Fact{"temperature": 25, "humidity": 60}
+	third := Fact{"location": map[string]interface{}{"floor": 3}}
+
+	merged := MergeFacts(first, second, third)
+
+	expected := Fact{
+		"temperature": 25,
+		"humidity":    60,
+		"location":    map[string]interface{}{"floor": 3},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+	if first["temperature"] != 20 {
+		t.Errorf("Expected the input facts to be unchanged, got %v", first)
+	}
+}
+
+func TestDeepMergeFactsMergesNestedObjects(t *testing.T) {
+	first := Fact{
+		"temperature": 20,
+		"device": map[string]interface{}{
+			"type":     "thermostat",
+			"location": map[string]interface{}{"building": "A", "floor": 1},
+		},
+	}
+	second := Fact{
+		"temperature": 25,
+		"device": map[string]interface{}{
+			"firmware": "2.1",
+			"location": map[string]interface{}{"floor": 3},
+		},
+	}
+
+	merged := DeepMergeFacts(first, second)
+
+	expected := Fact{
+		"temperature": 25,
+		"device": map[string]interface{}{
+			"type":     "thermostat",
+			"firmware": "2.1",
+			"location": map[string]interface{}{"building": "A", "floor": 3},
+		},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+
+	// The nested objects of the inputs are not modified
+	location := first["device"].(map[string]interface{})["location"].(map[string]interface{})
+	if location["floor"] != 1 {
+		t.Errorf("Expected the input facts to be unchanged, got %v", first)
+	}
+
+	// An object replaces a scalar, and a scalar replaces an object
+	merged = DeepMergeFacts(Fact{"a": 1, "b": map[string]interface{}{"c": 1}}, Fact{"a": map[string]interface{}{"x": 1}, "b": 2})
+	expected = Fact{"a": map[string]interface{}{"x": 1}, "b": 2}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+}
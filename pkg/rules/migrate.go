@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CurrentSchemaVersion is the version of the rule format in which conditions are nested under
+// `all` and `any`. Version 1 is the legacy flat format, in which `conditions` is a list of
+// conditions combined by the rule's `logic`, `all` or `any`.
+const CurrentSchemaVersion = 2
+
+// MigrateFlat converts a legacy flat condition list to nested conditions. With logic `any`, in
+// any case, one of the conditions must hold; with any other logic, including none, all of them
+// must, as flat lists were conjunctions by default. The conditions are not copied.
+func MigrateFlat(old []Condition, logic string) Conditions {
+	if strings.EqualFold(logic, "any") {
+		return Conditions{Any: old}
+	}
+	return Conditions{All: old}
+}
+
+// UpgradeRuleJSON upgrades the JSON of a rule in an earlier schema version to the current one,
+// so that it can be decoded as a Rule. A rule is in the legacy flat format if its schemaVersion
+// is 1, or if it has none and its conditions are a list; its conditions are nested with
+// MigrateFlat, its logic field is removed and its schemaVersion set to CurrentSchemaVersion.
+// Rules in the current format are returned unchanged, and a schemaVersion newer than the current
+// one is an error.
+func UpgradeRuleJSON(data json.RawMessage) (json.RawMessage, error) {
+	var header struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		Conditions    json.RawMessage `json:"conditions"`
+		Logic         string          `json:"logic"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case header.SchemaVersion > CurrentSchemaVersion || header.SchemaVersion < 0:
+		return nil, fmt.Errorf("unsupported schema version %d, expected at most %d", header.SchemaVersion, CurrentSchemaVersion)
+	case header.SchemaVersion == 0 && !bytes.HasPrefix(bytes.TrimSpace(header.Conditions), []byte("[")),
+		header.SchemaVersion == CurrentSchemaVersion:
+		return data, nil
+	}
+
+	if header.Logic != "" && !strings.EqualFold(header.Logic, "all") && !strings.EqualFold(header.Logic, "any") {
+		return nil, fmt.Errorf("invalid logic: %s, expected all or any", header.Logic)
+	}
+	// The condition values are decoded as json.Number, so that they are encoded again unchanged
+	var flat []Condition
+	if len(header.Conditions) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(header.Conditions))
+		decoder.UseNumber()
+		if err := decoder.Decode(&flat); err != nil {
+			return nil, fmt.Errorf("invalid flat conditions: %w", err)
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	conditions, err := json.Marshal(MigrateFlat(flat, header.Logic))
+	if err != nil {
+		return nil, err
+	}
+	fields["conditions"] = conditions
+	fields["schemaVersion"] = json.RawMessage(fmt.Sprint(CurrentSchemaVersion))
+	delete(fields, "logic")
+	return json.Marshal(fields)
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMigrateFlat(t *testing.T) {
+	flat := []Condition{
+		{Fact: "temperature", Operator: "greaterThan", Value: 30},
+		{Fact: "humidity", Operator: "lessThan", Value: 40},
+	}
+	facts := []Fact{
+		{"temperature": 35, "humidity": 20},
+		{"temperature": 35, "humidity": 60},
+		{"temperature": 20, "humidity": 20},
+		{"temperature": 20, "humidity": 60},
+	}
+
+	for _, logic := range []string{"all", "any", "ANY", ""} {
+		t.Run(logic, func(t *testing.T) {
+			rule := Rule{Name: "Migrated", Conditions: MigrateFlat(flat, logic), Event: Event{EventType: "alert"}}
+			for _, fact := range facts {
+				// The legacy flat format combined the conditions with the logic of the rule
+				expected := !strings.EqualFold(logic, "any")
+				for _, condition := range flat {
+					satisfied, _, _, err := condition.Evaluate(fact, "Error")
+					if err != nil {
+						t.Fatalf("Error evaluating condition: %v", err)
+					}
+					if strings.EqualFold(logic, "any") {
+						expected = expected || satisfied
+					} else {
+						expected = expected && satisfied
+					}
+				}
+
+				satisfied, err := rule.Evaluate(fact, false, "Error")
+				if err != nil {
+					t.Fatalf("Error evaluating rule: %v", err)
+				}
+				if satisfied != expected {
+					t.Errorf("expected %v for %v, got %v", expected, fact, satisfied)
+				}
+			}
+		})
+	}
+}
+
+func TestUpgradeRuleJSON(t *testing.T) {
+	legacy := `{"name": "Legacy", "logic": "any", "conditions": [{"fact": "temperature", "operator": "greaterThan", "value": 30}], "event": {"eventType": "alert"}}`
+	upgraded, err := UpgradeRuleJSON(json.RawMessage(legacy))
+	if err != nil {
+		t.Fatalf("Error upgrading rule: %v", err)
+	}
+	var rule Rule
+	if err := json.Unmarshal(upgraded, &rule); err != nil {
+		t.Fatalf("Error decoding upgraded rule: %v", err)
+	}
+	if rule.SchemaVersion != CurrentSchemaVersion || len(rule.Conditions.All) != 0 || len(rule.Conditions.Any) != 1 {
+		t.Errorf("expected a current rule with one any condition, got %+v", rule)
+	}
+	if strings.Contains(string(upgraded), "logic") {
+		t.Errorf("expected the logic field to be removed, got %s", upgraded)
+	}
+
+	current := `{"name": "Current", "conditions": {"all": []}, "event": {"eventType": "alert"}}`
+	if unchanged, err := UpgradeRuleJSON(json.RawMessage(current)); err != nil || string(unchanged) != current {
+		t.Errorf("expected a current rule to be unchanged, got %s and %v", unchanged, err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		message string
+	}{
+		{"newer version", `{"schemaVersion": 3, "conditions": {}}`, "unsupported schema version 3"},
+		{"invalid logic", `{"logic": "xor", "conditions": []}`, "invalid logic: xor"},
+		{"nested version 1", `{"schemaVersion": 1, "conditions": {"all": []}}`, "invalid flat conditions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UpgradeRuleJSON(json.RawMessage(tt.rule)); err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected an error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
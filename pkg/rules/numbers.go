@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// maxExactInteger is 2^53, from which on a float64 no longer holds every integer exactly.
+const maxExactInteger = 1 << 53
+
+// ConvertNumbers returns the value, as decoded by a json.Decoder with UseNumber, with every
+// json.Number in it, including in nested maps and slices, replaced by a Go number. An integer
+// of at least 2^53 in magnitude, which a float64 may not hold exactly, becomes an int64, so that
+// it is compared exactly; any other number becomes a float64, as json.Unmarshal would decode it. Maps and slices
+// are changed in place.
+func ConvertNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil && (i >= maxExactInteger || i <= -maxExactInteger) {
+			return i
+		}
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = ConvertNumbers(element)
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = ConvertNumbers(element)
+		}
+	}
+	return value
+}
+
+// ConvertNumbers replaces the json.Number values of a fact decoded with UseNumber, as the
+// ConvertNumbers function does.
+func (f Fact) ConvertNumbers() {
+	for key, value := range f {
+		f[key] = ConvertNumbers(value)
+	}
+}
+
+// ConvertNumbers replaces the json.Number values in the condition values and custom properties
+// of a rule decoded with UseNumber, as the ConvertNumbers function does.
+func (r *Rule) ConvertNumbers() {
+	for i := range r.Conditions.All {
+		r.Conditions.All[i].convertNumbers()
+	}
+	for i := range r.Conditions.Any {
+		r.Conditions.Any[i].convertNumbers()
+	}
+	r.Event.ConvertNumbers()
+	for i := range r.Events {
+		r.Events[i].ConvertNumbers()
+	}
+}
+
+// ConvertNumbers replaces the json.Number values in the custom property of an event decoded with
+// UseNumber, as the ConvertNumbers function does.
+func (e *Event) ConvertNumbers() {
+	e.CustomProperty = ConvertNumbers(e.CustomProperty)
+}
+
+// convertNumbers replaces the json.Number values of the condition, including those of its nested
+// and inner conditions.
+func (condition *Condition) convertNumbers() {
+	condition.Value = ConvertNumbers(condition.Value)
+	if condition.Inner != nil {
+		condition.Inner.convertNumbers()
+	}
+	for i := range condition.All {
+		condition.All[i].convertNumbers()
+	}
+	for i := range condition.Any {
+		condition.Any[i].convertNumbers()
+	}
+}
+
+// UnmarshalRule decodes the JSON of a rule like json.Unmarshal, but keeps integers of 2^53 or more
+// in its condition values exact, as described for ConvertNumbers.
+func UnmarshalRule(data []byte, rule *Rule) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(rule); err != nil {
+		return err
+	}
+	rule.ConvertNumbers()
+	return nil
+}
@@ -0,0 +1,50 @@
+package rules
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestConvertNumbers(t *testing.T) {
+	value := map[string]interface{}{
+		"small":  json.Number("42"),
+		"float":  json.Number("1.5"),
+		"large":  json.Number("9007199254740993"),
+		"nested": []interface{}{json.Number("-9007199254740993"), "text"},
+	}
+	expected := map[string]interface{}{
+		"small":  42.0,
+		"float":  1.5,
+		"large":  int64(9007199254740993),
+		"nested": []interface{}{int64(-9007199254740993), "text"},
+	}
+	if converted := ConvertNumbers(value); !reflect.DeepEqual(converted, expected) {
+		t.Errorf("expected %v, got %v", expected, converted)
+	}
+}
+
+func TestUnmarshalRuleLargeIntegers(t *testing.T) {
+	data := `{"name": "IDRule", "conditions": {"all": [{"fact": "id", "operator": "greaterThan", "value": 9007199254740992}]}, "event": {"eventType": "match"}}`
+	var rule Rule
+	if err := UnmarshalRule([]byte(data), &rule); err != nil {
+		t.Fatalf("Error decoding rule: %v", err)
+	}
+
+	for _, tt := range []struct {
+		fact     interface{}
+		expected bool
+	}{
+		{int64(9007199254740992), false},
+		{int64(9007199254740993), true},
+		{json.Number("9007199254740993"), true},
+	} {
+		satisfied, err := rule.Evaluate(Fact{"id": tt.fact}, false, "Error")
+		if err != nil {
+			t.Fatalf("Error evaluating rule: %v", err)
+		}
+		if satisfied != tt.expected {
+			t.Errorf("expected %v for %v, got %v", tt.expected, tt.fact, satisfied)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Lookup returns the value of a fact reference. A reference starting with `/` is an RFC 6901
+// JSON Pointer, such as `/user/addresses/0/city`, that indexes into nested objects and lists;
+// `~1` and `~0` in it stand for `/` and `~`. Any other reference is a top-level key. The second
+// return value is false if the value is missing, including when the pointer indexes past the end
+// of a list or into a value that is neither an object nor a list.
+func (f Fact) Lookup(name string) (interface{}, bool) {
+	if !strings.HasPrefix(name, "/") {
+		value, ok := f[name]
+		return value, ok
+	}
+
+	tokens := pointerTokens(name)
+	value, ok := f[tokens[0]]
+	for _, token := range tokens[1:] {
+		if !ok {
+			return nil, false
+		}
+		value, ok = pointerStep(value, token)
+	}
+	return value, ok
+}
+
+// FactRoot returns the top-level key of the fact that a fact reference reads: the first token of
+// a JSON Pointer, or the reference itself. Rules are indexed under their facts' roots.
+func FactRoot(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		return name
+	}
+	return pointerTokens(name)[0]
+}
+
+// pointerTokens splits a JSON Pointer into its unescaped reference tokens.
+func pointerTokens(pointer string) []string {
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// pointerStep returns the member of an object, or the element of a list, that a JSON Pointer
+// token refers to. List indexes must be decimal numbers without leading zeros.
+func pointerStep(value interface{}, token string) (interface{}, bool) {
+	if object, ok := toMap(value); ok {
+		member, ok := object[token]
+		return member, ok
+	}
+	list, ok := toSlice(value)
+	if !ok || token == "" || (len(token) > 1 && token[0] == '0') {
+		return nil, false
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= len(list) {
+		return nil, false
+	}
+	return list[index], true
+}
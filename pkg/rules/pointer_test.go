@@ -0,0 +1,66 @@
+package rules
+
+import (
+	"testing"
+)
+
+func TestFactLookupJSONPointer(t *testing.T) {
+	fact := Fact{
+		"user": map[string]interface{}{
+			"addresses": []interface{}{
+				map[string]interface{}{"city": "Boston"},
+				map[string]interface{}{"city": "Denver"},
+			},
+			"a/b": "slash",
+			"m~n": "tilde",
+		},
+		"temperature": 30,
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected interface{}
+		found    bool
+	}{
+		{"Top-level key", "temperature", 30, true},
+		{"Array element", "/user/addresses/1/city", "Denver", true},
+		{"Escaped slash", "/user/a~1b", "slash", true},
+		{"Escaped tilde", "/user/m~0n", "tilde", true},
+		{"Index past the end", "/user/addresses/2/city", nil, false},
+		{"Leading zero index", "/user/addresses/01/city", nil, false},
+		{"Missing member", "/user/phone", nil, false},
+		{"Missing root", "/account/id", nil, false},
+		{"Into a scalar", "/temperature/value", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := fact.Lookup(tt.ref)
+			if ok != tt.found || value != tt.expected {
+				t.Errorf("Expected %v, %v, got %v, %v", tt.expected, tt.found, value, ok)
+			}
+		})
+	}
+}
+
+func TestEvaluateConditionWithJSONPointer(t *testing.T) {
+	condition := Condition{Fact: "/user/addresses/0/city", Operator: "equal", Value: "Boston"}
+	fact := Fact{"user": map[string]interface{}{"addresses": []interface{}{map[string]interface{}{"city": "Boston"}}}}
+
+	satisfied, facts, _, err := condition.Evaluate(fact, "Ignore")
+	if err != nil || !satisfied {
+		t.Fatalf("Expected the condition to match, got %v, %v", satisfied, err)
+	}
+	if facts[0] != "/user/addresses/0/city" {
+		t.Errorf("Expected the pointer to be reported as the fact, got %v", facts)
+	}
+
+	// A missing pointer path is an unmatched fact
+	if _, _, _, err := condition.Evaluate(Fact{"user": map[string]interface{}{"addresses": []interface{}{}}}, "Error"); err == nil {
+		t.Errorf("Expected an unmatched fact error for a missing pointer path")
+	}
+	if root := FactRoot("/user/addresses/0/city"); root != "user" {
+		t.Errorf("Expected the root user, got %s", root)
+	}
+}
@@ -0,0 +1,65 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// IsRange reports whether the condition is a range condition, which bounds a numeric fact with
+// Min and Max instead of comparing it with an operator and a value.
+func (condition *Condition) IsRange() bool {
+	return condition.Min != nil || condition.Max != nil
+}
+
+// validateRange validates the bounds of a range condition, appending any problems found to
+// result. The fact, or facts, are validated as for any other condition.
+func (condition *Condition) validateRange(result *multierror.Error, path string) *multierror.Error {
+	if condition.Operator != "" || condition.Value != nil {
+		result = multierror.Append(result, &ValidationError{Path: path + ".operator", Message: "a range condition takes no operator or value"})
+	}
+	if condition.Min != nil && condition.Max != nil {
+		low, high := *condition.Min, *condition.Max
+		if low > high || (low == high && (condition.ExclusiveMin || condition.ExclusiveMax)) {
+			result = multierror.Append(result, &ValidationError{Path: path + ".max", Message: fmt.Sprintf("empty range: min %v, max %v", low, high)})
+		}
+	}
+	if condition.ExclusiveMin && condition.Min == nil {
+		result = multierror.Append(result, &ValidationError{Path: path + ".exclusiveMin", Message: "exclusiveMin requires min"})
+	}
+	if condition.ExclusiveMax && condition.Max == nil {
+		result = multierror.Append(result, &ValidationError{Path: path + ".exclusiveMax", Message: "exclusiveMax requires max"})
+	}
+	return result
+}
+
+// evaluateRange evaluates a range condition on a single fact. A numeric fact is in range if it
+// is at least Min, or above it with ExclusiveMin, and at most Max, or below it with
+// ExclusiveMax; a missing bound does not limit the range. As for the comparison operators,
+// numbers within a tiny tolerance of a bound are taken as equal to it.
+func (condition *Condition) evaluateRange(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	factValue, ok := fact.Lookup(condition.Fact)
+	if !ok {
+		return false, nil, nil, unmatchedFact(condition.Fact, unmatchedFactBehavior)
+	}
+	factFloat, err := factToFloat64(condition.Fact, factValue)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("error converting fact value to float64: %w", err)
+	}
+
+	if condition.Min != nil && !boundSatisfied(*condition.Min, factFloat, condition.ExclusiveMin) {
+		return false, nil, nil, nil
+	}
+	if condition.Max != nil && !boundSatisfied(factFloat, *condition.Max, condition.ExclusiveMax) {
+		return false, nil, nil, nil
+	}
+	return true, []string{condition.Fact}, []interface{}{factValue}, nil
+}
+
+// boundSatisfied reports whether low is below high, or equal to it unless exclusive is set.
+func boundSatisfied(low, high float64, exclusive bool) bool {
+	if almostEqual(low, high) {
+		return !exclusive
+	}
+	return low < high
+}
@@ -0,0 +1,97 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+// bound returns a pointer to the bound, for the Min and Max of a range condition.
+func bound(value float64) *float64 {
+	return &value
+}
+
+func TestEvaluateRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		exclMin  bool
+		exclMax  bool
+		expected bool
+	}{
+		{"inside", 35, false, false, true},
+		{"inclusive min", 30, false, false, true},
+		{"inclusive max", 40.0, false, false, true},
+		{"exclusive min", 30, true, false, false},
+		{"exclusive max", 40, false, true, false},
+		{"inside exclusive bounds", 30.5, true, true, true},
+		{"below", 29.9, false, false, false},
+		{"above", 41, false, false, false},
+		{"numeric string", "35", false, false, true},
+		// Numbers within the tolerance of a bound are equal to it, whether it is inclusive or not
+		{"within tolerance of min", 30 - 1e-12, false, false, true},
+		{"within tolerance of exclusive max", 40 - 1e-12, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "temperature", Min: bound(30), Max: bound(40), ExclusiveMin: tt.exclMin, ExclusiveMax: tt.exclMax}
+			satisfied, _, _, err := condition.Evaluate(Fact{"temperature": tt.value}, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if satisfied != tt.expected {
+				t.Errorf("expected %v for %v, got %v", tt.expected, tt.value, satisfied)
+			}
+		})
+	}
+
+	// A single bound leaves the other side of the range open
+	condition := Condition{Fact: "temperature", Min: bound(30)}
+	if satisfied, _, _, _ := condition.Evaluate(Fact{"temperature": 1e6}, "Error"); !satisfied {
+		t.Errorf("expected a range without max to hold for a large value")
+	}
+
+	condition = Condition{Fact: "temperature", Min: bound(30), Max: bound(40)}
+	if _, _, _, err := condition.Evaluate(Fact{"temperature": "hot"}, "Error"); err == nil {
+		t.Errorf("expected an error for a non-numeric fact")
+	}
+	if _, _, _, err := condition.Evaluate(Fact{}, "Error"); err == nil || !strings.Contains(err.Error(), "temperature") {
+		t.Errorf("expected an unmatched fact error, got %v", err)
+	}
+}
+
+func TestValidateRange(t *testing.T) {
+	tests := []struct {
+		condition Condition
+		path      string
+	}{
+		{Condition{Fact: "temperature", Min: bound(30), Operator: "greaterThan", Value: 30}, "conditions.all[0].operator"},
+		{Condition{Fact: "temperature", Min: bound(40), Max: bound(30)}, "conditions.all[0].max"},
+		{Condition{Fact: "temperature", Min: bound(30), Max: bound(30), ExclusiveMax: true}, "conditions.all[0].max"},
+		{Condition{Fact: "temperature", Max: bound(30), ExclusiveMin: true}, "conditions.all[0].exclusiveMin"},
+		{Condition{Min: bound(30)}, "conditions.all[0].fact"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rule := Rule{
+				Name:       "RangeRule",
+				Conditions: Conditions{All: []Condition{tt.condition}},
+				Event:      Event{EventType: "alert"},
+			}
+			validationErrors := ValidationErrors(rule.Validate())
+			if len(validationErrors) != 1 || validationErrors[0].Path != tt.path {
+				t.Errorf("expected one error at %s, got %v", tt.path, validationErrors)
+			}
+		})
+	}
+
+	rule := Rule{
+		Name:       "RangeRule",
+		Conditions: Conditions{All: []Condition{{Fact: "temperature", Min: bound(30), Max: bound(30)}}},
+		Event:      Event{EventType: "alert"},
+	}
+	if err := rule.Validate(); err != nil {
+		t.Errorf("expected a single-value inclusive range to be valid, got %v", err)
+	}
+}
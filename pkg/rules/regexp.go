@@ -0,0 +1,67 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCachedPatterns bounds the number of compiled patterns kept in the cache, so that rules
+// tried or replaced with ever-changing patterns cannot grow it without limit. Once it is full,
+// new patterns are compiled on every use.
+const maxCachedPatterns = 1024
+
+// compiledPatterns caches compiled regular expressions by pattern. Conditions are copied by value
+// as rules are added, indexed and evaluated, so the compiled patterns are cached here rather
+// than on the condition, and are shared by every condition using the same pattern.
+var (
+	compiledPatterns    sync.Map // map[string]*regexp.Regexp
+	compiledPatternsLen atomic.Int64
+)
+
+// compilePattern returns the compiled form of the pattern, compiling it on first use.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := compiledPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if compiledPatternsLen.Load() < maxCachedPatterns {
+		if _, loaded := compiledPatterns.LoadOrStore(pattern, re); !loaded {
+			compiledPatternsLen.Add(1)
+		}
+	}
+	return re, nil
+}
+
+// patterns returns the compiled regular expressions of a `matches` or `matchesAny` condition.
+// The value of a `matches` condition is a single pattern, and the value of a `matchesAny`
+// condition is either a single pattern or a list of patterns.
+func (condition *Condition) patterns() ([]*regexp.Regexp, error) {
+	var values []interface{}
+	if pattern, ok := condition.Value.(string); ok {
+		values = []interface{}{pattern}
+	} else if list, ok := toSlice(condition.Value); ok && condition.Operator == "matchesAny" {
+		values = list
+	} else {
+		return nil, fmt.Errorf("operator %s requires a pattern value, got %T", condition.Operator, condition.Value)
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(values))
+	for i, value := range values {
+		pattern, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern %d of operator %s must be a string, got %T", i, condition.Operator, value)
+		}
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateSimpleConditionMatchesAny(t *testing.T) {
+	condition := Condition{
+		Fact:     "hostname",
+		Operator: "matchesAny",
+		Value:    []interface{}{`^db-\d+$`, `^web-[a-z]+\.prod$`, `^cache-`},
+	}
+
+	tests := []struct {
+		hostname string
+		expected bool
+	}{
+		{"web-frontend.prod", true},
+		{"db-12", true},
+		{"web-frontend.staging", false},
+		{"mail-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"hostname": tt.hostname}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionMatches(t *testing.T) {
+	condition := Condition{Fact: "hostname", Operator: "matches", Value: `^db-\d+$`}
+
+	result, _, _, err := condition.evaluateSimpleCondition(Fact{"hostname": "db-3"}, "Ignore")
+	if err != nil || !result {
+		t.Errorf("Expected db-3 to match, got %v, %v", result, err)
+	}
+	result, _, _, err = condition.evaluateSimpleCondition(Fact{"hostname": 3}, "Ignore")
+	if err != nil || result {
+		t.Errorf("Expected a non-string fact not to match, got %v, %v", result, err)
+	}
+}
+
+func TestValidateRegexPatterns(t *testing.T) {
+	rule := Rule{
+		Name: "RegexRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "hostname", Operator: "matchesAny", Value: []interface{}{"^db-", "(unclosed"}},
+				{Fact: "hostname", Operator: "matches", Value: []interface{}{"^db-"}},
+			},
+		},
+		Event: Event{EventType: "alert"},
+	}
+
+	err := rule.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors, but got none")
+	}
+	for _, expected := range []string{
+		`conditions.all[0].value: invalid pattern "(unclosed"`,
+		"conditions.all[1].value: operator matches requires a pattern value",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got: %v", expected, err)
+		}
+	}
+}
+
+func TestCompilePatternCachesPatterns(t *testing.T) {
+	first, err := compilePattern(`^cached-\d+$`)
+	if err != nil {
+		t.Fatalf("Failed to compile pattern: %v", err)
+	}
+	second, err := compilePattern(`^cached-\d+$`)
+	if err != nil {
+		t.Fatalf("Failed to compile pattern: %v", err)
+	}
+	if first != second {
+		t.Errorf("Expected the cached pattern to be reused")
+	}
+}
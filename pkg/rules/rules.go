@@ -1,29 +1,111 @@
 package rules
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"math"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
 )
 
-// Rule represents a rule with a name, priority, conditions, and an event.
+// Rule represents a rule with a name, priority, conditions, and the events it triggers. A rule
+// can define a single `Event`, a list of `Events`, or both.
 type Rule struct {
 	Name       string     `json:"name"`
 	Priority   int        `json:"priority"`
 	Conditions Conditions `json:"conditions"`
 	Event      Event      `json:"event"`
+	Events     []Event    `json:"events,omitempty"`
+	Enabled    *bool      `json:"enabled,omitempty"`
+	// ConsecutiveCount, when greater than zero, makes the rule stateful: it only fires once its
+	// conditions have been satisfied in this many consecutive evaluations.
+	ConsecutiveCount int `json:"consecutiveCount,omitempty"`
+	// WithinDuration, when greater than zero, requires the consecutive matches counted by
+	// ConsecutiveCount to all happen within this duration. In JSON it is given in nanoseconds.
+	WithinDuration time.Duration `json:"withinDuration,omitempty"`
+	// ExpiresAt, if set, is the time from which the rule no longer matches, for temporary rules
+	// such as promotions. In JSON it is given as an RFC 3339 timestamp.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// ConditionRefs names shared condition fragments whose conditions must hold in addition to
+	// the rule's own. The engine expands them with ExpandConditionRefs when the rule is added.
+	ConditionRefs []string `json:"conditionRefs,omitempty"`
+	// SchemaVersion is the version of the rule format the rule was written in, if given. Rules
+	// in earlier versions are upgraded by UpgradeRuleJSON when they are loaded.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+}
+
+// IsStateful reports whether the rule keeps state across evaluations.
+func (r *Rule) IsStateful() bool {
+	return r.ConsecutiveCount > 0
+}
+
+// IsEnabled reports whether the rule is enabled. Rules are enabled unless the `Enabled` field
+// has been explicitly set to false.
+func (r *Rule) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// IsExpired reports whether the rule has an expiry time that is not after now.
+func (r *Rule) IsExpired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// TTL returns how long the rule has left before it expires, which is zero once it has expired.
+// The second return value is false if the rule does not expire.
+func (r *Rule) TTL(now time.Time) (time.Duration, bool) {
+	if r.ExpiresAt == nil {
+		return 0, false
+	}
+	if r.IsExpired(now) {
+		return 0, true
+	}
+	return r.ExpiresAt.Sub(now), true
+}
+
+// AllEvents returns the events triggered when the rule matches: `Event`, if it has an event type
+// or no `Events` are defined, followed by every event in `Events`.
+func (r *Rule) AllEvents() []Event {
+	if len(r.Events) == 0 {
+		return []Event{r.Event}
+	}
+	events := make([]Event, 0, len(r.Events)+1)
+	if r.Event.EventType != "" {
+		events = append(events, r.Event)
+	}
+	return append(events, r.Events...)
 }
 
 // Event defines a struct type named "Event" with various fields and JSON tags.
+//
+// CustomProperty is returned as it is stored in the rule. For rules decoded from JSON it holds the
+// types produced by `encoding/json`: string, float64 for every number, bool,
+// map[string]interface{} for objects and []interface{} for arrays, except that rules decoded
+// with ConvertNumbers hold integers of 2^53 or more as int64. A nil custom property is omitted from
+// the JSON encoding.
 type Event struct {
 	EventType      string        `json:"eventType"`
-	CustomProperty interface{}   `json:"customProperty"`
+	CustomProperty interface{}   `json:"customProperty,omitempty"`
 	Facts          []string      `json:"facts,omitempty"`
 	Values         []interface{} `json:"values,omitempty"`
 	RuleName       string        `json:"ruleName,omitempty"`
+	// Labels lists the labels of the labeled conditions that were satisfied, such as the
+	// branch of an `Any` list that caused the match.
+	Labels []string `json:"labels,omitempty"`
+	// Paths lists the paths of the satisfied conditions that caused the match, such as
+	// `all[0]` or `any[1].all[0]`. It is only populated when the engine reports paths.
+	Paths []string `json:"paths,omitempty"`
+	// IncludeFacts lists fact keys whose values are added to Facts and Values whenever the rule
+	// matches, whether or not the engine reports the triggering facts and whether or not a
+	// condition on them caused the match. Keys missing from the fact are skipped.
+	IncludeFacts []string `json:"includeFacts,omitempty"`
+	// ID identifies the match that emitted the event. It is only set by engines that report
+	// event IDs; see StableID.
+	ID string `json:"id,omitempty"`
 }
 
 // Conditions is a struct that contains two arrays of Condition structs, one for all
@@ -34,12 +116,57 @@ type Conditions struct {
 }
 
 // Condition represents a condition with a fact, operator, value, and optional nested conditions.
+// An optional condition does not affect whether the rule matches, but adds its weight to the
+// rule's score when it is satisfied.
 type Condition struct {
 	Fact     string      `json:"fact,omitempty"`
 	Operator string      `json:"operator,omitempty"`
 	Value    interface{} `json:"value,omitempty"`
 	All      []Condition `json:"all,omitempty"`
 	Any      []Condition `json:"any,omitempty"`
+	Optional bool        `json:"optional,omitempty"`
+	Weight   float64     `json:"weight,omitempty"`
+	// Label optionally names the condition, so that the events of a matched rule can report
+	// which branch caused the match.
+	Label string `json:"label,omitempty"`
+	// Aggregate makes the condition apply to a list fact. With "countWhere", the Inner
+	// condition is evaluated against each object in the list, and the number of objects that
+	// satisfy it is compared with Value using Operator.
+	Aggregate string     `json:"aggregate,omitempty"`
+	Inner     *Condition `json:"inner,omitempty"`
+	// Tolerance is the largest difference between two timestamps that the equal and notEqual
+	// operators still treat as equal. In JSON it is given in nanoseconds.
+	Tolerance time.Duration `json:"tolerance,omitempty"`
+	// IgnoreCase makes the comparison operators ignore case when they order strings.
+	IgnoreCase bool `json:"ignoreCase,omitempty"`
+	// Trend makes the condition match when the recent values of a numeric fact are all
+	// "increasing", "decreasing" or "stable". The engine keeps the last Window values of the fact
+	// for each rule with a trend condition; Window defaults to 2.
+	Trend  string `json:"trend,omitempty"`
+	Window int    `json:"window,omitempty"`
+	// ValueFact, for the "in" operator, names a fact whose list value is used instead of Value,
+	// so that allow-lists can be passed alongside the facts being evaluated.
+	ValueFact string `json:"valueFact,omitempty"`
+	// Facts can be given instead of Fact to make the condition hold if the operator holds for
+	// any of the listed facts, such as either "homePhone" or "workPhone" equaling a number.
+	Facts []string `json:"facts,omitempty"`
+	// Expr makes the condition hold when an arithmetic expression over numeric facts, such as
+	// `weight / (height * height) > 25`, is true. An expression condition takes no fact, operator
+	// or value; the facts are named in the expression.
+	Expr string `json:"expr,omitempty"`
+	// Glob makes Fact a glob pattern, such as `metric.*`, matched against the fact keys with
+	// path.Match. The operator is applied to every matching fact, and the condition holds if it
+	// holds for "any" or for "all" of them, as Glob says.
+	Glob string `json:"glob,omitempty"`
+	// Min and Max make the condition hold when a numeric fact is within a range, such as between
+	// 30 and 40, without an operator or value. Either bound may be left out. The bounds are
+	// inclusive unless ExclusiveMin or ExclusiveMax is set.
+	Min          *float64 `json:"min,omitempty"`
+	Max          *float64 `json:"max,omitempty"`
+	ExclusiveMin bool     `json:"exclusiveMin,omitempty"`
+	ExclusiveMax bool     `json:"exclusiveMax,omitempty"`
+	// series holds the recent values of the fact for a trend condition, set by WithTrendSeries
+	series []interface{}
 }
 
 // Fact is a map with string keys and interface{} values.
@@ -61,133 +188,566 @@ func almostEqual(a, b float64) bool {
 	return diff <= epsilon*math.Max(math.Abs(a), math.Abs(b))
 }
 
-// Validate is a method of the `Rule` struct. It is used to validate the operators used
-// in the conditions of the rule.
-func (r *Rule) Validate() error {
-	validOperators := map[string]bool{
-		"equal":              true,
-		"notEqual":           true,
-		"greaterThan":        true,
-		"greaterThanOrEqual": true,
-		"lessThan":           true,
-		"lessThanOrEqual":    true,
-		"contains":           true,
-		"notContains":        true,
-	}
-
-	for _, condition := range r.Conditions.All {
-		if len(condition.All) > 0 || len(condition.Any) > 0 {
-			// This is a nested condition, so we don't need to validate the operator
-			continue
+// validOperators is the set of operators that can be used in a condition.
+var validOperators = map[string]bool{
+	"equal":              true,
+	"notEqual":           true,
+	"greaterThan":        true,
+	"greaterThanOrEqual": true,
+	"lessThan":           true,
+	"lessThanOrEqual":    true,
+	"contains":           true,
+	"notContains":        true,
+	"setEqual":           true,
+	"setContainsAll":     true,
+	"setContainsAny":     true,
+	"supersetOf":         true,
+	"subsetOf":           true,
+	"matches":            true,
+	"matchesAny":         true,
+	"containsValue":      true,
+	"withinPercent":      true,
+	"between":            true,
+	"isInteger":          true,
+	"in":                 true,
+	"isEmpty":            true,
+	"isNotEmpty":         true,
+	"hasPrefixIn":        true,
+}
+
+// ValidationError describes a single problem found while validating a rule. Path identifies the
+// offending field, for example `conditions.all[0].operator`.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// UnsupportedFactTypeError is returned when a condition compares the value of a fact as a number
+// but the value has a type that cannot be converted to one, such as a bool or a map.
+type UnsupportedFactTypeError struct {
+	Fact  string
+	Value interface{}
+}
+
+func (e *UnsupportedFactTypeError) Error() string {
+	return fmt.Sprintf("unsupported type: %T for fact: %s", e.Value, e.Fact)
+}
+
+// ValidationErrors returns every `*ValidationError` contained in err, looking inside
+// multierrors. It returns nil if err contains no validation errors.
+func ValidationErrors(err error) []*ValidationError {
+	var validationErrors []*ValidationError
+	if merr, ok := err.(*multierror.Error); ok {
+		for _, e := range merr.Errors {
+			validationErrors = append(validationErrors, ValidationErrors(e)...)
 		}
-		if _, ok := validOperators[condition.Operator]; !ok {
-			return fmt.Errorf("invalid operator: %s for fact: %s", condition.Operator, condition.Fact)
+		return validationErrors
+	}
+	if validationErr, ok := err.(*ValidationError); ok {
+		validationErrors = append(validationErrors, validationErr)
+	}
+	return validationErrors
+}
+
+// Validate is a method of the `Rule` struct. It is used to validate the rule name and the
+// operators and values used in the conditions of the rule, including nested conditions. Every
+// problem found is collected into a multierror of `*ValidationError` values.
+func (r *Rule) Validate() error {
+	var result *multierror.Error
+
+	if r.Name == "" {
+		result = multierror.Append(result, &ValidationError{Path: "name", Message: "rule name cannot be empty"})
+	}
+
+	if r.ConsecutiveCount < 0 {
+		result = multierror.Append(result, &ValidationError{Path: "consecutiveCount", Message: "consecutive count cannot be negative"})
+	}
+
+	if r.WithinDuration < 0 {
+		result = multierror.Append(result, &ValidationError{Path: "withinDuration", Message: "duration cannot be negative"})
+	}
+
+	if r.SchemaVersion < 0 || r.SchemaVersion > CurrentSchemaVersion {
+		result = multierror.Append(result, &ValidationError{
+			Path:    "schemaVersion",
+			Message: fmt.Sprintf("unsupported schema version %d, expected at most %d", r.SchemaVersion, CurrentSchemaVersion),
+		})
+	}
+
+	if r.Event.EventType == "" && len(r.Events) == 0 {
+		result = multierror.Append(result, &ValidationError{Path: "event", Message: "rule must define at least one event"})
+	}
+
+	for i, event := range r.Events {
+		if event.EventType == "" {
+			result = multierror.Append(result, &ValidationError{Path: fmt.Sprintf("events[%d].eventType", i), Message: "event type cannot be empty"})
 		}
 	}
 
-	for _, condition := range r.Conditions.Any {
+	result = validateConditions(result, r.Conditions.All, "conditions.all")
+	result = validateConditions(result, r.Conditions.Any, "conditions.any")
+
+	return result.ErrorOrNil()
+}
+
+// validateConditions validates a list of conditions, appending any problems found to result.
+func validateConditions(result *multierror.Error, conditions []Condition, path string) *multierror.Error {
+	for i, condition := range conditions {
+		conditionPath := fmt.Sprintf("%s[%d]", path, i)
 		if len(condition.All) > 0 || len(condition.Any) > 0 {
-			// This is a nested condition, so we don't need to validate the operator
+			// This is a nested condition, so validate the conditions it contains
+			result = validateConditions(result, condition.All, conditionPath+".all")
+			result = validateConditions(result, condition.Any, conditionPath+".any")
 			continue
 		}
-		if _, ok := validOperators[condition.Operator]; !ok {
-			return fmt.Errorf("invalid operator: %s for fact: %s", condition.Operator, condition.Fact)
+		result = condition.validate(result, conditionPath)
+	}
+	return result
+}
+
+// validate validates a simple condition, appending any problems found to result.
+func (condition *Condition) validate(result *multierror.Error, path string) *multierror.Error {
+	if condition.Expr != "" {
+		return condition.validateExpr(result, path)
+	}
+	if condition.Glob != "" {
+		result = condition.validateGlob(result, path)
+	}
+	if len(condition.Facts) > 0 && (condition.Aggregate != "" || condition.Trend != "") {
+		return multierror.Append(result, &ValidationError{
+			Path:    path + ".facts",
+			Message: "facts is not supported by aggregate and trend conditions",
+		})
+	}
+	if condition.Aggregate != "" {
+		return condition.validateAggregate(result, path)
+	}
+	if condition.Trend != "" {
+		return condition.validateTrend(result, path)
+	}
+
+	if condition.IsRange() {
+		result = condition.validateRange(result, path)
+	} else if _, ok := validOperators[condition.Operator]; !ok {
+		return multierror.Append(result, &ValidationError{
+			Path:    path + ".operator",
+			Message: fmt.Sprintf("invalid operator: %s for fact: %s", condition.Operator, condition.Fact),
+		})
+	}
+
+	if condition.Fact == "" && len(condition.Facts) == 0 {
+		result = multierror.Append(result, &ValidationError{Path: path + ".fact", Message: "fact cannot be empty"})
+	}
+	if condition.Fact != "" && len(condition.Facts) > 0 {
+		result = multierror.Append(result, &ValidationError{Path: path + ".facts", Message: "a condition cannot have both fact and facts"})
+	}
+	for i, factName := range condition.Facts {
+		if factName == "" {
+			result = multierror.Append(result, &ValidationError{Path: fmt.Sprintf("%s.facts[%d]", path, i), Message: "fact cannot be empty"})
 		}
 	}
 
-	return nil
+	if message := condition.validateValue(); message != "" {
+		result = multierror.Append(result, &ValidationError{Path: path + ".value", Message: message})
+	}
+
+	if condition.Tolerance < 0 {
+		result = multierror.Append(result, &ValidationError{Path: path + ".tolerance", Message: "tolerance cannot be negative"})
+	}
+
+	if condition.ValueFact != "" && condition.Operator != "in" {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".valueFact",
+			Message: fmt.Sprintf("valueFact is only supported by operator in, got %s", condition.Operator),
+		})
+	}
+
+	return result
+}
+
+// aggregateOperators is the set of operators that can compare the count of an aggregate
+// condition.
+var aggregateOperators = map[string]bool{
+	"equal":              true,
+	"notEqual":           true,
+	"greaterThan":        true,
+	"greaterThanOrEqual": true,
+	"lessThan":           true,
+	"lessThanOrEqual":    true,
+}
+
+// validateAggregate validates an aggregate condition, appending any problems found to result.
+func (condition *Condition) validateAggregate(result *multierror.Error, path string) *multierror.Error {
+	if condition.Aggregate != "countWhere" {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".aggregate",
+			Message: fmt.Sprintf("invalid aggregate: %s for fact: %s", condition.Aggregate, condition.Fact),
+		})
+	}
+
+	if condition.Fact == "" {
+		result = multierror.Append(result, &ValidationError{Path: path + ".fact", Message: "fact cannot be empty"})
+	}
+
+	if !aggregateOperators[condition.Operator] {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".operator",
+			Message: fmt.Sprintf("invalid operator: %s for aggregate: %s", condition.Operator, condition.Aggregate),
+		})
+	} else if _, _, err := convertToFloat64(condition.Value); err != nil {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".value",
+			Message: fmt.Sprintf("aggregate %s requires a numeric value, got %T", condition.Aggregate, condition.Value),
+		})
+	}
+
+	if condition.Inner == nil {
+		return multierror.Append(result, &ValidationError{Path: path + ".inner", Message: "aggregate requires an inner condition"})
+	}
+	if len(condition.Inner.All) > 0 || len(condition.Inner.Any) > 0 {
+		result = validateConditions(result, condition.Inner.All, path+".inner.all")
+		return validateConditions(result, condition.Inner.Any, path+".inner.any")
+	}
+	return condition.Inner.validate(result, path+".inner")
+}
+
+// validateValue checks that the condition value has a type the condition operator can work
+// with, returning a description of the problem or an empty string if the value is valid.
+func (condition *Condition) validateValue() string {
+	switch condition.Operator {
+	case "greaterThan", "greaterThanOrEqual", "lessThan", "lessThanOrEqual":
+		_, isString := condition.Value.(string)
+		_, isDuration := condition.Value.(time.Duration)
+		if _, _, err := convertToFloat64(condition.Value); err != nil && !isString && !isDuration {
+			return fmt.Sprintf("operator %s requires a numeric, string or duration value, got %T", condition.Operator, condition.Value)
+		}
+	case "setEqual", "setContainsAll", "setContainsAny":
+		if _, ok := toSlice(condition.Value); !ok {
+			return fmt.Sprintf("operator %s requires a list value, got %T", condition.Operator, condition.Value)
+		}
+	case "supersetOf", "subsetOf":
+		if _, ok := toMap(condition.Value); !ok {
+			return fmt.Sprintf("operator %s requires an object value, got %T", condition.Operator, condition.Value)
+		}
+	case "withinPercent":
+		if _, _, err := percentRange(condition.Value); err != nil {
+			return err.Error()
+		}
+	case "between":
+		if _, _, err := betweenRange(condition.Value); err != nil {
+			return err.Error()
+		}
+	case "in":
+		if condition.ValueFact != "" {
+			if condition.Value != nil {
+				return "operator in takes either a value or a valueFact, not both"
+			}
+		} else if _, ok := toSlice(condition.Value); !ok {
+			return fmt.Sprintf("operator in requires a list value or a valueFact, got %T", condition.Value)
+		}
+	case "hasPrefixIn":
+		if _, err := prefixList(condition.Value); err != nil {
+			return err.Error()
+		}
+	case "matches", "matchesAny":
+		// Compiling the patterns here also caches them for evaluation
+		if _, err := condition.patterns(); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
 }
 
 // Evaluate is a method of the `Rule` struct. It takes a `fact` of type `Fact` and a
-// boolean `includeTriggeringFact` as parameters.
+// boolean `includeTriggeringFact` as parameters. The rule is satisfied when every condition in
+// `All` holds and, if `Any` is not empty, at least one condition in `Any` holds.
 func (r *Rule) Evaluate(fact Fact, includeTriggeringFact bool, unmatchedFactBehavior string) (bool, error) {
-	allSatisfied, facts, values, err := evaluateConditions(r.Conditions.All, fact, unmatchedFactBehavior)
-	if err != nil {
-		return false, err
+	satisfied, _, err := r.evaluate(fact, includeTriggeringFact, unmatchedFactBehavior, false)
+	return satisfied, err
+}
+
+// EvaluatePaths evaluates the rule like Evaluate and, if it matches, also returns the paths of
+// the satisfied conditions that caused the match, as described for MatchedPaths.
+func (r *Rule) EvaluatePaths(fact Fact, includeTriggeringFact bool, unmatchedFactBehavior string) (bool, []string, error) {
+	return r.evaluate(fact, includeTriggeringFact, unmatchedFactBehavior, true)
+}
+
+// evaluate evaluates the rule for Evaluate and EvaluatePaths, collecting the matched paths only
+// if withPaths is set.
+func (r *Rule) evaluate(fact Fact, includeTriggeringFact bool, unmatchedFactBehavior string, withPaths bool) (bool, []string, error) {
+	if len(r.Conditions.All) == 0 && len(r.Conditions.Any) == 0 {
+		return false, nil, nil
 	}
-	if !allSatisfied && len(r.Conditions.All) > 0 {
-		return false, nil
+
+	satisfied, match, err := evaluateConditions(r.Conditions.All, r.Conditions.Any, fact, unmatchedFactBehavior, withPaths)
+	if err != nil || !satisfied {
+		return false, nil, err
 	}
-	if allSatisfied && includeTriggeringFact {
-		event := r.Event
-		event.Facts = append(event.Facts, facts...)
-		event.Values = append(event.Values, values...)
-		r.Event = event
+
+	// The labels of the satisfied conditions are always reported, and their facts on request
+	if includeTriggeringFact || len(match.labels) > 0 {
+		if !includeTriggeringFact {
+			match.facts, match.values = nil, nil
+		}
+		r.Event = r.Event.withTriggeringFacts(match.facts, match.values, match.labels)
+		if len(r.Events) > 0 {
+			events := make([]Event, len(r.Events))
+			for i, event := range r.Events {
+				events[i] = event.withTriggeringFacts(match.facts, match.values, match.labels)
+			}
+			r.Events = events
+		}
+	}
+
+	r.Event = r.Event.withIncludedFacts(fact)
+	for i, event := range r.Events {
+		if len(event.IncludeFacts) > 0 {
+			// Copy the events before changing them, since they may be shared with the rule the
+			// copy was made from
+			events := append([]Event(nil), r.Events...)
+			for j := i; j < len(events); j++ {
+				events[j] = events[j].withIncludedFacts(fact)
+			}
+			r.Events = events
+			break
+		}
+	}
+
+	return true, match.paths, nil
+}
+
+// withIncludedFacts returns a copy of the event with the facts listed in IncludeFacts that are
+// present in the fact, and not already reported, appended to Facts and Values. The event is
+// returned unchanged if it has no IncludeFacts.
+func (e Event) withIncludedFacts(fact Fact) Event {
+	if len(e.IncludeFacts) == 0 {
+		return e
+	}
+
+	var facts []string
+	var values []interface{}
+	for _, factName := range e.IncludeFacts {
+		value, ok := fact.Lookup(factName)
+		if !ok || contains(e.Facts, factName) || contains(facts, factName) {
+			continue
+		}
+		facts = append(facts, factName)
+		values = append(values, value)
+	}
+	if len(facts) == 0 {
+		return e
+	}
+	return e.withTriggeringFacts(facts, values, nil)
+}
+
+// withTriggeringFacts returns a copy of the event with the given facts, values and labels
+// appended. New slices are built so that the reported facts never share a backing array with the
+// event of the rule the copy was made from.
+func (e Event) withTriggeringFacts(facts []string, values []interface{}, labels []string) Event {
+	reportedFacts := make([]string, 0, len(e.Facts)+len(facts))
+	e.Facts = append(append(reportedFacts, e.Facts...), facts...)
+	reportedValues := make([]interface{}, 0, len(e.Values)+len(values))
+	e.Values = append(append(reportedValues, e.Values...), values...)
+	if len(labels) > 0 {
+		reportedLabels := make([]string, 0, len(e.Labels)+len(labels))
+		e.Labels = append(append(reportedLabels, e.Labels...), labels...)
+	}
+	return e
+}
+
+// MatchedPaths returns the paths of the satisfied simple conditions of a matching rule, such as
+// `all[0]` or `any[1].all[0]`, or nil if the rule does not match. Every condition in an `All`
+// list is satisfied, while only the satisfied conditions of an `Any` list are included. Optional
+// conditions are skipped.
+func (r *Rule) MatchedPaths(fact Fact, unmatchedFactBehavior string) []string {
+	_, match, _ := evaluateConditions(r.Conditions.All, r.Conditions.Any, fact, unmatchedFactBehavior, true)
+	return match.paths
+}
+
+// EvaluateScore evaluates the rule like Evaluate and, if it matches, returns its score: the sum of
+// the weights of the optional conditions that are satisfied. An optional condition with no weight
+// counts as 1. Optional conditions never affect whether the rule matches.
+func (r *Rule) EvaluateScore(fact Fact, unmatchedFactBehavior string) (bool, float64, error) {
+	satisfied, err := r.Evaluate(fact, false, unmatchedFactBehavior)
+	if err != nil || !satisfied {
+		return false, 0, err
 	}
 
-	anySatisfied, facts, values, err := evaluateConditions(r.Conditions.Any, fact, unmatchedFactBehavior)
+	allScore, err := scoreConditions(r.Conditions.All, fact, unmatchedFactBehavior)
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
-	if anySatisfied {
-		if includeTriggeringFact {
-			event := r.Event
-			event.Facts = append(event.Facts, facts...)
-			event.Values = append(event.Values, values...)
-			r.Event = event
+	anyScore, err := scoreConditions(r.Conditions.Any, fact, unmatchedFactBehavior)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return true, allScore + anyScore, nil
+}
+
+// scoreConditions returns the sum of the weights of the satisfied optional conditions in the
+// list, including optional conditions nested in required ones.
+func scoreConditions(conditions []Condition, fact Fact, unmatchedFactBehavior string) (float64, error) {
+	var score float64
+
+	for _, condition := range conditions {
+		if !condition.Optional {
+			nestedScore, err := scoreConditions(condition.All, fact, unmatchedFactBehavior)
+			if err != nil {
+				return 0, err
+			}
+			score += nestedScore
+			nestedScore, err = scoreConditions(condition.Any, fact, unmatchedFactBehavior)
+			if err != nil {
+				return 0, err
+			}
+			score += nestedScore
+			continue
+		}
+
+		satisfied, _, _, err := condition.Evaluate(fact, unmatchedFactBehavior)
+		if err != nil {
+			return 0, err
+		}
+		if satisfied {
+			if condition.Weight == 0 {
+				score++
+			} else {
+				score += condition.Weight
+			}
 		}
-		return true, nil
 	}
 
-	return len(r.Conditions.Any) == 0 && allSatisfied, nil
+	return score, nil
 }
 
 // Evaluate is a method of the `Condition` struct. It takes a `fact` of type `Fact` as a
 // parameter and evaluates the condition against the given fact.
 func (condition *Condition) Evaluate(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	satisfied, match, err := condition.evaluate(fact, unmatchedFactBehavior, false)
+	return satisfied, match.facts, match.values, err
+}
+
+// conditionMatch is what a satisfied condition, or list of conditions, reports: the facts and
+// values that satisfied it, the labels of its satisfied labeled conditions and, when requested,
+// the paths of its satisfied simple conditions relative to it, in order.
+type conditionMatch struct {
+	facts  []string
+	values []interface{}
+	labels []string
+	paths  []string
+}
+
+// add appends what another satisfied condition reports to the match, prefixing its paths.
+func (m *conditionMatch) add(other conditionMatch, pathPrefix string) {
+	m.facts = append(m.facts, other.facts...)
+	m.values = append(m.values, other.values...)
+	m.labels = append(m.labels, other.labels...)
+	for _, path := range other.paths {
+		m.paths = append(m.paths, pathPrefix+path)
+	}
+}
+
+// evaluate evaluates the condition against the fact like Evaluate, returning what the condition
+// reports when it is satisfied. The path of a satisfied simple condition is empty, and those of
+// nested conditions start with `.all` or `.any`.
+func (condition *Condition) evaluate(fact Fact, unmatchedFactBehavior string, withPaths bool) (bool, conditionMatch, error) {
+	var match conditionMatch
 	if len(condition.All) > 0 || len(condition.Any) > 0 {
-		return condition.evaluateNestedConditions(fact, unmatchedFactBehavior)
+		satisfied, nestedMatch, err := evaluateConditions(condition.All, condition.Any, fact, unmatchedFactBehavior, withPaths)
+		if err != nil || !satisfied {
+			return false, conditionMatch{}, err
+		}
+		match.add(nestedMatch, ".")
+	} else {
+		satisfied, facts, values, err := condition.evaluateSimpleCondition(fact, unmatchedFactBehavior)
+		if err != nil || !satisfied {
+			return false, conditionMatch{}, err
+		}
+		match.facts, match.values = facts, values
+		if withPaths {
+			match.paths = []string{""}
+		}
 	}
 
-	return condition.evaluateSimpleCondition(fact, unmatchedFactBehavior)
+	if condition.Label != "" {
+		match.labels = append([]string{condition.Label}, match.labels...)
+	}
+	return true, match, nil
 }
 
 // evaluateSimpleCondition evaluates a simple condition (i.e., a condition without nested conditions)
 // and returns whether the condition is satisfied, along with the corresponding fact and value.
 func (condition *Condition) evaluateSimpleCondition(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
-	validOperators := map[string]bool{
-		"equal":              true,
-		"notEqual":           true,
-		"greaterThan":        true,
-		"greaterThanOrEqual": true,
-		"lessThan":           true,
-		"lessThanOrEqual":    true,
-		"contains":           true,
-		"notContains":        true,
-	}
-
-	if _, ok := validOperators[condition.Operator]; !ok {
+	if condition.Aggregate != "" {
+		return condition.evaluateAggregate(fact, unmatchedFactBehavior)
+	}
+	if condition.Trend != "" {
+		return condition.evaluateTrend(fact, unmatchedFactBehavior)
+	}
+	if condition.Expr != "" {
+		return condition.evaluateExpr(fact, unmatchedFactBehavior)
+	}
+
+	if _, ok := validOperators[condition.Operator]; !ok && !condition.IsRange() {
 		return false, nil, nil, fmt.Errorf("invalid operator: %s", condition.Operator)
 	}
 
+	if condition.Glob != "" {
+		return condition.evaluateGlob(fact, unmatchedFactBehavior)
+	}
+	if len(condition.Facts) > 0 {
+		return condition.evaluateAnyFact(fact, unmatchedFactBehavior)
+	}
+	if condition.IsRange() {
+		return condition.evaluateRange(fact, unmatchedFactBehavior)
+	}
+
 	if condition.Fact != "" && condition.Operator != "" {
-		factValue, ok := fact[condition.Fact]
+		factValue, ok := fact.Lookup(condition.Fact)
 		if !ok {
-			switch unmatchedFactBehavior {
-			case "Ignore":
-				return false, nil, nil, nil
-			case "Log":
-				log.Printf("Unmatched fact: %s", condition.Fact)
-				return false, nil, nil, nil
-			case "Error":
-				return false, nil, nil, fmt.Errorf("unmatched fact: %s", condition.Fact)
-			default:
-				return false, nil, nil, nil
-			}
+			return false, nil, nil, unmatchedFact(condition.Fact, unmatchedFactBehavior)
 		}
 
 		switch condition.Operator {
 		case "equal":
-			if reflect.DeepEqual(factValue, condition.Value) {
+			if condition.valueEquals(factValue) {
 				return true, []string{condition.Fact}, []interface{}{factValue}, nil
 			}
 		case "notEqual":
-			if !reflect.DeepEqual(factValue, condition.Value) {
+			if !condition.valueEquals(factValue) {
 				return true, []string{condition.Fact}, []interface{}{factValue}, nil
 			}
 		case "greaterThan", "greaterThanOrEqual", "lessThan", "lessThanOrEqual":
-			factFloat, _, err1 := convertToFloat64(factValue)
+			if cmp, ok := compareIntegers(factValue, condition.Value); ok {
+				if orderSatisfied(condition.Operator, cmp) {
+					return true, []string{condition.Fact}, []interface{}{factValue}, nil
+				}
+				return false, nil, nil, nil
+			}
+			factFloat, err1 := factToFloat64(condition.Fact, factValue)
 			valueFloat, _, err2 := convertToFloat64(condition.Value)
+			// Numbers, including numeric strings, are compared by value. Durations are compared
+			// by length, taking a number compared with a duration as seconds. Two other strings
+			// are compared by their order.
+			if err1 != nil || err2 != nil {
+				factDuration, valueDuration, isDuration := durationOperands(factValue, condition.Value)
+				factStr, ok1 := factValue.(string)
+				valueStr, ok2 := condition.Value.(string)
+				if isDuration {
+					factFloat, valueFloat = float64(factDuration), float64(valueDuration)
+					err1, err2 = nil, nil
+				} else if ok1 && ok2 {
+					if condition.stringOrderSatisfied(factStr, valueStr) {
+						return true, []string{condition.Fact}, []interface{}{factValue}, nil
+					}
+					return false, nil, nil, nil
+				}
+			}
 			if err1 != nil {
 				return false, nil, nil, fmt.Errorf("error converting fact value to float64: %w", err1)
 			}
@@ -196,7 +756,7 @@ func (condition *Condition) evaluateSimpleCondition(fact Fact, unmatchedFactBeha
 			}
 			switch condition.Operator {
 			case "greaterThan":
-				if factFloat > valueFloat+epsilon {
+				if factFloat > valueFloat && !almostEqual(factFloat, valueFloat) {
 					return true, []string{condition.Fact}, []interface{}{factValue}, nil
 				}
 			case "greaterThanOrEqual":
@@ -204,7 +764,7 @@ func (condition *Condition) evaluateSimpleCondition(fact Fact, unmatchedFactBeha
 					return true, []string{condition.Fact}, []interface{}{factValue}, nil
 				}
 			case "lessThan":
-				if factFloat < valueFloat-epsilon {
+				if factFloat < valueFloat && !almostEqual(factFloat, valueFloat) {
 					return true, []string{condition.Fact}, []interface{}{factValue}, nil
 				}
 			case "lessThanOrEqual":
@@ -213,13 +773,16 @@ func (condition *Condition) evaluateSimpleCondition(fact Fact, unmatchedFactBeha
 				}
 			}
 		case "contains":
+			// A string fact contains the value as a substring, so every string contains an
+			// empty value, and notContains never holds for one. A list fact contains the value
+			// as an element, so an empty value only matches an empty string element.
 			factStr, ok1 := factValue.(string)
 			valueStr, ok2 := condition.Value.(string)
 			if ok1 && ok2 && strings.Contains(factStr, valueStr) {
 				return true, []string{condition.Fact}, []interface{}{factValue}, nil
 			}
 			factSlice, ok3 := factValue.([]string)
-			if ok3 && contains(factSlice, valueStr) {
+			if ok2 && ok3 && contains(factSlice, valueStr) {
 				return true, []string{condition.Fact}, []interface{}{factValue}, nil
 			}
 		case "notContains":
@@ -229,15 +792,268 @@ func (condition *Condition) evaluateSimpleCondition(fact Fact, unmatchedFactBeha
 				return true, []string{condition.Fact}, []interface{}{factValue}, nil
 			}
 			factSlice, ok3 := factValue.([]string)
-			if ok3 && !contains(factSlice, valueStr) {
+			if ok2 && ok3 && !contains(factSlice, valueStr) {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "setEqual", "setContainsAll", "setContainsAny":
+			factSet, ok1 := toSlice(factValue)
+			valueSet, ok2 := toSlice(condition.Value)
+			if !ok1 || !ok2 {
+				return false, nil, nil, nil
+			}
+			var satisfied bool
+			switch condition.Operator {
+			case "setEqual":
+				satisfied = containsAll(factSet, valueSet) && containsAll(valueSet, factSet)
+			case "setContainsAll":
+				satisfied = containsAll(factSet, valueSet)
+			case "setContainsAny":
+				satisfied = containsAny(factSet, valueSet)
+			}
+			if satisfied {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "matches", "matchesAny":
+			factStr, ok := factValue.(string)
+			if !ok {
+				return false, nil, nil, nil
+			}
+			patterns, err := condition.patterns()
+			if err != nil {
+				return false, nil, nil, err
+			}
+			for _, pattern := range patterns {
+				if pattern.MatchString(factStr) {
+					return true, []string{condition.Fact}, []interface{}{factValue}, nil
+				}
+			}
+		case "hasPrefixIn":
+			factStr, ok := factValue.(string)
+			if !ok {
+				return false, nil, nil, nil
+			}
+			prefixes, err := prefixList(condition.Value)
+			if err != nil {
+				return false, nil, nil, err
+			}
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(factStr, prefix) {
+					return true, []string{condition.Fact}, []interface{}{factValue}, nil
+				}
+			}
+		case "withinPercent":
+			factFloat, err := factToFloat64(condition.Fact, factValue)
+			if err != nil {
+				return false, nil, nil, fmt.Errorf("error converting fact value to float64: %w", err)
+			}
+			target, percent, err := percentRange(condition.Value)
+			if err != nil {
+				return false, nil, nil, err
+			}
+			diff := math.Abs(factFloat - target)
+			limit := math.Abs(target) * percent / 100
+			if diff <= limit || almostEqual(diff, limit) {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "between":
+			factFloat, err := factToFloat64(condition.Fact, factValue)
+			if err != nil {
+				return false, nil, nil, fmt.Errorf("error converting fact value to float64: %w", err)
+			}
+			low, high, err := betweenRange(condition.Value)
+			if err != nil {
+				return false, nil, nil, err
+			}
+			if (factFloat >= low || almostEqual(factFloat, low)) && (factFloat <= high || almostEqual(factFloat, high)) {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "isInteger":
+			factFloat, err := factToFloat64(condition.Fact, factValue)
+			if err != nil {
+				return false, nil, nil, fmt.Errorf("error converting fact value to float64: %w", err)
+			}
+			if almostEqual(factFloat, math.Trunc(factFloat)) {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "isEmpty", "isNotEmpty":
+			length, err := factLength(condition.Fact, factValue)
+			if err != nil {
+				return false, nil, nil, err
+			}
+			if (length == 0) == (condition.Operator == "isEmpty") {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "in":
+			setValue := condition.Value
+			if condition.ValueFact != "" {
+				if setValue, ok = fact.Lookup(condition.ValueFact); !ok {
+					return false, nil, nil, unmatchedFact(condition.ValueFact, unmatchedFactBehavior)
+				}
+			}
+			set, ok := toSlice(setValue)
+			if ok && sliceContains(set, factValue) {
+				return true, []string{condition.Fact}, []interface{}{factValue}, nil
+			}
+		case "containsValue":
+			factMap, ok := toMap(factValue)
+			if !ok {
+				return false, nil, nil, nil
+			}
+			for _, v := range factMap {
+				if valuesEqual(v, condition.Value) {
+					return true, []string{condition.Fact}, []interface{}{factValue}, nil
+				}
+			}
+		case "supersetOf", "subsetOf":
+			factMap, ok1 := toMap(factValue)
+			valueMap, ok2 := toMap(condition.Value)
+			if !ok1 || !ok2 {
+				return false, nil, nil, nil
+			}
+			var satisfied bool
+			switch condition.Operator {
+			case "supersetOf":
+				satisfied = mapContains(factMap, valueMap)
+			case "subsetOf":
+				satisfied = mapContains(valueMap, factMap)
+			}
+			if satisfied {
 				return true, []string{condition.Fact}, []interface{}{factValue}, nil
 			}
 		}
 		return false, nil, nil, nil
 	}
 
-	if len(condition.All) > 0 {
-		satisfied, facts, values, err := evaluateConditions(condition.All, fact, unmatchedFactBehavior)
+	if len(condition.All) > 0 || len(condition.Any) > 0 {
+		return condition.evaluateNestedConditions(fact, unmatchedFactBehavior)
+	}
+
+	return false, nil, nil, nil
+}
+
+// durationOperands converts a fact value and a condition value to durations when at least one
+// of them is a duration, either a time.Duration or a string such as "90s" or "2h30m" accepted by
+// time.ParseDuration, and the other is a duration or a number. Numbers, including numeric
+// strings, are taken as seconds. The last return value is false if they cannot be compared as
+// durations.
+func durationOperands(factValue, value interface{}) (time.Duration, time.Duration, bool) {
+	factDuration, factIsDuration, ok1 := toDuration(factValue)
+	valueDuration, valueIsDuration, ok2 := toDuration(value)
+	if !ok1 || !ok2 || (!factIsDuration && !valueIsDuration) {
+		return 0, 0, false
+	}
+	return factDuration, valueDuration, true
+}
+
+// toDuration converts a duration, or a number of seconds, to a time.Duration. The second return
+// value reports whether the value was a duration rather than a number, and the third whether it
+// could be converted at all.
+func toDuration(value interface{}) (time.Duration, bool, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, true, true
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, true, true
+		}
+	}
+	seconds, _, err := convertToFloat64(value)
+	if err != nil {
+		return 0, false, false
+	}
+	return time.Duration(seconds * float64(time.Second)), false, true
+}
+
+// stringOrderSatisfied reports whether the fact string and the condition value string satisfy
+// the condition's comparison operator. Strings are ordered byte by byte, as by strings.Compare,
+// after being lowercased if IgnoreCase is set.
+func (condition *Condition) stringOrderSatisfied(factStr, valueStr string) bool {
+	if condition.IgnoreCase {
+		factStr, valueStr = strings.ToLower(factStr), strings.ToLower(valueStr)
+	}
+	cmp := strings.Compare(factStr, valueStr)
+	switch condition.Operator {
+	case "greaterThan":
+		return cmp > 0
+	case "greaterThanOrEqual":
+		return cmp >= 0
+	case "lessThan":
+		return cmp < 0
+	case "lessThanOrEqual":
+		return cmp <= 0
+	}
+	return false
+}
+
+// percentRange returns the target and percentage of a `withinPercent` condition value, which
+// must be a list of two numbers with a percentage that is not negative.
+func percentRange(value interface{}) (float64, float64, error) {
+	list, ok := toSlice(value)
+	if !ok || len(list) != 2 {
+		return 0, 0, fmt.Errorf("operator withinPercent requires a [target, percent] value, got %v", value)
+	}
+	target, _, err1 := convertToFloat64(list[0])
+	percent, _, err2 := convertToFloat64(list[1])
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("operator withinPercent requires numeric target and percent, got %v", value)
+	}
+	if percent < 0 {
+		return 0, 0, fmt.Errorf("operator withinPercent requires a percent that is not negative, got %v", percent)
+	}
+	return target, percent, nil
+}
+
+// prefixList returns the prefixes of a `hasPrefixIn` condition, whose value is a list of strings.
+// An empty list is valid and matches no fact.
+func prefixList(value interface{}) ([]string, error) {
+	list, ok := toSlice(value)
+	if !ok {
+		return nil, fmt.Errorf("operator hasPrefixIn requires a list of prefixes, got %T", value)
+	}
+	prefixes := make([]string, len(list))
+	for i, element := range list {
+		prefix, ok := element.(string)
+		if !ok {
+			return nil, fmt.Errorf("prefix %d of operator hasPrefixIn must be a string, got %T", i, element)
+		}
+		prefixes[i] = prefix
+	}
+	return prefixes, nil
+}
+
+// betweenRange returns the bounds of a `between` condition value, which must be a list of two
+// numbers of any numeric type. An inverted range, with the low bound above the high bound, is
+// rejected rather than silently swapped.
+func betweenRange(value interface{}) (float64, float64, error) {
+	list, ok := toSlice(value)
+	if !ok || len(list) != 2 {
+		return 0, 0, fmt.Errorf("operator between requires a [low, high] value, got %v", value)
+	}
+	low, _, err1 := convertToFloat64(list[0])
+	high, _, err2 := convertToFloat64(list[1])
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("operator between requires numeric bounds, got %v", value)
+	}
+	if low > high {
+		return 0, 0, fmt.Errorf("operator between requires a low bound that is not above the high bound, got %v", value)
+	}
+	return low, high, nil
+}
+
+// evaluateAnyFact evaluates a condition with a Facts list, which is satisfied by the first
+// listed fact that the operator holds for, and reports only that fact. Listed facts that are
+// missing from the fact are skipped; the unmatched fact behavior only applies when all of them are.
+func (condition *Condition) evaluateAnyFact(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	present := false
+	for _, factName := range condition.Facts {
+		if _, ok := fact.Lookup(factName); !ok {
+			continue
+		}
+		present = true
+		single := *condition
+		single.Fact = factName
+		single.Facts = nil
+		satisfied, facts, values, err := single.evaluateSimpleCondition(fact, unmatchedFactBehavior)
 		if err != nil {
 			return false, nil, nil, err
 		}
@@ -245,51 +1061,156 @@ func (condition *Condition) evaluateSimpleCondition(fact Fact, unmatchedFactBeha
 			return true, facts, values, nil
 		}
 	}
+	if !present {
+		return false, nil, nil, unmatchedFact(strings.Join(condition.Facts, ", "), unmatchedFactBehavior)
+	}
+	return false, nil, nil, nil
+}
 
-	if len(condition.Any) > 0 {
-		satisfied, facts, values, err := evaluateConditions(condition.Any, fact, unmatchedFactBehavior)
+// unmatchedFact handles a condition whose fact is missing from the evaluated fact, according
+// to the unmatched fact behavior. It returns an error only for the "Error" behavior.
+func unmatchedFact(factName string, unmatchedFactBehavior string) error {
+	switch unmatchedFactBehavior {
+	case "Log":
+		log.Printf("Unmatched fact: %s", factName)
+	case "Error":
+		return fmt.Errorf("unmatched fact: %s", factName)
+	}
+	return nil
+}
+
+// evaluateAggregate evaluates an aggregate condition. The inner condition is evaluated against
+// each object in the list fact, ignoring objects that lack the facts it references, and the number
+// of objects satisfying it is compared with the condition value.
+func (condition *Condition) evaluateAggregate(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	if condition.Aggregate != "countWhere" {
+		return false, nil, nil, fmt.Errorf("invalid aggregate: %s", condition.Aggregate)
+	}
+	if condition.Inner == nil {
+		return false, nil, nil, fmt.Errorf("aggregate %s for fact %s has no inner condition", condition.Aggregate, condition.Fact)
+	}
+
+	factValue, ok := fact.Lookup(condition.Fact)
+	if !ok {
+		return false, nil, nil, unmatchedFact(condition.Fact, unmatchedFactBehavior)
+	}
+	elements, ok := toSlice(factValue)
+	if !ok {
+		return false, nil, nil, nil
+	}
+
+	count := 0
+	for _, element := range elements {
+		elementFact, ok := toMap(element)
+		if !ok {
+			continue
+		}
+		satisfied, _, _, err := condition.Inner.Evaluate(elementFact, "Ignore")
 		if err != nil {
 			return false, nil, nil, err
 		}
 		if satisfied {
-			return true, facts, values, nil
+			count++
 		}
 	}
 
-	return false, nil, nil, nil
+	satisfied, err := compareCount(count, condition.Operator, condition.Value)
+	if err != nil || !satisfied {
+		return false, nil, nil, err
+	}
+	return true, []string{condition.Fact}, []interface{}{factValue}, nil
 }
 
-// evaluateNestedConditions evaluates nested conditions and returns whether any conditions
-// are satisfied, along with the corresponding facts and values.
-func (condition *Condition) evaluateNestedConditions(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
-	satisfied, facts, values, err := evaluateConditions(condition.All, fact, unmatchedFactBehavior)
+// compareCount compares the count of an aggregate condition with the condition value.
+func compareCount(count int, operator string, value interface{}) (bool, error) {
+	valueFloat, _, err := convertToFloat64(value)
 	if err != nil {
-		return false, nil, nil, err
+		return false, fmt.Errorf("error converting condition value to float64: %w", err)
 	}
-	if satisfied {
-		return true, facts, values, nil
+	countFloat := float64(count)
+
+	switch operator {
+	case "equal":
+		return almostEqual(countFloat, valueFloat), nil
+	case "notEqual":
+		return !almostEqual(countFloat, valueFloat), nil
+	case "greaterThan":
+		return countFloat > valueFloat && !almostEqual(countFloat, valueFloat), nil
+	case "greaterThanOrEqual":
+		return almostEqual(countFloat, valueFloat) || countFloat > valueFloat, nil
+	case "lessThan":
+		return countFloat < valueFloat && !almostEqual(countFloat, valueFloat), nil
+	case "lessThanOrEqual":
+		return almostEqual(countFloat, valueFloat) || countFloat < valueFloat, nil
 	}
+	return false, fmt.Errorf("invalid operator: %s for aggregate", operator)
+}
 
-	satisfied, facts, values, err = evaluateConditions(condition.Any, fact, unmatchedFactBehavior)
-	if err != nil {
-		return false, nil, nil, err
+// valueEquals checks if the fact value equals the condition value. When both are timestamps,
+// they are equal if they are no more than the condition's tolerance apart; otherwise they are
+// compared with reflect.DeepEqual.
+func (condition *Condition) valueEquals(factValue interface{}) bool {
+	// The fact is only parsed when the condition value is a timestamp
+	if valueTime, ok := toTime(condition.Value); ok {
+		if factTime, ok := toTime(factValue); ok {
+			diff := factTime.Sub(valueTime)
+			if diff < 0 {
+				diff = -diff
+			}
+			return diff <= condition.Tolerance
+		}
 	}
-	if satisfied {
-		return true, facts, values, nil
+	if cmp, ok := compareIntegers(factValue, condition.Value); ok {
+		return cmp == 0
 	}
+	return reflect.DeepEqual(factValue, condition.Value)
+}
 
-	return false, nil, nil, nil
+// evaluateNestedConditions evaluates nested conditions and returns whether they are satisfied,
+// along with the corresponding facts and values.
+func (condition *Condition) evaluateNestedConditions(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	satisfied, match, err := evaluateConditions(condition.All, condition.Any, fact, unmatchedFactBehavior, false)
+	return satisfied, match.facts, match.values, err
+}
+
+// evaluateConditions evaluates the `All` and `Any` lists of a rule or of nested conditions and
+// returns whether they are satisfied, along with what the satisfied conditions report, with
+// paths starting with `all` or `any`. Every condition in `All` must hold and, if `Any` is not
+// empty, at least one condition in `Any` must hold.
+func evaluateConditions(all, any []Condition, fact Fact, unmatchedFactBehavior string, withPaths bool) (bool, conditionMatch, error) {
+	satisfied, allMatch, err := evaluateAll(all, fact, unmatchedFactBehavior, withPaths)
+	if err != nil || !satisfied {
+		return false, conditionMatch{}, err
+	}
+	var match conditionMatch
+	match.add(allMatch, "all")
+
+	if len(any) > 0 {
+		satisfied, anyMatch, err := evaluateAny(any, fact, unmatchedFactBehavior, withPaths)
+		if err != nil || !satisfied {
+			return false, conditionMatch{}, err
+		}
+		match.add(anyMatch, "any")
+	}
+
+	return true, match, nil
 }
 
 // convertToFloat64 takes in a value of any type and attempts to convert it to a
 // float64, returning the converted value, a boolean indicating success or failure, and an error if
-// applicable.
+// applicable. Integers of any Go type are converted, rounding those beyond 2^53; compareIntegers
+// compares two integers without rounding.
 func convertToFloat64(value interface{}) (float64, bool, error) {
 	switch value := value.(type) {
 	case int:
 		return float64(value), true, nil
 	case float64:
 		return value, true, nil
+	case uint64:
+		return float64(value), true, nil
+	case json.Number:
+		v, err := value.Float64()
+		return v, err == nil, err
 	case string:
 		if v, err := strconv.ParseFloat(value, 64); err == nil {
 			return v, true, nil
@@ -297,9 +1218,114 @@ func convertToFloat64(value interface{}) (float64, bool, error) {
 			return 0, false, err
 		}
 	}
+	if v, ok := toInt64(value); ok {
+		return float64(v), true, nil
+	}
 	return 0, false, fmt.Errorf("unsupported type: %T", value)
 }
 
+// toInt64 converts a value of any Go integer type, or a json.Number holding an integer, to an
+// int64. The second return value is false if the value is not an integer, or is an integer too
+// large for an int64.
+func toInt64(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case int:
+		return int64(value), true
+	case int8:
+		return int64(value), true
+	case int16:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case uint:
+		return int64(value), uint64(value) <= math.MaxInt64
+	case uint8:
+		return int64(value), true
+	case uint16:
+		return int64(value), true
+	case uint32:
+		return int64(value), true
+	case uint64:
+		return int64(value), value <= math.MaxInt64
+	case json.Number:
+		v, err := value.Int64()
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// compareIntegers compares two integers exactly, returning -1, 0 or 1 as a is less than, equal
+// to or greater than b. The second return value is false unless both values are integers. A
+// float64 only holds integers up to 2^53 exactly, so larger integers that differ, such as IDs and
+// nanosecond timestamps, would otherwise compare as equal once converted.
+func compareIntegers(a, b interface{}) (int, bool) {
+	aInt, ok1 := toInt64(a)
+	bInt, ok2 := toInt64(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case aInt < bInt:
+		return -1, true
+	case aInt > bInt:
+		return 1, true
+	}
+	return 0, true
+}
+
+// orderSatisfied reports whether the result of a comparison satisfies a comparison operator.
+func orderSatisfied(operator string, cmp int) bool {
+	switch operator {
+	case "greaterThan":
+		return cmp > 0
+	case "greaterThanOrEqual":
+		return cmp >= 0
+	case "lessThan":
+		return cmp < 0
+	case "lessThanOrEqual":
+		return cmp <= 0
+	}
+	return false
+}
+
+// factToFloat64 converts the value of the named fact to a float64 like convertToFloat64, but
+// returns an *UnsupportedFactTypeError naming the fact when the value's type is not supported.
+func factToFloat64(factName string, value interface{}) (float64, error) {
+	v, _, err := convertToFloat64(value)
+	if err != nil {
+		if _, ok := value.(string); !ok {
+			return 0, &UnsupportedFactTypeError{Fact: factName, Value: value}
+		}
+		return 0, err
+	}
+	return v, nil
+}
+
+// toTime converts a time.Time or an RFC 3339 timestamp string into a time.Time. The second
+// return value is false if the value is not a timestamp.
+func toTime(value interface{}) (time.Time, bool) {
+	switch value := value.(type) {
+	case time.Time:
+		return value, true
+	case string:
+		if !looksLikeTimestamp(value) {
+			return time.Time{}, false
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// looksLikeTimestamp reports whether the string has the shape of an RFC 3339 timestamp, a date
+// and a time separated by T, so that other strings are not parsed.
+func looksLikeTimestamp(value string) bool {
+	return len(value) >= len("2006-01-02T15:04:05Z") && value[4] == '-' && value[7] == '-' &&
+		value[10] == 'T' && value[13] == ':'
+}
+
 // contains checks if a given string is present in a slice of strings.
 func contains(slice []string, str string) bool {
 	for _, s := range slice {
@@ -310,23 +1336,202 @@ func contains(slice []string, str string) bool {
 	return false
 }
 
-// evaluateConditions evaluates a list of conditions against a given fact and returns whether any conditions
-// are satisfied, along with the corresponding facts and values.
-func evaluateConditions(conditions []Condition, fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
-	var facts []string
-	var values []interface{}
+// factLength returns the length of a slice or string fact value, treating null as empty. It
+// returns an *UnsupportedFactTypeError naming the fact for values of any other type.
+func factLength(factName string, value interface{}) (int, error) {
+	switch value := value.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		return len(value), nil
+	}
+	if slice, ok := toSlice(value); ok {
+		return len(slice), nil
+	}
+	return 0, &UnsupportedFactTypeError{Fact: factName, Value: value}
+}
 
-	for _, condition := range conditions {
-		satisfied, fact, value, err := condition.Evaluate(fact, unmatchedFactBehavior)
+// toSlice converts a slice of any element type into a slice of interface{} values. The second
+// return value is false if the value is not a slice or array.
+func toSlice(value interface{}) ([]interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	result := make([]interface{}, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		result[i] = v.Index(i).Interface()
+	}
+	return result, true
+}
+
+// valuesEqual checks if two values are equal, comparing numbers of different types by value and
+// integers exactly.
+func valuesEqual(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	if cmp, ok := compareIntegers(a, b); ok {
+		return cmp == 0
+	}
+	aFloat, ok1, _ := convertToFloat64(a)
+	bFloat, ok2, _ := convertToFloat64(b)
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	return ok1 && ok2 && !aIsString && !bIsString && almostEqual(aFloat, bFloat)
+}
+
+// sliceContains checks if a value is present in a slice, using valuesEqual for comparison.
+func sliceContains(slice []interface{}, value interface{}) bool {
+	for _, v := range slice {
+		if valuesEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAll checks if every element of subset is present in set. Duplicates are ignored.
+func containsAll(set, subset []interface{}) bool {
+	for _, v := range subset {
+		if !sliceContains(set, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny checks if at least one element of candidates is present in set.
+func containsAny(set, candidates []interface{}) bool {
+	for _, v := range candidates {
+		if sliceContains(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// toMap converts a map with string keys into a map[string]interface{}. The second return value
+// is false if the value is not such a map.
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, true
+	}
+	if value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	result := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		result[iter.Key().String()] = iter.Value().Interface()
+	}
+	return result, true
+}
+
+// mapContains checks if every key/value pair of subset is present in set. Nested objects are
+// compared the same way, so they only need to contain the nested pairs of subset. Lists must
+// have the same elements in the same order, and numbers are compared with almostEqual.
+func mapContains(set, subset map[string]interface{}) bool {
+	for key, subsetValue := range subset {
+		setValue, ok := set[key]
+		if !ok || !partialEqual(setValue, subsetValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// partialEqual compares a value with an expected value for mapContains.
+func partialEqual(value, expected interface{}) bool {
+	if expectedMap, ok := toMap(expected); ok {
+		valueMap, ok := toMap(value)
+		return ok && mapContains(valueMap, expectedMap)
+	}
+	if expectedSlice, ok := toSlice(expected); ok {
+		valueSlice, ok := toSlice(value)
+		if !ok || len(valueSlice) != len(expectedSlice) {
+			return false
+		}
+		for i := range expectedSlice {
+			if !partialEqual(valueSlice[i], expectedSlice[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return valuesEqual(value, expected)
+}
+
+// evaluateAll evaluates a list of conditions against a given fact and returns whether all of the
+// conditions are satisfied, along with what they report, with paths starting with the index of
+// the condition, such as `[0]`. An empty list of conditions is always satisfied.
+func evaluateAll(conditions []Condition, fact Fact, unmatchedFactBehavior string, withPaths bool) (bool, conditionMatch, error) {
+	var match conditionMatch
+
+	for i := range conditions {
+		condition := &conditions[i]
+		if condition.Optional {
+			continue
+		}
+		satisfied, satisfiedMatch, err := condition.evaluate(fact, unmatchedFactBehavior, withPaths)
+		if err != nil || !satisfied {
+			return false, conditionMatch{}, err // return false as soon as a condition is not satisfied
+		}
+		match.add(satisfiedMatch, indexPath(satisfiedMatch, i))
+	}
+
+	return true, match, nil
+}
+
+// evaluateAny evaluates a list of conditions against a given fact and returns whether any of the
+// conditions are satisfied, along with what every satisfied condition reports, with paths as for
+// evaluateAll. An empty list of conditions is never satisfied, while a list of only optional
+// conditions always is, since optional conditions never affect whether the rule matches. An
+// error from a condition is returned unless an earlier condition was already satisfied.
+func evaluateAny(conditions []Condition, fact Fact, unmatchedFactBehavior string, withPaths bool) (bool, conditionMatch, error) {
+	var match conditionMatch
+	anySatisfied := false
+	required := 0
+
+	for i := range conditions {
+		condition := &conditions[i]
+		if condition.Optional {
+			continue
+		}
+		required++
+		satisfied, satisfiedMatch, err := condition.evaluate(fact, unmatchedFactBehavior, withPaths)
 		if err != nil {
-			return false, nil, nil, err
+			// The later conditions are only evaluated for their facts, labels and paths once one
+			// is satisfied, so their errors no longer decide the result
+			if anySatisfied {
+				continue
+			}
+			return false, conditionMatch{}, err
 		}
 		if satisfied {
-			facts = append(facts, fact...)
-			values = append(values, value...)
-			return true, facts, values, nil // return true as soon as a condition is satisfied
+			anySatisfied = true
+			match.add(satisfiedMatch, indexPath(satisfiedMatch, i))
 		}
 	}
 
-	return false, nil, nil, nil
+	if !anySatisfied && (required > 0 || len(conditions) == 0) {
+		return false, conditionMatch{}, nil
+	}
+	return true, match, nil
+}
+
+// indexPath returns the path prefix of the condition at index i of a list, such as `[0]`, or an
+// empty one if the match of the condition has no paths.
+func indexPath(match conditionMatch, i int) string {
+	if len(match.paths) == 0 {
+		return ""
+	}
+	return "[" + strconv.Itoa(i) + "]"
 }
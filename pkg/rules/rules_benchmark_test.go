@@ -1,6 +1,8 @@
 package rules
 
 import (
+	"fmt"
+	"regexp"
 	"testing"
 )
 
@@ -76,7 +78,7 @@ func BenchmarkEvaluateAllConditions(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _, _, _ = evaluateConditions(conditions, fact, "Ignore")
+		_, _, _ = evaluateAll(conditions, fact, "Ignore", false)
 	}
 }
 
@@ -91,7 +93,7 @@ func BenchmarkEvaluateAnyConditions(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _, _, _ = evaluateConditions(conditions, fact, "Ignore")
+		_, _, _ = evaluateAny(conditions, fact, "Ignore", false)
 	}
 }
 
@@ -109,6 +111,47 @@ func BenchmarkEvaluateMixedConditions(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _, _, _ = evaluateConditions(conditions, fact, "Ignore")
+		_, _, _ = evaluateAll(conditions, fact, "Ignore", false)
 	}
 }
+
+func BenchmarkRegexEvaluation(b *testing.B) {
+	condition := Condition{
+		Fact:     "hostname",
+		Operator: "matchesAny",
+		Value:    []interface{}{`^db-\d+$`, `^web-[a-z]+\.prod$`, `^cache-[0-9a-f]{8}$`},
+	}
+
+	facts := make([]Fact, 1000)
+	for i := range facts {
+		facts[i] = Fact{"hostname": fmt.Sprintf("cache-%08x", i)}
+	}
+
+	b.Run("Cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, fact := range facts {
+				if _, _, _, err := condition.evaluateSimpleCondition(fact, "Ignore"); err != nil {
+					b.Fatalf("Error evaluating condition: %v", err)
+				}
+			}
+		}
+	})
+
+	b.Run("Uncached", func(b *testing.B) {
+		// Compile every pattern on each evaluation, as an uncached implementation would
+		patterns, _ := toSlice(condition.Value)
+		for i := 0; i < b.N; i++ {
+			for _, fact := range facts {
+				for _, pattern := range patterns {
+					matched, err := regexp.MatchString(pattern.(string), fact["hostname"].(string))
+					if err != nil {
+						b.Fatalf("Error matching pattern: %v", err)
+					}
+					if matched {
+						break
+					}
+				}
+			}
+		}
+	})
+}
@@ -1,7 +1,16 @@
 package rules
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 // TestConditionEvaluate tests the Evaluate function of the Condition struct.
@@ -684,7 +693,7 @@ func TestRuleEvaluateComplexNested(t *testing.T) {
 					All: []Condition{
 						{
 							Fact:     "windSpeed",
-							Operator: "equalTo",
+							Operator: "equal",
 							Value:    10,
 						},
 					},
@@ -872,6 +881,7 @@ func TestRuleValidation(t *testing.T) {
 				{Fact: "age", Operator: "equal", Value: 25},
 			},
 		},
+		Event: Event{EventType: "alert"},
 	}
 
 	invalidRule := Rule{
@@ -945,6 +955,39 @@ func TestEvaluateAnyConditionsError(t *testing.T) {
 	}
 }
 
+func TestEvaluateAnyIgnoresErrorsAfterMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		fact      Fact
+	}{
+		{"unmatched fact", Condition{Fact: "b", Operator: "equal", Value: 2}, Fact{"a": 1}},
+		{"unsupported fact type", Condition{Fact: "b", Operator: "greaterThan", Value: 1}, Fact{"a": 1, "b": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{
+				Name:       "TestRule",
+				Conditions: Conditions{Any: []Condition{{Fact: "a", Operator: "equal", Value: 1}, tt.condition}},
+				Event:      Event{EventType: "alert"},
+			}
+			for _, includeTriggeringFact := range []bool{false, true} {
+				satisfied, err := rule.Evaluate(tt.fact, includeTriggeringFact, "Error")
+				if err != nil || !satisfied {
+					t.Errorf("expected the first branch to match without error, got %v and %v", satisfied, err)
+				}
+			}
+
+			// A branch that fails before any other matched still fails the evaluation
+			rule.Conditions.Any[0], rule.Conditions.Any[1] = rule.Conditions.Any[1], rule.Conditions.Any[0]
+			if _, err := rule.Evaluate(tt.fact, false, "Error"); err == nil {
+				t.Errorf("expected an error from the first branch")
+			}
+		})
+	}
+}
+
 // TestValidateWithNestedConditions is a test function that validates a rule with nested conditions.
 //
 // This function defines a rule with nested conditions and validates the rule. It creates a Rule struct
@@ -982,6 +1025,7 @@ func TestValidateWithNestedConditions(t *testing.T) {
 				},
 			},
 		},
+		Event: Event{EventType: "alert"},
 	}
 
 	// Validate the rule
@@ -1047,6 +1091,16 @@ func TestEvaluateSimpleConditionNotContains(t *testing.T) {
 			fact:     Fact{"testFact": []string{"one", "two", "three"}},
 			expected: false,
 		},
+		{
+			name: "Slice with non-string value",
+			condition: Condition{
+				Fact:     "testFact",
+				Operator: "notContains",
+				Value:    3,
+			},
+			fact:     Fact{"testFact": []string{"one", "two"}},
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1058,3 +1112,1108 @@ func TestEvaluateSimpleConditionNotContains(t *testing.T) {
 		})
 	}
 }
+
+// TestEvaluateSimpleConditionSetOperators tests the setEqual, setContainsAll and setContainsAny
+// operators, which compare slices as sets ignoring order and duplicates.
+func TestEvaluateSimpleConditionSetOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		fact     interface{}
+		value    interface{}
+		expected bool
+	}{
+		{"setEqual different order", "setEqual", []string{"b", "a"}, []string{"a", "b"}, true},
+		{"setEqual with duplicates", "setEqual", []interface{}{"a", "b", "a"}, []string{"b", "a"}, true},
+		{"setEqual numbers of mixed types", "setEqual", []interface{}{1.0, 2.0}, []int{2, 1}, true},
+		{"setEqual subset", "setEqual", []string{"a"}, []string{"a", "b"}, false},
+		{"setEqual superset", "setEqual", []string{"a", "b", "c"}, []string{"a", "b"}, false},
+		{"setContainsAll superset", "setContainsAll", []string{"a", "b", "c"}, []string{"c", "a"}, true},
+		{"setContainsAll missing element", "setContainsAll", []string{"a", "b"}, []string{"a", "d"}, false},
+		{"setContainsAny one shared element", "setContainsAny", []string{"a", "b"}, []string{"x", "b"}, true},
+		{"setContainsAny no shared elements", "setContainsAny", []string{"a", "b"}, []string{"x", "y"}, false},
+		{"setEqual non-slice fact", "setEqual", "a", []string{"a"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{
+				Fact:     "tags",
+				Operator: tt.operator,
+				Value:    tt.value,
+			}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"tags": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestValidateCollectsAllErrors tests that Validate reports every problem in a rule, including
+// problems in nested conditions, rather than stopping at the first one.
+func TestValidateCollectsAllErrors(t *testing.T) {
+	rule := Rule{
+		Name: "TestRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "age", Operator: "invalidOperator1", Value: 25},
+				{
+					Any: []Condition{
+						{Fact: "status", Operator: "invalidOperator2", Value: "active"},
+						{Fact: "temperature", Operator: "greaterThan", Value: true},
+					},
+				},
+			},
+		},
+		Event: Event{EventType: "alert"},
+	}
+
+	err := rule.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors, but got none")
+	}
+
+	merr, ok := err.(*multierror.Error)
+	if !ok {
+		t.Fatalf("Expected a *multierror.Error, got %T", err)
+	}
+	if len(merr.Errors) != 3 {
+		t.Errorf("Expected 3 validation errors, got %d: %v", len(merr.Errors), err)
+	}
+
+	for _, expected := range []string{
+		"conditions.all[0].operator: invalid operator: invalidOperator1",
+		"conditions.all[1].any[0].operator: invalid operator: invalidOperator2",
+		"conditions.all[1].any[1].value: operator greaterThan requires a numeric, string or duration value",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got: %v", expected, err)
+		}
+	}
+}
+
+// TestRuleEvaluateScoreWithOptionalConditions tests that optional conditions raise the score of
+// a rule when they are satisfied, without being required for the rule to match.
+func TestRuleEvaluateScoreWithOptionalConditions(t *testing.T) {
+	rule := Rule{
+		Name: "TestRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "humidity", Operator: "greaterThan", Value: 80, Optional: true, Weight: 2.5},
+				{Fact: "windSpeed", Operator: "lessThan", Value: 5, Optional: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		fact          Fact
+		expectedMatch bool
+		expectedScore float64
+	}{
+		{"required only", Fact{"temperature": 35, "humidity": 50, "windSpeed": 10}, true, 0},
+		{"weighted optional", Fact{"temperature": 35, "humidity": 90, "windSpeed": 10}, true, 2.5},
+		{"all optional", Fact{"temperature": 35, "humidity": 90, "windSpeed": 2}, true, 3.5},
+		{"required not satisfied", Fact{"temperature": 25, "humidity": 90, "windSpeed": 2}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, score, err := rule.EvaluateScore(tt.fact, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating rule: %v", err)
+			}
+			if matched != tt.expectedMatch {
+				t.Errorf("expected match %v, got %v", tt.expectedMatch, matched)
+			}
+			if score != tt.expectedScore {
+				t.Errorf("expected score %v, got %v", tt.expectedScore, score)
+			}
+		})
+	}
+}
+
+// TestRuleEvaluateAnyOfOnlyOptionalConditions tests that an any list made only of optional
+// conditions does not keep the rule from matching, while still adding to its score.
+func TestRuleEvaluateAnyOfOnlyOptionalConditions(t *testing.T) {
+	rule := Rule{
+		Name: "TestRule",
+		Conditions: Conditions{
+			All: []Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+			Any: []Condition{
+				{Fact: "humidity", Operator: "greaterThan", Value: 80, Optional: true},
+				{Any: []Condition{{Fact: "windSpeed", Operator: "lessThan", Value: 5, Optional: true}}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		fact          Fact
+		expectedMatch bool
+		expectedScore float64
+	}{
+		{"no optional satisfied", Fact{"temperature": 35, "humidity": 50, "windSpeed": 10}, true, 0},
+		{"optional satisfied", Fact{"temperature": 35, "humidity": 90, "windSpeed": 10}, true, 1},
+		{"required not satisfied", Fact{"temperature": 25, "humidity": 90, "windSpeed": 2}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, score, err := rule.EvaluateScore(tt.fact, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating rule: %v", err)
+			}
+			if matched != tt.expectedMatch {
+				t.Errorf("expected match %v, got %v", tt.expectedMatch, matched)
+			}
+			if score != tt.expectedScore {
+				t.Errorf("expected score %v, got %v", tt.expectedScore, score)
+			}
+		})
+	}
+}
+
+// TestEvaluateSimpleConditionNegativeAndScientificNumbers tests the numeric operators with
+// negative operands and with string facts in scientific notation.
+func TestRuleEvaluateReportsLabelsInOnePass(t *testing.T) {
+	var output bytes.Buffer
+	writer := log.Writer()
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(writer) })
+
+	rule := Rule{
+		Name: "LabeledRule",
+		Conditions: Conditions{Any: []Condition{
+			{Label: "tooHot", Fact: "temperature", Operator: "greaterThan", Value: 30},
+			{Label: "tooHumid", Fact: "humidity", Operator: "greaterThan", Value: 80},
+		}},
+		Event: Event{EventType: "alert"},
+	}
+	// The labels are reported whether or not the triggering facts are
+	for _, includeTriggeringFact := range []bool{false, true} {
+		output.Reset()
+		ruleCopy := rule
+		satisfied, err := ruleCopy.Evaluate(Fact{"temperature": 35}, includeTriggeringFact, "Log")
+		if err != nil || !satisfied {
+			t.Fatalf("expected the rule to match, got %v and %v", satisfied, err)
+		}
+		if !reflect.DeepEqual(ruleCopy.Event.Labels, []string{"tooHot"}) || (len(ruleCopy.Event.Facts) != 0) != includeTriggeringFact {
+			t.Errorf("expected labels [tooHot], got %+v", ruleCopy.Event)
+		}
+		if count := strings.Count(output.String(), "Unmatched fact: humidity"); count != 1 {
+			t.Errorf("expected the unmatched fact to be logged once, got %d times", count)
+		}
+	}
+}
+
+func TestRuleEvaluatePaths(t *testing.T) {
+	var output bytes.Buffer
+	writer := log.Writer()
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(writer) })
+
+	rule := Rule{
+		Name: "PathRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "enabled", Operator: "equal", Value: true},
+				{Fact: "site", Operator: "equal", Value: "north", Optional: true},
+			},
+			Any: []Condition{
+				{Fact: "pressure", Operator: "greaterThan", Value: 1000},
+				{Any: []Condition{
+					{Fact: "temperature", Operator: "greaterThan", Value: 40},
+					{Fact: "humidity", Operator: "greaterThan", Value: 80},
+				}},
+			},
+		},
+		Event: Event{EventType: "alert"},
+	}
+
+	fact := Fact{"enabled": true, "site": "north", "humidity": 90}
+	satisfied, paths, err := rule.EvaluatePaths(fact, false, "Log")
+	if err != nil || !satisfied {
+		t.Fatalf("expected the rule to match, got %v and %v", satisfied, err)
+	}
+	expected := []string{"all[0]", "any[1].any[1]"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+	// Each missing fact is read, and logged, once
+	for _, factName := range []string{"pressure", "temperature"} {
+		if count := strings.Count(output.String(), "Unmatched fact: "+factName+"\n"); count != 1 {
+			t.Errorf("expected %s to be logged once, got %d times", factName, count)
+		}
+	}
+
+	if paths := rule.MatchedPaths(fact, "Ignore"); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected matched paths %v, got %v", expected, paths)
+	}
+	if paths := rule.MatchedPaths(Fact{"enabled": true}, "Ignore"); paths != nil {
+		t.Errorf("expected no paths for a rule that does not match, got %v", paths)
+	}
+}
+
+func TestEvaluateSimpleConditionNegativeAndScientificNumbers(t *testing.T) {
+	tests := []struct {
+		fact     interface{}
+		operator string
+		value    interface{}
+		expected bool
+	}{
+		{-30, "greaterThan", -40, true},
+		{-40, "greaterThan", -30, false},
+		{-30, "greaterThan", -30, false},
+		{-30, "greaterThanOrEqual", -30, true},
+		{-40, "greaterThanOrEqual", -30, false},
+		{-40, "lessThan", -30, true},
+		{-30, "lessThan", -40, false},
+		{-30, "lessThan", -30, false},
+		{-30, "lessThanOrEqual", -30, true},
+		{-30, "lessThanOrEqual", -40, false},
+		{"1e3", "greaterThan", 999, true},
+		{"1e3", "greaterThanOrEqual", 1000, true},
+		{"1e3", "lessThan", 1000, false},
+		{"1e3", "lessThanOrEqual", "1000", true},
+		{"-0.0001", "lessThan", 0, true},
+		{"-0.0001", "greaterThan", -0.001, true},
+		{"-0.0001", "greaterThanOrEqual", -0.0001, true},
+		{"-0.0001", "lessThanOrEqual", "-1e-4", true},
+		{"-0.0001", "greaterThan", 0, false},
+		// Numbers that are equal within the relative tolerance are neither greater nor less
+		{1e10 + 1, "greaterThan", 1e10, false},
+		{-1e10 - 1, "lessThan", -1e10, false},
+		{1e10 + 1, "greaterThanOrEqual", 1e10, true},
+		{1e10 + 1, "lessThanOrEqual", 1e10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v %s %v", tt.fact, tt.operator, tt.value), func(t *testing.T) {
+			condition := Condition{
+				Fact:     "reading",
+				Operator: tt.operator,
+				Value:    tt.value,
+			}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"reading": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionTimestampsWithTolerance(t *testing.T) {
+	tests := []struct {
+		name      string
+		operator  string
+		tolerance time.Duration
+		expected  bool
+	}{
+		{"equal without tolerance", "equal", 0, false},
+		{"equal with tolerance", "equal", 5 * time.Millisecond, true},
+		{"equal with exact tolerance", "equal", time.Millisecond, true},
+		{"notEqual without tolerance", "notEqual", 0, true},
+		{"notEqual with tolerance", "notEqual", 5 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{
+				Fact:      "timestamp",
+				Operator:  tt.operator,
+				Value:     "2024-01-02T15:04:05.000Z",
+				Tolerance: tt.tolerance,
+			}
+			fact := Fact{"timestamp": "2024-01-02T15:04:05.001Z"}
+
+			result, _, _, err := condition.evaluateSimpleCondition(fact, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// The same instant in different time zones is equal
+	condition := Condition{Fact: "timestamp", Operator: "equal", Value: "2024-01-02T16:04:05+01:00"}
+	result, _, _, _ := condition.evaluateSimpleCondition(Fact{"timestamp": time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}, "Ignore")
+	if !result {
+		t.Errorf("Expected timestamps of the same instant to be equal")
+	}
+
+	// Strings that are not shaped like a timestamp are not parsed, and compare as strings
+	for _, value := range []string{"", "hot", "2024-01-02", "2024-01-02 15:04:05Z", "abcd-ef-ghTij:kl:mnZ"} {
+		if _, ok := toTime(value); ok {
+			t.Errorf("expected %q not to be a timestamp", value)
+		}
+	}
+}
+
+func TestEvaluateSimpleConditionObjectOperators(t *testing.T) {
+	fact := Fact{
+		"device": map[string]interface{}{
+			"type":     "thermostat",
+			"firmware": 2.0,
+			"location": map[string]interface{}{"building": "A", "floor": 3},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		operator string
+		value    interface{}
+		expected bool
+	}{
+		{"superset with matching pairs", "supersetOf", map[string]interface{}{"type": "thermostat", "firmware": 2}, true},
+		{"superset with nested pairs", "supersetOf", map[string]interface{}{"location": map[string]interface{}{"floor": 3.0}}, true},
+		{"superset with missing key", "supersetOf", map[string]interface{}{"type": "thermostat", "owner": "ops"}, false},
+		{"superset with different value", "supersetOf", map[string]interface{}{"type": "sensor"}, false},
+		{"subset of larger object", "subsetOf", map[string]interface{}{
+			"type":     "thermostat",
+			"firmware": 2,
+			"location": map[string]interface{}{"building": "A", "floor": 3, "room": 12},
+			"owner":    "ops",
+		}, true},
+		{"subset with missing key", "subsetOf", map[string]interface{}{"type": "thermostat", "firmware": 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "device", Operator: tt.operator, Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(fact, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateAggregateCountWhere(t *testing.T) {
+	fact := Fact{
+		"records": []interface{}{
+			map[string]interface{}{"status": "error", "code": 500},
+			map[string]interface{}{"status": "ok", "code": 200},
+			map[string]interface{}{"status": "error", "code": 503},
+			map[string]interface{}{"code": 404},
+			map[string]interface{}{"status": "error", "code": 502},
+			"not a record",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		inner    Condition
+		operator string
+		value    interface{}
+		expected bool
+	}{
+		{"more than two errors", Condition{Fact: "status", Operator: "equal", Value: "error"}, "greaterThan", 2, true},
+		{"exactly three errors", Condition{Fact: "status", Operator: "equal", Value: "error"}, "equal", 3.0, true},
+		{"more than three errors", Condition{Fact: "status", Operator: "equal", Value: "error"}, "greaterThan", 3, false},
+		{"nested inner condition", Condition{All: []Condition{
+			{Fact: "status", Operator: "equal", Value: "error"},
+			{Fact: "code", Operator: "greaterThanOrEqual", Value: 502},
+		}}, "equal", 2, true},
+		{"missing field is not counted", Condition{Fact: "status", Operator: "notEqual", Value: "error"}, "equal", 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := tt.inner
+			condition := Condition{
+				Fact:      "records",
+				Aggregate: "countWhere",
+				Inner:     &inner,
+				Operator:  tt.operator,
+				Value:     tt.value,
+			}
+			result, _, _, err := condition.Evaluate(fact, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateAggregateCondition(t *testing.T) {
+	rule := Rule{
+		Name: "AggregateRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "records", Aggregate: "sumWhere", Inner: &Condition{Fact: "status", Operator: "equal", Value: "error"}, Operator: "greaterThan", Value: 2},
+				{Fact: "records", Aggregate: "countWhere", Inner: &Condition{Fact: "status", Operator: "hotterThan", Value: "error"}, Operator: "contains", Value: 2},
+				{Fact: "records", Aggregate: "countWhere", Operator: "greaterThan", Value: "two"},
+			},
+		},
+		Event: Event{EventType: "alert"},
+	}
+
+	err := rule.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors, but got none")
+	}
+	for _, expected := range []string{
+		"conditions.all[0].aggregate: invalid aggregate: sumWhere",
+		"conditions.all[1].operator: invalid operator: contains for aggregate: countWhere",
+		"conditions.all[1].inner.operator: invalid operator: hotterThan",
+		"conditions.all[2].value: aggregate countWhere requires a numeric value",
+		"conditions.all[2].inner: aggregate requires an inner condition",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got: %v", expected, err)
+		}
+	}
+}
+
+func TestEvaluateSimpleConditionContainsValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		fact     interface{}
+		value    interface{}
+		expected bool
+	}{
+		{"string value present", map[string]interface{}{"primary": "ok", "backup": "failed"}, "failed", true},
+		{"numeric value present", map[string]interface{}{"zone1": 20.0, "zone2": 35.0}, 35, true},
+		{"object value present", map[string]interface{}{"a": map[string]interface{}{"x": 1}}, map[string]interface{}{"x": 1}, true},
+		{"no value matches", map[string]interface{}{"primary": "ok", "backup": "ok"}, "failed", false},
+		{"string does not equal number", map[string]interface{}{"zone1": "35"}, 35, false},
+		{"fact is not a map", []interface{}{"failed"}, "failed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "status", Operator: "containsValue", Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"status": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionWithinPercent(t *testing.T) {
+	tests := []struct {
+		fact     interface{}
+		value    interface{}
+		expected bool
+	}{
+		{100, []interface{}{100, 10}, true},
+		{110, []interface{}{100, 10}, true},
+		{90, []interface{}{100.0, 10.0}, true},
+		{110.01, []interface{}{100, 10}, false},
+		{89.99, []interface{}{100, 10}, false},
+		{"103.3", []interface{}{"110", 6.1}, true},
+		{-95, []interface{}{-100, 5}, true},
+		{-94.9, []interface{}{-100, 5}, false},
+		{100.1, []interface{}{100, 0.1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v within %v", tt.fact, tt.value), func(t *testing.T) {
+			condition := Condition{Fact: "reading", Operator: "withinPercent", Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"reading": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateWithinPercentValue(t *testing.T) {
+	for _, value := range []interface{}{
+		100,
+		[]interface{}{100},
+		[]interface{}{100, 10, 5},
+		[]interface{}{"high", 10},
+		[]interface{}{100, -10},
+	} {
+		rule := Rule{
+			Name: "PercentRule",
+			Conditions: Conditions{
+				All: []Condition{{Fact: "reading", Operator: "withinPercent", Value: value}},
+			},
+			Event: Event{EventType: "alert"},
+		}
+		err := rule.Validate()
+		if err == nil || !strings.Contains(err.Error(), "conditions.all[0].value: operator withinPercent requires") {
+			t.Errorf("Expected a value error for %v, got %v", value, err)
+		}
+	}
+}
+
+func TestEvaluateSimpleConditionBetween(t *testing.T) {
+	tests := []struct {
+		fact     interface{}
+		value    interface{}
+		expected bool
+	}{
+		{35.5, []int{30, 40}, true},
+		{35, []float64{30.5, 40.5}, true},
+		{30, []interface{}{30, 40.0}, true},
+		{40.0, []interface{}{30.0, 40}, true},
+		{40.01, []int{30, 40}, false},
+		{29, []interface{}{30, 40.5}, false},
+		{"35", []interface{}{"30", 40}, true},
+		{-5, []int{-10, 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v between %v", tt.fact, tt.value), func(t *testing.T) {
+			condition := Condition{Fact: "reading", Operator: "between", Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"reading": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionBetweenInvertedRange(t *testing.T) {
+	condition := Condition{Fact: "reading", Operator: "between", Value: []int{40, 30}}
+	result, _, _, err := condition.evaluateSimpleCondition(Fact{"reading": 35}, "Ignore")
+	if err == nil || !strings.Contains(err.Error(), "low bound that is not above the high bound") {
+		t.Errorf("Expected an inverted range error, got %v", err)
+	}
+	if result {
+		t.Errorf("Expected an inverted range not to match")
+	}
+}
+
+func TestValidateBetweenValue(t *testing.T) {
+	for _, value := range []interface{}{
+		30,
+		[]int{30},
+		[]int{30, 40, 50},
+		[]interface{}{"low", 40},
+		[]interface{}{40, 30.5},
+	} {
+		rule := Rule{
+			Name: "BetweenRule",
+			Conditions: Conditions{
+				All: []Condition{{Fact: "reading", Operator: "between", Value: value}},
+			},
+			Event: Event{EventType: "alert"},
+		}
+		err := rule.Validate()
+		if err == nil || !strings.Contains(err.Error(), "conditions.all[0].value: operator between requires") {
+			t.Errorf("Expected a value error for %v, got %v", value, err)
+		}
+	}
+}
+
+func TestRuleExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	rule := Rule{Name: "PromotionRule", ExpiresAt: &expiresAt}
+
+	if rule.IsExpired(now) {
+		t.Errorf("Expected the rule not to be expired before its expiry time")
+	}
+	if ttl, ok := rule.TTL(now); !ok || ttl != time.Hour {
+		t.Errorf("Expected a TTL of %v, got %v (%v)", time.Hour, ttl, ok)
+	}
+
+	if !rule.IsExpired(expiresAt) {
+		t.Errorf("Expected the rule to be expired at its expiry time")
+	}
+	if ttl, ok := rule.TTL(now.Add(2 * time.Hour)); !ok || ttl != 0 {
+		t.Errorf("Expected a TTL of 0 after expiry, got %v (%v)", ttl, ok)
+	}
+
+	permanent := Rule{Name: "PermanentRule"}
+	if permanent.IsExpired(now) {
+		t.Errorf("Expected a rule without an expiry time never to expire")
+	}
+	if _, ok := permanent.TTL(now); ok {
+		t.Errorf("Expected a rule without an expiry time to have no TTL")
+	}
+}
+
+func TestEvaluateSimpleConditionStringOrdering(t *testing.T) {
+	tests := []struct {
+		operator   string
+		fact       interface{}
+		value      interface{}
+		ignoreCase bool
+		expected   bool
+	}{
+		{"lessThan", "apple", "banana", false, true},
+		{"greaterThan", "apple", "banana", false, false},
+		{"greaterThanOrEqual", "banana", "banana", false, true},
+		{"lessThanOrEqual", "banana", "apple", false, false},
+		// Byte order puts upper case letters before lower case ones
+		{"lessThan", "Banana", "apple", false, true},
+		{"lessThan", "Banana", "apple", true, false},
+		{"greaterThanOrEqual", "APPLE", "apple", true, true},
+		// Numeric strings are still compared as numbers, so "9" is less than "10"
+		{"lessThan", "9", "10", false, true},
+		{"lessThan", "9", 10, false, true},
+		// but a numeric string is ordered as a string against a string that is not a number
+		{"lessThan", "10", "apple", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v %s %v", tt.fact, tt.operator, tt.value), func(t *testing.T) {
+			condition := Condition{Fact: "name", Operator: tt.operator, Value: tt.value, IgnoreCase: tt.ignoreCase}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"name": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// A string fact that is not a number still cannot be compared with a number
+	condition := Condition{Fact: "name", Operator: "greaterThan", Value: 30}
+	if _, _, _, err := condition.evaluateSimpleCondition(Fact{"name": "apple"}, "Ignore"); err == nil {
+		t.Errorf("Expected an error comparing a string fact with a number")
+	}
+}
+
+func TestEvaluateSimpleConditionIsInteger(t *testing.T) {
+	tests := []struct {
+		fact     interface{}
+		expected bool
+	}{
+		{30, true},
+		{30.0, true},
+		{30.5, false},
+		{-4.0, true},
+		{"12", true},
+		{"12.25", false},
+		{1e-12 + 7, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v", tt.fact), func(t *testing.T) {
+			condition := Condition{Fact: "quantity", Operator: "isInteger"}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"quantity": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	condition := Condition{Fact: "quantity", Operator: "isInteger"}
+	if _, _, _, err := condition.evaluateSimpleCondition(Fact{"quantity": "many"}, "Ignore"); err == nil {
+		t.Errorf("Expected an error for a non-numeric fact")
+	}
+}
+
+func TestRuleEvaluateIncludeFacts(t *testing.T) {
+	rule := Rule{
+		Name: "OverTemperature",
+		Conditions: Conditions{
+			All: []Condition{{Fact: "temperature", Operator: "greaterThan", Value: 30}},
+		},
+		Event:  Event{EventType: "alert", IncludeFacts: []string{"deviceId", "temperature", "location"}},
+		Events: []Event{{EventType: "log", IncludeFacts: []string{"deviceId"}}},
+	}
+	fact := Fact{"temperature": 35, "deviceId": "sensor-7", "humidity": 40}
+
+	// The listed facts are reported without the triggering facts being requested
+	ruleCopy := rule
+	satisfied, err := ruleCopy.Evaluate(fact, false, "Ignore")
+	if err != nil {
+		t.Fatalf("Error evaluating rule: %v", err)
+	}
+	if !satisfied {
+		t.Fatalf("Expected rule to be satisfied")
+	}
+	if !reflect.DeepEqual(ruleCopy.Event.Facts, []string{"deviceId", "temperature"}) {
+		t.Errorf("Expected facts [deviceId temperature], got %v", ruleCopy.Event.Facts)
+	}
+	if !reflect.DeepEqual(ruleCopy.Event.Values, []interface{}{"sensor-7", 35}) {
+		t.Errorf("Expected values [sensor-7 35], got %v", ruleCopy.Event.Values)
+	}
+	if !reflect.DeepEqual(ruleCopy.Events[0].Facts, []string{"deviceId"}) {
+		t.Errorf("Expected facts [deviceId] on the additional event, got %v", ruleCopy.Events[0].Facts)
+	}
+	if rule.Events[0].Facts != nil {
+		t.Errorf("Expected the original rule's events to be unchanged, got %v", rule.Events[0].Facts)
+	}
+
+	// A fact that is already reported as triggering is not reported twice
+	ruleCopy = rule
+	if _, err := ruleCopy.Evaluate(fact, true, "Ignore"); err != nil {
+		t.Fatalf("Error evaluating rule: %v", err)
+	}
+	if !reflect.DeepEqual(ruleCopy.Event.Facts, []string{"temperature", "deviceId"}) {
+		t.Errorf("Expected facts [temperature deviceId], got %v", ruleCopy.Event.Facts)
+	}
+}
+
+func TestEvaluateUnsupportedFactType(t *testing.T) {
+	operators := []Condition{
+		{Fact: "temperature", Operator: "greaterThan", Value: 30},
+		{Fact: "temperature", Operator: "between", Value: []interface{}{10, 20}},
+		{Fact: "temperature", Operator: "isInteger"},
+	}
+
+	for _, condition := range operators {
+		t.Run(condition.Operator, func(t *testing.T) {
+			rule := Rule{Name: "Temperature", Conditions: Conditions{All: []Condition{condition}}}
+			_, err := rule.Evaluate(Fact{"temperature": true}, false, "Ignore")
+			var typeErr *UnsupportedFactTypeError
+			if !errors.As(err, &typeErr) {
+				t.Fatalf("Expected an *UnsupportedFactTypeError, got %v", err)
+			}
+			if typeErr.Fact != "temperature" {
+				t.Errorf("Expected fact temperature, got %s", typeErr.Fact)
+			}
+			if typeErr.Value != true {
+				t.Errorf("Expected value true, got %v", typeErr.Value)
+			}
+		})
+	}
+
+	// A string that is not a number is not an unsupported type
+	condition := Condition{Fact: "temperature", Operator: "isInteger"}
+	_, _, _, err := condition.evaluateSimpleCondition(Fact{"temperature": "warm"}, "Ignore")
+	var typeErr *UnsupportedFactTypeError
+	if err == nil || errors.As(err, &typeErr) {
+		t.Errorf("Expected a conversion error that is not an *UnsupportedFactTypeError, got %v", err)
+	}
+}
+
+func TestEvaluateSimpleConditionIsEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		fact     Fact
+		expected bool
+	}{
+		{"Empty slice", "isEmpty", Fact{"errors": []interface{}{}}, true},
+		{"Non-empty slice", "isEmpty", Fact{"errors": []string{"disk full"}}, false},
+		{"Empty string", "isEmpty", Fact{"errors": ""}, true},
+		{"Null", "isEmpty", Fact{"errors": nil}, true},
+		{"Not empty on empty slice", "isNotEmpty", Fact{"errors": []interface{}{}}, false},
+		{"Not empty on non-empty slice", "isNotEmpty", Fact{"errors": []interface{}{"critical"}}, true},
+		{"Absent fact", "isEmpty", Fact{"warnings": []interface{}{}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "errors", Operator: tt.operator}
+			result, _, _, err := condition.evaluateSimpleCondition(tt.fact, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// An absent fact follows the unmatched fact behavior rather than counting as empty
+	condition := Condition{Fact: "errors", Operator: "isEmpty"}
+	if _, _, _, err := condition.evaluateSimpleCondition(Fact{}, "Error"); err == nil {
+		t.Errorf("Expected an unmatched fact error for an absent fact")
+	}
+
+	var typeErr *UnsupportedFactTypeError
+	if _, _, _, err := condition.evaluateSimpleCondition(Fact{"errors": 3}, "Ignore"); !errors.As(err, &typeErr) {
+		t.Errorf("Expected an UnsupportedFactTypeError for a numeric fact, got %v", err)
+	}
+}
+
+func TestEvaluateSimpleConditionFacts(t *testing.T) {
+	condition := Condition{Facts: []string{"homePhone", "workPhone"}, Operator: "equal", Value: "555-0100"}
+
+	satisfied, facts, values, err := condition.evaluateSimpleCondition(Fact{"homePhone": "555-0199", "workPhone": "555-0100"}, "Ignore")
+	if err != nil {
+		t.Fatalf("Error evaluating condition: %v", err)
+	}
+	if !satisfied {
+		t.Fatalf("Expected the condition to match the second listed fact")
+	}
+	if !reflect.DeepEqual(facts, []string{"workPhone"}) || !reflect.DeepEqual(values, []interface{}{"555-0100"}) {
+		t.Errorf("Expected only the matching fact to be reported, got %v %v", facts, values)
+	}
+
+	// A missing listed fact is skipped, and the behavior applies only when all are missing
+	satisfied, _, _, err = condition.evaluateSimpleCondition(Fact{"workPhone": "555-0100"}, "Error")
+	if err != nil || !satisfied {
+		t.Errorf("Expected a match despite the missing homePhone, got %v, %v", satisfied, err)
+	}
+	satisfied, _, _, err = condition.evaluateSimpleCondition(Fact{"homePhone": "555-0199"}, "Error")
+	if err != nil || satisfied {
+		t.Errorf("Expected no match and no error, got %v, %v", satisfied, err)
+	}
+	if _, _, _, err = condition.evaluateSimpleCondition(Fact{"email": "a@example.com"}, "Error"); err == nil {
+		t.Errorf("Expected an unmatched fact error when every listed fact is missing")
+	}
+
+	rule := Rule{
+		Name:       "BothFacts",
+		Conditions: Conditions{All: []Condition{{Fact: "homePhone", Facts: []string{"workPhone"}, Operator: "equal", Value: "555-0100"}}},
+		Event:      Event{EventType: "match"},
+	}
+	if err := rule.Validate(); err == nil || !strings.Contains(err.Error(), "both fact and facts") {
+		t.Errorf("Expected a validation error for a condition with both fact and facts, got %v", err)
+	}
+}
+
+func TestEvaluateSimpleConditionIn(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		fact      Fact
+		expected  bool
+	}{
+		{"Value contains fact", Condition{Fact: "role", Operator: "in", Value: []interface{}{"admin", "editor"}}, Fact{"role": "editor"}, true},
+		{"Value lacks fact", Condition{Fact: "role", Operator: "in", Value: []interface{}{"admin", "editor"}}, Fact{"role": "viewer"}, false},
+		{"Numbers by value", Condition{Fact: "code", Operator: "in", Value: []interface{}{200.0, 204.0}}, Fact{"code": 204}, true},
+		{"ValueFact contains fact", Condition{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}, Fact{"role": "editor", "allowedRoles": []string{"admin", "editor"}}, true},
+		{"ValueFact lacks fact", Condition{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}, Fact{"role": "editor", "allowedRoles": []interface{}{"admin"}}, false},
+		{"ValueFact is not a list", Condition{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}, Fact{"role": "editor", "allowedRoles": "editor"}, false},
+		{"ValueFact is missing", Condition{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}, Fact{"role": "editor"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, _, err := tt.condition.evaluateSimpleCondition(tt.fact, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Membership follows the list passed with each fact
+	rule := Rule{
+		Name:       "AllowedRole",
+		Conditions: Conditions{All: []Condition{{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}}},
+		Event:      Event{EventType: "allowed"},
+	}
+	for _, allowed := range []struct {
+		roles    []string
+		expected bool
+	}{
+		{[]string{"admin"}, false},
+		{[]string{"admin", "editor"}, true},
+	} {
+		satisfied, err := rule.Evaluate(Fact{"role": "editor", "allowedRoles": allowed.roles}, false, "Ignore")
+		if err != nil {
+			t.Fatalf("Error evaluating rule: %v", err)
+		}
+		if satisfied != allowed.expected {
+			t.Errorf("With allowed roles %v, expected %v, got %v", allowed.roles, allowed.expected, satisfied)
+		}
+	}
+
+	condition := Condition{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}
+	if _, _, _, err := condition.evaluateSimpleCondition(Fact{"role": "editor"}, "Error"); err == nil {
+		t.Errorf("Expected an error for a missing valueFact with Error behavior")
+	}
+}
+
+func TestValidateInCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		valid     bool
+	}{
+		{"List value", Condition{Fact: "role", Operator: "in", Value: []interface{}{"admin"}}, true},
+		{"ValueFact", Condition{Fact: "role", Operator: "in", ValueFact: "allowedRoles"}, true},
+		{"Scalar value", Condition{Fact: "role", Operator: "in", Value: "admin"}, false},
+		{"Value and ValueFact", Condition{Fact: "role", Operator: "in", Value: []interface{}{"admin"}, ValueFact: "allowedRoles"}, false},
+		{"ValueFact with another operator", Condition{Fact: "role", Operator: "equal", ValueFact: "allowedRoles"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Name: "Role", Conditions: Conditions{All: []Condition{tt.condition}}, Event: Event{EventType: "role"}}
+			if err := rule.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got error %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionDurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		fact     interface{}
+		value    interface{}
+		expected bool
+	}{
+		{"Duration strings", "greaterThan", "25h", "24h", true},
+		{"Shorter duration string", "greaterThan", "23h59m", "24h", false},
+		{"Mixed units", "lessThanOrEqual", "2h30m", "150m", true},
+		{"Seconds fact against duration", "greaterThan", 90000, "24h", true},
+		{"Float seconds fact against duration", "lessThan", 59.5, "1m", true},
+		{"Numeric string seconds against duration", "greaterThanOrEqual", "60", "1m", true},
+		{"Duration fact against seconds", "lessThan", "90s", 120, true},
+		{"time.Duration fact", "greaterThan", 2 * time.Hour, "90m", true},
+		{"time.Duration value", "lessThan", "5m", 10 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "uptime", Operator: tt.operator, Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"uptime": tt.fact}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Strings that are not durations are still ordered as strings
+	condition := Condition{Fact: "name", Operator: "lessThan", Value: "banana"}
+	result, _, _, err := condition.evaluateSimpleCondition(Fact{"name": "apple"}, "Ignore")
+	if err != nil || !result {
+		t.Errorf("Expected apple to be less than banana, got %v, %v", result, err)
+	}
+}
+
+func TestEvaluateSimpleConditionLargeIntegers(t *testing.T) {
+	// Both values round to 2^53 as float64, so only an integer comparison tells them apart
+	large := int64(1<<53 + 1)
+	smaller := int64(1 << 53)
+	if float64(large) != float64(smaller) {
+		t.Fatalf("expected %d and %d to be equal as float64", large, smaller)
+	}
+
+	tests := []struct {
+		operator string
+		value    interface{}
+		expected bool
+	}{
+		{"equal", smaller, false},
+		{"equal", large, true},
+		{"equal", uint64(large), true},
+		{"notEqual", smaller, true},
+		{"greaterThan", smaller, true},
+		{"greaterThanOrEqual", smaller, true},
+		{"lessThan", smaller, false},
+		{"lessThanOrEqual", smaller, false},
+		{"lessThan", large + 1, true},
+		{"in", []interface{}{smaller}, false},
+		{"in", []interface{}{smaller, large}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.operator, tt.value), func(t *testing.T) {
+			condition := Condition{Fact: "id", Operator: tt.operator, Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"id": large}, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionContainsEmptyString(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		fact     interface{}
+		value    string
+		expected bool
+	}{
+		{"Empty fact contains value", "contains", "", "x", false},
+		{"Empty fact does not contain value", "notContains", "", "x", true},
+		{"Fact contains empty value", "contains", "abc", "", true},
+		{"Fact does not contain empty value", "notContains", "abc", "", false},
+		{"Empty fact contains empty value", "contains", "", "", true},
+		{"Empty fact does not contain empty value", "notContains", "", "", false},
+		{"List with empty element contains empty value", "contains", []string{"a", ""}, "", true},
+		{"List without empty element contains empty value", "contains", []string{"a"}, "", false},
+		{"List without empty element does not contain empty value", "notContains", []string{"a"}, "", true},
+		{"Empty list does not contain empty value", "notContains", []string{}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "text", Operator: tt.operator, Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"text": tt.fact}, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateSimpleConditionHasPrefixIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		fact     interface{}
+		value    interface{}
+		expected bool
+	}{
+		{"Matching prefix", "1234", []interface{}{"9", "12"}, true},
+		{"Whole code as prefix", "1234", []string{"1234"}, true},
+		{"No matching prefix", "1234", []interface{}{"13", "2"}, false},
+		{"Prefix longer than fact", "12", []interface{}{"123"}, false},
+		{"Empty prefix list", "1234", []interface{}{}, false},
+		{"Non-string fact", 1234, []interface{}{"12"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := Condition{Fact: "account", Operator: "hasPrefixIn", Value: tt.value}
+			result, _, _, err := condition.evaluateSimpleCondition(Fact{"account": tt.fact}, "Error")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	for _, value := range []interface{}{"12", []interface{}{"12", 3}} {
+		rule := Rule{
+			Name:       "PrefixRule",
+			Conditions: Conditions{All: []Condition{{Fact: "account", Operator: "hasPrefixIn", Value: value}}},
+			Event:      Event{EventType: "routed"},
+		}
+		if validationErrors := ValidationErrors(rule.Validate()); len(validationErrors) != 1 || validationErrors[0].Path != "conditions.all[0].value" {
+			t.Errorf("expected a value error for %v, got %v", value, validationErrors)
+		}
+	}
+}
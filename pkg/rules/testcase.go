@@ -0,0 +1,37 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TestCase is an example fact shipped alongside rules, together with the names of the rules
+// it is expected to match, so that rule authors can regression-test their rules.
+type TestCase struct {
+	Name          string   `json:"name,omitempty"`
+	Fact          Fact     `json:"fact"`
+	ExpectedRules []string `json:"expectedRules"`
+}
+
+// TestFailure describes a test case whose fact did not match exactly the expected rules.
+type TestFailure struct {
+	Case            TestCase
+	MatchedRules    []string
+	MissingRules    []string // expected rules that did not match
+	UnexpectedRules []string // rules that matched but were not expected
+	Err             error    // error returned while evaluating the fact, if any
+}
+
+func (f *TestFailure) Error() string {
+	var problems []string
+	if f.Err != nil {
+		problems = append(problems, "error: "+f.Err.Error())
+	}
+	if len(f.MissingRules) > 0 {
+		problems = append(problems, "missing: "+strings.Join(f.MissingRules, ", "))
+	}
+	if len(f.UnexpectedRules) > 0 {
+		problems = append(problems, "unexpected: "+strings.Join(f.UnexpectedRules, ", "))
+	}
+	return fmt.Sprintf("test case %q failed: %s", f.Case.Name, strings.Join(problems, "; "))
+}
@@ -0,0 +1,170 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// trendDirections is the set of directions a trend condition can match.
+var trendDirections = map[string]bool{
+	"increasing": true,
+	"decreasing": true,
+	"stable":     true,
+}
+
+// defaultTrendWindow is the number of values a trend condition compares when it has no Window.
+const defaultTrendWindow = 2
+
+// window returns the number of recent values the trend condition compares.
+func (condition *Condition) window() int {
+	if condition.Window == 0 {
+		return defaultTrendWindow
+	}
+	return condition.Window
+}
+
+// validateTrend validates a trend condition, appending any problems found to result.
+func (condition *Condition) validateTrend(result *multierror.Error, path string) *multierror.Error {
+	if !trendDirections[condition.Trend] {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".trend",
+			Message: fmt.Sprintf("invalid trend: %s for fact: %s", condition.Trend, condition.Fact),
+		})
+	}
+
+	if condition.Fact == "" {
+		result = multierror.Append(result, &ValidationError{Path: path + ".fact", Message: "fact cannot be empty"})
+	}
+
+	if condition.Operator != "" {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".operator",
+			Message: fmt.Sprintf("trend conditions do not take an operator, got %s", condition.Operator),
+		})
+	}
+
+	if condition.Inner != nil {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".inner",
+			Message: "trend conditions do not take an inner condition",
+		})
+	}
+
+	if condition.Window != 0 && condition.Window < 2 {
+		result = multierror.Append(result, &ValidationError{
+			Path:    path + ".window",
+			Message: fmt.Sprintf("trend window must be at least 2, got %d", condition.Window),
+		})
+	}
+
+	return result
+}
+
+// evaluateTrend evaluates a trend condition. The recent values of the fact are the series given
+// by WithTrendSeries, or, when there is none, the fact value itself if it is a list. The condition
+// matches when the last `Window` values all move in the trend's direction; with fewer values it
+// does not match.
+func (condition *Condition) evaluateTrend(fact Fact, unmatchedFactBehavior string) (bool, []string, []interface{}, error) {
+	factValue, ok := fact.Lookup(condition.Fact)
+	if !ok {
+		return false, nil, nil, unmatchedFact(condition.Fact, unmatchedFactBehavior)
+	}
+
+	series := condition.series
+	if series == nil {
+		if list, ok := toSlice(factValue); ok {
+			series = list
+		}
+	}
+
+	window := condition.window()
+	if len(series) < window {
+		return false, nil, nil, nil
+	}
+
+	values := make([]float64, window)
+	for i, value := range series[len(series)-window:] {
+		v, err := factToFloat64(condition.Fact, value)
+		if err != nil {
+			return false, nil, nil, fmt.Errorf("error converting trend value to float64: %w", err)
+		}
+		values[i] = v
+	}
+
+	for i := 1; i < window; i++ {
+		prev, current := values[i-1], values[i]
+		var moved bool
+		switch condition.Trend {
+		case "increasing":
+			moved = current > prev && !almostEqual(current, prev)
+		case "decreasing":
+			moved = current < prev && !almostEqual(current, prev)
+		case "stable":
+			moved = almostEqual(current, prev)
+		default:
+			return false, nil, nil, fmt.Errorf("invalid trend: %s", condition.Trend)
+		}
+		if !moved {
+			return false, nil, nil, nil
+		}
+	}
+
+	return true, []string{condition.Fact}, []interface{}{factValue}, nil
+}
+
+// TrendWindows returns the facts referenced by the trend conditions of the rule, including
+// nested ones, mapped to the largest window used for each, or nil if the rule has no trend
+// conditions. The engine keeps that many recent values of each of these facts for the rule.
+func (r *Rule) TrendWindows() map[string]int {
+	var windows map[string]int
+	collectTrendWindows(&windows, r.Conditions.All)
+	collectTrendWindows(&windows, r.Conditions.Any)
+	return windows
+}
+
+// collectTrendWindows adds the windows of the trend conditions to windows, creating the map
+// when the first trend condition is found.
+func collectTrendWindows(windows *map[string]int, conditions []Condition) {
+	for i := range conditions {
+		condition := &conditions[i]
+		if condition.Trend != "" {
+			if *windows == nil {
+				*windows = make(map[string]int)
+			}
+			if window := condition.window(); window > (*windows)[condition.Fact] {
+				(*windows)[condition.Fact] = window
+			}
+		}
+		collectTrendWindows(windows, condition.All)
+		collectTrendWindows(windows, condition.Any)
+	}
+}
+
+// WithTrendSeries returns a copy of the rule whose trend conditions evaluate the given recent
+// values of their facts, oldest first, instead of the fact value. The conditions are copied, but
+// their values are shared with the original rule.
+func (r Rule) WithTrendSeries(series map[string][]interface{}) Rule {
+	r.Conditions = Conditions{
+		All: withTrendSeries(r.Conditions.All, series),
+		Any: withTrendSeries(r.Conditions.Any, series),
+	}
+	return r
+}
+
+// withTrendSeries returns a copy of the conditions with the series set on the trend conditions.
+func withTrendSeries(conditions []Condition, series map[string][]interface{}) []Condition {
+	if conditions == nil {
+		return nil
+	}
+	result := make([]Condition, len(conditions))
+	copy(result, conditions)
+	for i := range result {
+		if result[i].Trend != "" {
+			result[i].series = series[result[i].Fact]
+		}
+		result[i].All = withTrendSeries(result[i].All, series)
+		result[i].Any = withTrendSeries(result[i].Any, series)
+	}
+	return result
+}
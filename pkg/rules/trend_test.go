@@ -0,0 +1,125 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateTrend(t *testing.T) {
+	tests := []struct {
+		trend    string
+		window   int
+		series   []interface{}
+		expected bool
+	}{
+		{"increasing", 0, []interface{}{1, 2}, true},
+		{"increasing", 3, []interface{}{5, 3, 4, 5}, true},
+		{"increasing", 3, []interface{}{3, 4, 4}, false},
+		{"increasing", 3, []interface{}{4, 5}, false},
+		{"decreasing", 3, []interface{}{10, 9.5, "9"}, true},
+		{"decreasing", 2, []interface{}{9, 10}, false},
+		{"stable", 3, []interface{}{1, 2, 2, 2.0}, true},
+		{"stable", 3, []interface{}{2, 2, 3}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s over %v", tt.trend, tt.series), func(t *testing.T) {
+			rule := Rule{
+				Name:       "TrendRule",
+				Conditions: Conditions{All: []Condition{{Fact: "reading", Trend: tt.trend, Window: tt.window}}},
+			}.WithTrendSeries(map[string][]interface{}{"reading": tt.series})
+
+			result, _, _, err := rule.Conditions.All[0].Evaluate(Fact{"reading": tt.series[len(tt.series)-1]}, "Ignore")
+			if err != nil {
+				t.Fatalf("Error evaluating condition: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+
+			// Without a series, a list fact is used as the series
+			condition := Condition{Fact: "reading", Trend: tt.trend, Window: tt.window}
+			if result, _, _, _ := condition.Evaluate(Fact{"reading": tt.series}, "Ignore"); result != tt.expected {
+				t.Errorf("expected %v for a list fact, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	condition := Condition{Fact: "reading", Trend: "increasing", series: []interface{}{1, "high"}}
+	if _, _, _, err := condition.Evaluate(Fact{"reading": "high"}, "Ignore"); err == nil {
+		t.Errorf("Expected an error for a non-numeric trend value")
+	}
+}
+
+func TestTrendWindowsAndSeries(t *testing.T) {
+	rule := Rule{
+		Name: "TrendRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30},
+				{Fact: "temperature", Trend: "increasing", Window: 3},
+			},
+			Any: []Condition{
+				{All: []Condition{{Fact: "pressure", Trend: "stable"}}},
+				{Fact: "temperature", Trend: "decreasing", Window: 4},
+			},
+		},
+	}
+
+	expected := map[string]int{"temperature": 4, "pressure": 2}
+	if windows := rule.TrendWindows(); !reflect.DeepEqual(windows, expected) {
+		t.Errorf("Expected windows %v, got %v", expected, windows)
+	}
+	if windows := (&Rule{Conditions: Conditions{All: []Condition{{Fact: "a", Operator: "equal", Value: 1}}}}).TrendWindows(); windows != nil {
+		t.Errorf("Expected no windows for a rule without trend conditions, got %v", windows)
+	}
+
+	series := map[string][]interface{}{"temperature": {1, 2, 3}, "pressure": {5, 5}}
+	withSeries := rule.WithTrendSeries(series)
+	if !reflect.DeepEqual(withSeries.Conditions.Any[0].All[0].series, series["pressure"]) {
+		t.Errorf("Expected the nested trend condition to get its series, got %v", withSeries.Conditions.Any[0].All[0].series)
+	}
+	if withSeries.Conditions.All[0].series != nil {
+		t.Errorf("Expected conditions without a trend to get no series")
+	}
+	if rule.Conditions.All[1].series != nil || rule.Conditions.Any[0].All[0].series != nil {
+		t.Errorf("Expected the original rule to be unchanged")
+	}
+}
+
+func TestValidateTrendCondition(t *testing.T) {
+	rule := Rule{
+		Name: "TrendRule",
+		Conditions: Conditions{
+			All: []Condition{
+				{Fact: "temperature", Trend: "increasing", Window: 3},
+				{Fact: "temperature", Trend: "sideways"},
+				{Fact: "temperature", Trend: "stable", Window: 1},
+				{Trend: "decreasing", Operator: "greaterThan"},
+				{Fact: "temperature", Trend: "increasing", Inner: &Condition{Fact: "value", Operator: "greaterThan", Value: 1}},
+			},
+		},
+		Event: Event{EventType: "trend"},
+	}
+
+	err := rule.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors, but got none")
+	}
+	for _, expected := range []string{
+		"conditions.all[1].trend: invalid trend: sideways",
+		"conditions.all[2].window: trend window must be at least 2",
+		"conditions.all[3].fact: fact cannot be empty",
+		"conditions.all[3].operator: trend conditions do not take an operator",
+		"conditions.all[4].inner: trend conditions do not take an inner condition",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got: %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "conditions.all[0]") {
+		t.Errorf("Expected the valid trend condition to pass, got: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+	bolt "go.etcd.io/bbolt"
+)
+
+// rulesBucket is the name of the bucket holding the rules, keyed by rule name.
+var rulesBucket = []byte("rules")
+
+// BoltStore is a RuleStore backed by a bbolt database file. Rules are stored as JSON.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens the bbolt database at path, creating it if it does not exist.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening rule store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rulesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating rules bucket: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Put stores the rule, replacing any stored rule with the same name.
+func (s *BoltStore) Put(rule rules.Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("error encoding rule %s: %w", rule.Name, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(rulesBucket).Put([]byte(rule.Name), data)
+	})
+}
+
+// Get returns the rule with the given name, or a RuleNotFoundError if it is not stored.
+func (s *BoltStore) Get(name string) (rules.Rule, error) {
+	var rule rules.Rule
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(rulesBucket).Get([]byte(name))
+		if data == nil {
+			return &RuleNotFoundError{RuleName: name}
+		}
+		return rules.UnmarshalRule(data, &rule)
+	})
+	return rule, err
+}
+
+// Delete removes the rule with the given name. Deleting a rule that is not stored is not an
+// error.
+func (s *BoltStore) Delete(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(rulesBucket).Delete([]byte(name))
+	})
+}
+
+// List returns every stored rule, sorted by name.
+func (s *BoltStore) List() ([]rules.Rule, error) {
+	ruleList := make([]rules.Rule, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(rulesBucket).ForEach(func(name, data []byte) error {
+			var rule rules.Rule
+			if err := rules.UnmarshalRule(data, &rule); err != nil {
+				return fmt.Errorf("error decoding rule %s: %w", name, err)
+			}
+			ruleList = append(ruleList, rule)
+			return nil
+		})
+	})
+	return ruleList, err
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+func testRule(name string) rules.Rule {
+	return rules.Rule{
+		Name:     name,
+		Priority: 1,
+		Conditions: rules.Conditions{
+			All: []rules.Condition{
+				{Fact: "temperature", Operator: "greaterThan", Value: 30.0},
+			},
+		},
+		Event: rules.Event{EventType: "alert", CustomProperty: "AC turned on"},
+	}
+}
+
+func TestBoltStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.db")
+
+	s, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, name := range []string{"RuleB", "RuleA", "RuleC"} {
+		if err := s.Put(testRule(name)); err != nil {
+			t.Fatalf("Failed to put rule: %v", err)
+		}
+	}
+	if err := s.Delete("RuleC"); err != nil {
+		t.Fatalf("Failed to delete rule: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	s, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer s.Close()
+
+	ruleList, err := s.List()
+	if err != nil {
+		t.Fatalf("Failed to list rules: %v", err)
+	}
+	if len(ruleList) != 2 || ruleList[0].Name != "RuleA" || ruleList[1].Name != "RuleB" {
+		t.Fatalf("Expected RuleA and RuleB, got %v", ruleList)
+	}
+
+	rule, err := s.Get("RuleA")
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	if rule.Conditions.All[0].Value != 30.0 || rule.Event.CustomProperty != "AC turned on" {
+		t.Errorf("Expected the stored rule to round-trip, got %+v", rule)
+	}
+
+	var notFound *RuleNotFoundError
+	if _, err := s.Get("RuleC"); !errors.As(err, &notFound) {
+		t.Errorf("Expected a RuleNotFoundError for the deleted rule, got %v", err)
+	}
+}
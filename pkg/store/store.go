@@ -0,0 +1,23 @@
+package store
+
+import (
+	"github.com/rgehrsitz/rulegopher/pkg/rules"
+)
+
+// RuleStore is implemented by persistent stores of rules. Rules are keyed by name, so putting a
+// rule replaces any stored rule with the same name.
+type RuleStore interface {
+	Put(rule rules.Rule) error
+	Get(name string) (rules.Rule, error)
+	Delete(name string) error
+	List() ([]rules.Rule, error)
+}
+
+// RuleNotFoundError is returned when a rule is not in the store.
+type RuleNotFoundError struct {
+	RuleName string
+}
+
+func (e *RuleNotFoundError) Error() string {
+	return "Rule not found in store: " + e.RuleName
+}